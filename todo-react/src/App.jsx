@@ -25,7 +25,8 @@ const App = () => {
     }
 
     // if the url has an ending like /abc -> redirect to / and start page
-    if (possibleSessionString.length !== 32) {
+    // access tokens have 40 chars, ids of legacy lists 32
+    if (possibleSessionString.length !== 40 && possibleSessionString.length !== 32) {
       location.href = "/"
       return
     }
@@ -59,7 +60,7 @@ const App = () => {
     return <StartPage setSession={setSession} />
   } else {
     // session found -> show todo overview
-    return <TodoOverview />
+    return <TodoOverview session={session} />
   }
 }
 
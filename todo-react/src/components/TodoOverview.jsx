@@ -11,7 +11,7 @@ import "../../node_modules/@creativebulma/bulma-tooltip/dist/bulma-tooltip.css"
 
 // component that lists all todos as individual cards and a card for adding new todos
 // also renders a share button
-const TodoOverview = () => {
+const TodoOverview = ({ session }) => {
 
   // state where todos will be saved
   const [todos, setTodos] = useState([]);
@@ -25,10 +25,49 @@ const TodoOverview = () => {
     fetchTodos()
   }, []);
 
+  // live updates: the backend sends every change of the list (also from other users of the list)
+  // over a websocket, the todos are fetched again after every change
+  // if the connection is lost, it reconnects and resumes after the last change it received
+  useEffect(() => {
+    let socket = null
+    let lastChange = null
+    let reconnectTimeout = null
+    let stopped = false
+
+    const fetchTodos = async () => {
+      let response = await reqClient.get('/todo')
+      setTodos(response.data !== null ? response.data : [])
+    }
+
+    const connect = () => {
+      let url = reqClient.defaults.baseURL.replace(/^http/, 'ws') + '/events/ws?access_token=' + session
+      if (lastChange !== null) url += '&since=' + lastChange
+      socket = new WebSocket(url)
+
+      socket.onmessage = (event) => {
+        const message = JSON.parse(event.data)
+        // hello: connected, reset: changes were missed, every other message is a change
+        if (message.type !== 'hello' || lastChange !== null) fetchTodos()
+        lastChange = message.id
+      }
+
+      socket.onclose = () => {
+        if (!stopped) reconnectTimeout = window.setTimeout(connect, 2000)
+      }
+    }
+    connect()
+
+    return () => {
+      stopped = true
+      window.clearTimeout(reconnectTimeout)
+      if (socket !== null) socket.close()
+    }
+  }, [session]);
+
   // uses given data to call the backend to create a new todo, adds the response to the todo state
   const addTodo = async (done, name, text, category) => {
     let response = await reqClient.post('/todo', { done: done, name: name, text: text, category: category })
-    if (response.status == 200 && response.data !== null) setTodos([response.data, ...todos]);
+    if (response.status == 201 && response.data !== null) setTodos([response.data, ...todos]);
   }
 
   // uses given id to call the backend to remove the todo, removesit from the todo state
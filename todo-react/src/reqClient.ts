@@ -2,7 +2,7 @@ import axios from "axios";
 
 // export axios client, so it can be imported from the components
 const reqClient = axios.create({
-  baseURL: "http://localhost:8000/api"
+  baseURL: "http://localhost:8000/api/v1"
 });
 
 export default reqClient;
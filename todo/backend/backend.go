@@ -11,15 +11,36 @@ import (
 )
 
 /*
- * Creates a new todo list, adds the list to the todo list store and returns the listId
+ * Creates a new todo list, adds the list to the todo list store and returns its token as plain text
+ * lists without owner are opened with the returned initial access token (with the id if legacy id access is enabled),
+ * lists created with the token of a session belong to the user of the session, for them the id is returned
  */
 func NewTodoList(w http.ResponseWriter, r *http.Request) {
 
+	// without Authorization Header the list is opened by its access tokens
+	owner := ""
+	if r.Header.Get("Authorization") != "" {
+		token, err := GetTokenFromRequest(r)
+		user := stores.GetUserOfSession(token)
+		if err != nil || user == nil {
+			writeError(w, r, fmt.Errorf("%w: unknown or expired session", errUnauthorized))
+			return
+		}
+		owner = user.Id
+	}
+
 	// create new todo list
-	listId, err := stores.NewTodoList()
+	listId, initialToken, err := stores.NewTodoList(owner)
 	if err != nil {
 		log.Printf("Error while creating new todo list: %v", err)
-		http.Error(w, "server error", http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+
+	// the token is only sent back this time, the id is no credential of the list
+	w.Header().Set("Cache-Control", "no-store")
+	if initialToken != nil {
+		fmt.Fprintln(w, initialToken.Token)
 		return
 	}
 
@@ -27,6 +48,16 @@ func NewTodoList(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, listId)
 }
 
+/*
+ * Returns statistics of the todo list (counts, categories, completion rate and oldest open todos)
+ */
+func GetListStats(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// calculate and send the statistics back
+	json.NewEncoder(w).Encode(todoList.GetStats())
+	log.Println("GET /list/stats (200 OK)")
+}
+
 /*
  * Returns data of
  * a) all todos if no id is given
@@ -49,8 +80,24 @@ func GetTodo(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList)
 	// run regex and try to find the pattern in the url path
 	if re.FindStringIndex(r.URL.String()) == nil {
 		// if the pattern was not found: return all todos
-		json.NewEncoder(w).Encode(todoList.GetTodos())
-		log.Println("GET /todo (200 OK)")
+		// in the format of the Accept header -> 406 Not Acceptable if no format is supported
+		w.Header().Add("Vary", "Accept")
+		encoder, err := negotiateEncoder(r)
+		if err != nil {
+			log.Println("GET /todo (406 Not Acceptable)")
+			writeError(w, r, err)
+			return
+		}
+		// the version of the list and the format are the entity tag of all todos
+		etag := etagFromRepresentation(todoList.Version, encoder.mediaType)
+		w.Header().Set("ETag", etag)
+		if checkIfNoneMatch(r, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			log.Println("GET /todo (304 Not Modified)")
+			return
+		}
+		writeNegotiated(w, r, encoder, todoList.GetTodos())
+		log.Printf("GET /todo (200 OK, %v)", encoder.mediaType)
 	} else {
 		// if the pattern was found: pass to "byId"-function
 		GetTodoById(w, r, todoList)
@@ -58,17 +105,26 @@ func GetTodo(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList)
 }
 
 /*
- * Returns todo with id given in url parameter
+ * Returns todo with id given in url path (/api/todo/{id}) or deprecated url parameter (?id=)
  */
 func GetTodoById(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
 
 	// get id from url
-	idValue, err := getIdFromUrl(r)
+	idValue, err := getTodoId(w, r)
 
 	// if an error occurs while extracting the id from the url -> 400 Bad Request
 	if err != nil {
 		log.Print(err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
+		return
+	}
+
+	// format of the Accept header -> 406 Not Acceptable if no format is supported
+	w.Header().Add("Vary", "Accept")
+	encoder, err := negotiateEncoder(r)
+	if err != nil {
+		log.Printf("GET /todo/%v (406 Not Acceptable)", idValue)
+		writeError(w, r, err)
 		return
 	}
 
@@ -77,11 +133,22 @@ func GetTodoById(w http.ResponseWriter, r *http.Request, todoList *stores.TodoLi
 
 	if todo == nil {
 		log.Printf("todo with id %v not found", idValue)
-		http.Error(w, "todo with given id not found", http.StatusNotFound)
+		writeError(w, r, fmt.Errorf("%w: todo with id %v", stores.ErrNotFound, idValue))
+		return
+	}
+
+	// the version of the todo and the format are its entity tag
+	etag := etagFromRepresentation(todo.Version, encoder.mediaType)
+	w.Header().Set("ETag", etag)
+
+	if checkIfNoneMatch(r, etag) {
+		// client already has the current version of the todo
+		w.WriteHeader(http.StatusNotModified)
+		log.Printf("GET /todo/%v (304 Not Modified)", idValue)
 	} else {
-		// encode to json and send back
-		json.NewEncoder(w).Encode(todo)
-		log.Printf("GET /todo?id=%v (200 OK)", idValue)
+		// encode in the negotiated format and send back
+		writeNegotiated(w, r, encoder, todo)
+		log.Printf("GET /todo/%v (200 OK, %v)", idValue, encoder.mediaType)
 	}
 }
 
@@ -94,7 +161,7 @@ func PostTodo(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList)
 	// check if body is empty -> send 400 Bad Request back
 	if r.Body == nil {
 		log.Println("Request body is nil")
-		http.Error(w, "Request body is nil", http.StatusBadRequest)
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
 		return
 	}
 
@@ -103,20 +170,30 @@ func PostTodo(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList)
 
 	if err != nil {
 		log.Printf("Error while decoding body: %v", err)
-		http.Error(w, "Body is corrupted", http.StatusBadRequest)
+		writeError(w, r, decodeError(err))
 		return
 	}
 
 	// add body=todo to the todo-database
-	newTodo := todoList.AddTodo(*todo)
+	newTodo, err := todoList.AddTodo(*todo)
+
+	if err != nil {
+		log.Printf("Todo could not be added: %v", err)
+		writeError(w, r, err)
+		return
+	}
 
-	// send posted todo back
+	// send posted todo back with the location of the new resource
+	w.Header().Set("Location", apiPath(r, "/todo/%v", newTodo.Id))
+	setETag(w, newTodo.Version)
+	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(newTodo)
-	log.Println("POST /todo (200 OK)")
+	log.Println("POST /todo (201 Created)")
 }
 
 /*
  * Uses the request body to update the data of a todo in the todostore
+ * the id is taken from the url path (/api/todo/{id}) or from the body (deprecated /api/todo)
  * returns the updated todo
  */
 func PutTodo(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
@@ -124,7 +201,7 @@ func PutTodo(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList)
 	// check if body is empty -> send 400 Bad Request back
 	if r.Body == nil {
 		log.Println("Request body is nil")
-		http.Error(w, "Request body is nil", http.StatusBadRequest)
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
 		return
 	}
 
@@ -133,18 +210,47 @@ func PutTodo(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList)
 
 	if err != nil {
 		log.Printf("Error while decoding body: %v", err)
-		http.Error(w, "Body is corrupted", http.StatusBadRequest)
+		writeError(w, r, decodeError(err))
 		return
 	}
 
-	fmt.Print(updatedTodo)
+	// resource-style route -> the id in the path wins over the id in the body
+	if r.PathValue("id") != "" {
+		idValue, err := getIdFromPath(r)
+		if err != nil {
+			log.Print(err.Error())
+			writeError(w, r, err)
+			return
+		}
+		updatedTodo.Id = idValue
+	} else {
+		setDeprecationHeaders(w, apiPath(r, "/todo/%v", updatedTodo.Id))
+	}
+
+	// check that the todo was not changed since the client read it
+	oldTodo := todoList.GetTodoById(updatedTodo.Id)
+	if oldTodo != nil && !preconditionMet(w, r, oldTodo.Version) {
+		log.Printf("Todo with id %v was changed, could not be updated", updatedTodo.Id)
+		return
+	}
+
+	// a completer can only mark the todo as done or not done
+	if oldTodo != nil {
+		if err := checkCompleterUpdate(r, changeOrder == nil && stores.OnlyDoneChanged(oldTodo, updatedTodo)); err != nil {
+			log.Printf("Todo with id %v could not be updated: %v", updatedTodo.Id, err)
+			writeError(w, r, err)
+			return
+		}
+	}
 
 	// update todo in the database
+	todoId := updatedTodo.Id
 	updatedTodo, err = todoList.UpdateTodo(*updatedTodo)
 
 	if err != nil {
-		log.Printf("Todo with id %v not found, could not be updated", (*updatedTodo).Id)
-		http.Error(w, "Todo with given id not found", http.StatusBadRequest)
+		log.Printf("Todo with id %v not found, could not be updated", todoId)
+		writeError(w, r, err)
+		return
 	}
 
 	if changeOrder != nil {
@@ -153,28 +259,117 @@ func PutTodo(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList)
 
 	if err != nil {
 		log.Printf("Error while moving todo: %v", err)
-		http.Error(w, "Error while moving todo", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	// send updated todo back
+	setETag(w, updatedTodo.Version)
 	json.NewEncoder(w).Encode(*updatedTodo)
-	log.Printf("PUT /todo?id=%v (200 OK)", (*updatedTodo).Id)
+	log.Printf("PUT /todo/%v (200 OK)", (*updatedTodo).Id)
+}
+
+/*
+ * Uses the patch in the request body to change single fields of the todo with id given in the url path
+ * supports json merge patch (application/merge-patch+json, default) and json patch (application/json-patch+json)
+ * fields that are not part of the patch keep their value
+ * returns the patched todo
+ */
+func PatchTodo(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// get id from url path
+	idValue, err := getIdFromPath(r)
+
+	if err != nil {
+		log.Print(err.Error())
+		writeError(w, r, err)
+		return
+	}
+
+	// get the todo that will be patched
+	oldTodo := todoList.GetTodoById(idValue)
+
+	if oldTodo == nil {
+		log.Printf("Todo with id %v not found, could not be patched", idValue)
+		writeError(w, r, fmt.Errorf("%w: todo with id %v", stores.ErrNotFound, idValue))
+		return
+	}
+
+	// check that the todo was not changed since the client read it
+	if !preconditionMet(w, r, oldTodo.Version) {
+		log.Printf("Todo with id %v was changed, could not be patched", idValue)
+		return
+	}
+
+	// apply the patch to a copy of the todo
+	patchedTodo, changeOrder, err := stores.PatchTodoFromJson(r, oldTodo)
+
+	// patches that could not be applied or produce an invalid todo keep their error
+	if err != nil {
+		log.Printf("Error while applying patch: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	// a completer can only mark the todo as done or not done
+	if err := checkCompleterUpdate(r, changeOrder == nil && stores.OnlyDoneChanged(oldTodo, patchedTodo)); err != nil {
+		log.Printf("Todo with id %v could not be patched: %v", idValue, err)
+		writeError(w, r, err)
+		return
+	}
+
+	// update todo in the database
+	patchedTodo, err = todoList.UpdateTodo(*patchedTodo)
+
+	if err != nil {
+		log.Printf("Todo with id %v not found, could not be patched", idValue)
+		writeError(w, r, err)
+		return
+	}
+
+	if changeOrder != nil {
+		patchedTodo, err = todoList.MoveTodo(patchedTodo.Id, changeOrder.MoveUp)
+	}
+
+	if err != nil {
+		log.Printf("Error while moving todo: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// send patched todo back
+	setETag(w, patchedTodo.Version)
+	json.NewEncoder(w).Encode(*patchedTodo)
+	log.Printf("PATCH /todo/%v (200 OK)", idValue)
 }
 
 /*
  * Uses the given id to delete the corresponding todo in the todo store
- * returns the todo that was deleted
+ * resource-style route (/api/todo/{id}): returns 204 No Content
+ * deprecated route (/api/todo?id=): returns the todo that was deleted
  */
 func DeleteTodo(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
 
 	// get id from url
-	idValue, err := getIdFromUrl(r)
+	idValue, err := getTodoId(w, r)
 
 	// if an error occurs while extracting the id from the url -> 400 Bad Request
 	if err != nil {
 		log.Print(err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
+		return
+	}
+
+	// check that the todo was not changed since the client read it
+	if todo := todoList.GetTodoById(idValue); todo != nil && !preconditionMet(w, r, todo.Version) {
+		log.Printf("Todo with id %v was changed, could not be deleted", idValue)
 		return
 	}
 
@@ -183,10 +378,69 @@ func DeleteTodo(w http.ResponseWriter, r *http.Request, todoList *stores.TodoLis
 
 	if err != nil {
 		log.Printf("Todo with id %v not found, could not be deleted", idValue)
-		http.Error(w, "Todo with given id not found", http.StatusNotFound)
+		writeError(w, r, err)
+	} else if r.PathValue("id") != "" {
+		// resource-style route: nothing to send back
+		w.WriteHeader(http.StatusNoContent)
+		log.Printf("DELETE /todo/%v (204 No Content)", idValue)
 	} else {
 		// send success message back
 		json.NewEncoder(w).Encode(*removedTodo)
 		log.Printf("DELETE /todo?id=%v (200 OK)", idValue)
 	}
 }
+
+/*
+ * Returns all todos of the todo list with the id given in the url path (/api/lists/{listId}/todos)
+ * the list id in the path has to match the list of the authorization token
+ */
+func GetListTodos(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// the token only grants access to its own list, other lists are reported as not found
+	if !listInPath(w, r, todoList) {
+		return
+	}
+
+	json.NewEncoder(w).Encode(todoList.GetTodos())
+	log.Println("GET /lists/{listId}/todos (200 OK)")
+}
+
+/*
+ * Applies an ordered list of create, update, delete and move operations to the todo list
+ * the operations are applied all or nothing, todos created in the batch can be referenced by later operations
+ * returns the result of every operation
+ */
+func PostBatch(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode operations from request body
+	operations, err := stores.BatchFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	// apply all operations, the list stays untouched if one fails
+	results, err := todoList.ApplyBatch(operations)
+
+	if err != nil {
+		log.Printf("Batch was not applied: %v", err)
+		problem := newProblem(r, err)
+		problem.Results = results
+		writeProblem(w, problem)
+		return
+	}
+
+	// send results back with the new version of the list
+	setETag(w, todoList.Version)
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	log.Printf("POST /todo/batch (200 OK, %v operations)", len(results))
+}
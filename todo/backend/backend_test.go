@@ -0,0 +1,125 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// sends a request to the test server under the path (with its /api prefix) and returns the response with its body
+func testResponse(t *testing.T, serverUrl string, method string, path string, token string, body string) (*http.Response, string) {
+	t.Helper()
+	request, _ := http.NewRequest(method, serverUrl+path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("%v %v: %v", method, path, err)
+	}
+	defer response.Body.Close()
+	responseBody, _ := io.ReadAll(response.Body)
+	return response, string(responseBody)
+}
+
+// the todo routes name the todo with the {id} path parameter and answer with the status of the resource
+func TestTodoPathRoutes(t *testing.T) {
+	server := newTestServer(t)
+	token := newTestListToken(t, server.URL)
+	otherList := newTestListToken(t, server.URL)
+	listTodosPath := "/api/v1/lists/" + testListId(t, server.URL, token) + "/todos"
+
+	response, body := testResponse(t, server.URL, "POST", "/api/v1/todo", token, `{"name":"milk"}`)
+	created := struct{ Id int }{}
+	json.Unmarshal([]byte(body), &created)
+	todoPath := fmt.Sprintf("/api/v1/todo/%v", created.Id)
+	if response.StatusCode != http.StatusCreated || response.Header.Get("Location") != todoPath {
+		t.Fatalf("POST /todo: got %v with Location %q", response.StatusCode, response.Header.Get("Location"))
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		want   int
+	}{
+		{"read", "GET", todoPath, token, "", http.StatusOK},
+		{"replace", "PUT", todoPath, token, `{"name":"oat milk"}`, http.StatusOK},
+		{"patch", "PATCH", todoPath, token, `{"done":true}`, http.StatusOK},
+		{"id is no number", "GET", "/api/v1/todo/milk", token, "", http.StatusBadRequest},
+		{"unknown id", "GET", "/api/v1/todo/99999999", token, "", http.StatusNotFound},
+		{"todo of another list", "GET", todoPath, otherList, "", http.StatusNotFound},
+		{"unknown method", "POST", todoPath, token, `{"name":"milk"}`, http.StatusMethodNotAllowed},
+		{"todos of the list", "GET", listTodosPath, token, "", http.StatusOK},
+		{"todos of another list", "GET", listTodosPath, otherList, "", http.StatusNotFound},
+		{"delete", "DELETE", todoPath, token, "", http.StatusNoContent},
+		{"read deleted", "GET", todoPath, token, "", http.StatusNotFound},
+		{"delete deleted", "DELETE", todoPath, token, "", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		request, _ := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+		request.Header.Set("Authorization", "Bearer "+test.token)
+		if test.method == "PATCH" {
+			request.Header.Set("Content-Type", "application/merge-patch+json")
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, response.StatusCode, test.want)
+		}
+		if response.Header.Get("Deprecation") != "" {
+			t.Errorf("%v: the path route is marked as deprecated", test.name)
+		}
+	}
+}
+
+// the ?id= url parameter and the id in the PUT body still work, their responses point to the path route
+func TestTodoIdParameterIsDeprecated(t *testing.T) {
+	server := newTestServer(t)
+	token := newTestListToken(t, server.URL)
+
+	_, body := testResponse(t, server.URL, "POST", "/api/v1/todo", token, `{"name":"milk"}`)
+	created := struct{ Id int }{}
+	json.Unmarshal([]byte(body), &created)
+	successor := fmt.Sprintf(`</api/v1/todo/%v>; rel="successor-version"`, created.Id)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"read", "GET", fmt.Sprintf("/api/v1/todo?id=%v", created.Id), "", http.StatusOK},
+		{"id in the body", "PUT", "/api/v1/todo", fmt.Sprintf(`{"id":%v,"name":"oat milk"}`, created.Id), http.StatusOK},
+		{"delete", "DELETE", fmt.Sprintf("/api/v1/todo?id=%v", created.Id), "", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		response, body := testResponse(t, server.URL, test.method, test.path, token, test.body)
+		if response.StatusCode != test.want {
+			t.Errorf("%v: got %v, want %v: %v", test.name, response.StatusCode, test.want, body)
+		}
+		if response.Header.Get("Deprecation") != "true" || response.Header.Get("Link") != successor {
+			t.Errorf("%v: got Deprecation %q and Link %q, want the link %v", test.name, response.Header.Get("Deprecation"), response.Header.Get("Link"), successor)
+		}
+		// the versioned route itself has no sunset, only the unversioned legacy routes
+		if response.Header.Get("Sunset") != "" {
+			t.Errorf("%v: got Sunset %q", test.name, response.Header.Get("Sunset"))
+		}
+	}
+
+	// requests without id are no deprecated aliases
+	if response, _ := testResponse(t, server.URL, "GET", "/api/v1/todo", token, ""); response.Header.Get("Deprecation") != "" {
+		t.Errorf("GET /todo without id is marked as deprecated")
+	}
+}
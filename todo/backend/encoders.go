@@ -0,0 +1,333 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * Formats of responses, selected by the Accept header of the request (content negotiation)
+ * handlers send their data with writeNegotiated and do not know the formats,
+ * new formats are added with RegisterEncoder:
+ *
+ *	backend.RegisterEncoder("text/tab-separated-values", encodeTsv)
+ *
+ * csv and markdown write one row per todo (or per element of a slice) with the json fields as columns
+ */
+
+// writes a value of the stores (struct, pointer to a struct or slice of structs) in a format
+type Encoder func(w io.Writer, value interface{}) error
+
+// format of a response
+type registeredEncoder struct {
+	mediaType string
+	encode    Encoder
+}
+
+// supported formats, the first one is used if the client accepts every format
+var encoders = []registeredEncoder{
+	{"application/json", encodeJson},
+	{"application/x-ndjson", encodeNdjson},
+	{"text/csv", encodeCsv},
+	{"application/yaml", encodeYaml},
+	{"text/markdown", encodeMarkdown},
+}
+
+/* Adds a format or replaces the encoder of a format
+ * mediaType:	media type of the format, e.g. "text/csv"
+ * encode:		function that writes the value in the format
+ */
+func RegisterEncoder(mediaType string, encode Encoder) {
+	for index := range encoders {
+		if encoders[index].mediaType == mediaType {
+			encoders[index].encode = encode
+			return
+		}
+	}
+	encoders = append(encoders, registeredEncoder{mediaType, encode})
+}
+
+// returns the media types of all formats (used in the OpenAPI document)
+func encoderMediaTypes() []string {
+	mediaTypes := []string{}
+	for _, encoder := range encoders {
+		mediaTypes = append(mediaTypes, encoder.mediaType)
+	}
+	return mediaTypes
+}
+
+// a media range of the Accept header with its quality
+type acceptedRange struct {
+	mediaType string
+	quality   float64
+	// 2 for type/subtype, 1 for type/*, 0 for */*
+	specificity int
+}
+
+/* Selects the format of the response from the Accept header (RFC 9110, section 12.5.1)
+ * without Accept header the first format (json) is used
+ * returns:	the encoder or an error if no format is acceptable (406 Not Acceptable)
+ */
+func negotiateEncoder(r *http.Request) (registeredEncoder, error) {
+
+	header := strings.Join(r.Header.Values("Accept"), ",")
+	if strings.TrimSpace(header) == "" {
+		return encoders[0], nil
+	}
+
+	// parse the media ranges, ranges with q=0 are not acceptable
+	ranges := []acceptedRange{}
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, set := params["q"]; set {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		specificity := 2
+		if mediaType == "*/*" {
+			specificity = 0
+		} else if strings.HasSuffix(mediaType, "/*") {
+			specificity = 1
+		}
+		ranges = append(ranges, acceptedRange{mediaType, quality, specificity})
+	}
+
+	// best quality first, more specific ranges before less specific ones, then in the order of the header
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].quality != ranges[j].quality {
+			return ranges[i].quality > ranges[j].quality
+		}
+		return ranges[i].specificity > ranges[j].specificity
+	})
+
+	for _, accepted := range ranges {
+		if accepted.quality <= 0 {
+			break
+		}
+		for _, encoder := range encoders {
+			if mediaRangeMatches(accepted.mediaType, encoder.mediaType) {
+				return encoder, nil
+			}
+		}
+	}
+
+	return registeredEncoder{}, fmt.Errorf("%w: supported formats are %v", errNotAcceptable, strings.Join(encoderMediaTypes(), ", "))
+}
+
+// checks if a media type is part of a media range (e.g. text/csv is part of text/*)
+func mediaRangeMatches(mediaRange string, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	prefix, isWildcard := strings.CutSuffix(mediaRange, "*")
+	return isWildcard && strings.HasSuffix(prefix, "/") && strings.HasPrefix(mediaType, prefix)
+}
+
+/* Sends a value in the format that was selected with negotiateEncoder
+ * the value is written into a buffer first, so an error of the encoder can still be sent as problem
+ */
+func writeNegotiated(w http.ResponseWriter, r *http.Request, encoder registeredEncoder, value interface{}) {
+
+	buffer := &bytes.Buffer{}
+	if err := encoder.encode(buffer, value); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	contentType := encoder.mediaType
+	if strings.HasPrefix(contentType, "text/") {
+		contentType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(buffer.Bytes())
+}
+
+// json, like every other response of the api
+func encodeJson(w io.Writer, value interface{}) error {
+	return json.NewEncoder(w).Encode(value)
+}
+
+// newline delimited json, one line per element of a slice
+func encodeNdjson(w io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(w)
+	for _, element := range elementsOf(value) {
+		if err := encoder.Encode(element); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csv with a header row of the json field names
+func encodeCsv(w io.Writer, value interface{}) error {
+	columns, rows := tableOf(value)
+	// spreadsheets run cells that start with =, +, - or @ as formulas, also after a leading tab or carriage return,
+	// the ' keeps them text
+	for _, row := range rows {
+		for index, cell := range row {
+			if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+				row[index] = "'" + cell
+			}
+		}
+	}
+	writer := csv.NewWriter(w)
+	writer.Write(columns)
+	writer.WriteAll(rows)
+	return writer.Error()
+}
+
+// yaml with the field names and field order of the json structure
+func encodeYaml(w io.Writer, value interface{}) error {
+
+	// json is yaml, decoding it into a node keeps the order of the fields
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	node := &yaml.Node{}
+	if err := yaml.Unmarshal(encoded, node); err != nil {
+		return err
+	}
+	blockStyle(node)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// removes the flow style of the decoded json, so the yaml is written as blocks
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// markdown table with a header row of the json field names
+func encodeMarkdown(w io.Writer, value interface{}) error {
+
+	columns, rows := tableOf(value)
+
+	// pipes end a cell and line breaks end a row
+	escape := strings.NewReplacer("|", "\\|", "\r\n", "<br>", "\n", "<br>")
+	writeRow := func(cells []string) {
+		escaped := make([]string, len(cells))
+		for index, cell := range cells {
+			escaped[index] = escape.Replace(cell)
+		}
+		fmt.Fprintf(w, "| %v |\n", strings.Join(escaped, " | "))
+	}
+
+	writeRow(columns)
+	separator := make([]string, len(columns))
+	for index := range separator {
+		separator[index] = "---"
+	}
+	writeRow(separator)
+	for _, row := range rows {
+		writeRow(row)
+	}
+	return nil
+}
+
+// returns the elements of a slice or the value itself
+func elementsOf(value interface{}) []interface{} {
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() != reflect.Slice {
+		return []interface{}{value}
+	}
+	elements := make([]interface{}, reflected.Len())
+	for index := range elements {
+		elements[index] = reflected.Index(index).Interface()
+	}
+	return elements
+}
+
+/* Converts a struct or a slice of structs into a table
+ * the columns are the json fields of the struct in their order, fields that are not sent as json are skipped
+ * returns:	names of the columns and the cells of every row
+ */
+func tableOf(value interface{}) ([]string, [][]string) {
+
+	rowType := reflect.TypeOf(value)
+	for rowType != nil && (rowType.Kind() == reflect.Slice || rowType.Kind() == reflect.Pointer) {
+		rowType = rowType.Elem()
+	}
+	if rowType == nil || rowType.Kind() != reflect.Struct {
+		return []string{}, [][]string{}
+	}
+
+	// json names of the fields
+	columns := []string{}
+	fieldIndexes := []int{}
+	for index := 0; index < rowType.NumField(); index++ {
+		name, _, _ := strings.Cut(rowType.Field(index).Tag.Get("json"), ",")
+		if name == "-" || !rowType.Field(index).IsExported() {
+			continue
+		}
+		if name == "" {
+			name = rowType.Field(index).Name
+		}
+		columns = append(columns, name)
+		fieldIndexes = append(fieldIndexes, index)
+	}
+
+	rows := [][]string{}
+	for _, element := range elementsOf(value) {
+		reflected := reflect.ValueOf(element)
+		for reflected.Kind() == reflect.Pointer {
+			reflected = reflected.Elem()
+		}
+		if !reflected.IsValid() {
+			continue
+		}
+		row := make([]string, len(fieldIndexes))
+		for column, fieldIndex := range fieldIndexes {
+			row[column] = formatCell(reflected.Field(fieldIndex))
+		}
+		rows = append(rows, row)
+	}
+
+	return columns, rows
+}
+
+// formats a field as text of a table cell
+func formatCell(field reflect.Value) string {
+
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return ""
+		}
+		field = field.Elem()
+	}
+
+	switch value := field.Interface().(type) {
+	case time.Time:
+		return value.Format(time.RFC3339)
+	case []string:
+		return strings.Join(value, ", ")
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,47 @@
+package backend
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+// cells that spreadsheets would run as formulas are sent as text
+func TestEncodeCsvEscapesFormulas(t *testing.T) {
+	rows := []struct {
+		Name string `json:"name"`
+	}{{"=HYPERLINK(\"x\")"}, {"+1"}, {"-1"}, {"@SUM(A1)"}, {"\t=1+1"}, {"\r=1+1"}, {"milk"}, {""}}
+
+	buffer := &bytes.Buffer{}
+	if err := encodeCsv(buffer, rows); err != nil {
+		t.Fatal(err)
+	}
+	want := "name\n\"'=HYPERLINK(\"\"x\"\")\"\n'+1\n'-1\n'@SUM(A1)\n'\t=1+1\n\"'\r=1+1\"\nmilk\n\n"
+	if buffer.String() != want {
+		t.Errorf("got %q, want %q", buffer.String(), want)
+	}
+}
+
+// every format has its own entity tag, writes match the tags of every format of the version
+func TestRepresentationETags(t *testing.T) {
+	tags := map[string]bool{}
+	for _, mediaType := range encoderMediaTypes() {
+		tag := etagFromRepresentation(3, mediaType)
+		if tags[tag] {
+			t.Errorf("%v: tag %v is used by another format", mediaType, tag)
+		}
+		tags[tag] = true
+
+		request := httptest.NewRequest("PUT", "/todo/1", nil)
+		request.Header.Set("If-Match", tag)
+		if !checkIfMatch(request, 3) || checkIfMatch(request, 4) {
+			t.Errorf("%v: If-Match %v does not match version 3 only", mediaType, tag)
+		}
+	}
+
+	request := httptest.NewRequest("GET", "/todo", nil)
+	request.Header.Set("If-None-Match", etagFromRepresentation(3, "application/json"))
+	if checkIfNoneMatch(request, etagFromRepresentation(3, "text/csv")) {
+		t.Errorf("json tag matches the csv representation")
+	}
+}
@@ -0,0 +1,105 @@
+package backend
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/* Creates the entity tag of a resource from its version
+ * todos use the version of the todo, the collection of todos uses the version of the list
+ */
+func etagFromVersion(version int) string {
+	return fmt.Sprintf("\"%v\"", version)
+}
+
+/* Creates the entity tag of a representation of a resource
+ * every format of a version has its own tag, json (the default format) keeps the tag of the version
+ * mediaType:	media type of the negotiated format, e.g. "text/csv"
+ */
+func etagFromRepresentation(version int, mediaType string) string {
+	if mediaType == encoders[0].mediaType {
+		return etagFromVersion(version)
+	}
+	return fmt.Sprintf("\"%v-%v\"", version, mediaType)
+}
+
+// returns the version of an entity tag of a representation, -1 for weak or invalid tags
+func versionOfETag(tag string) int {
+	tag, quoted := strings.CutPrefix(tag, "\"")
+	tag, closed := strings.CutSuffix(tag, "\"")
+	if !quoted || !closed {
+		return -1
+	}
+	versionPart, _, _ := strings.Cut(tag, "-")
+	version, err := strconv.Atoi(versionPart)
+	if err != nil {
+		return -1
+	}
+	return version
+}
+
+/* Sets the ETag header of the response
+ * version:	version of the todo or todo list that is sent back
+ */
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", etagFromVersion(version))
+}
+
+/* Checks the If-Match header of the request against the current version of a resource
+ * the header contains "*" or a comma separated list of entity tags
+ * if no If-Match header was sent -> returns true
+ * if the current version matches one of the tags -> returns true, the tags of every format of the version match
+ * if the resource changed since the client read it -> returns false (412 Precondition Failed)
+ */
+func checkIfMatch(r *http.Request, version int) bool {
+
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		// weak tags never match in the strong comparison of If-Match
+		if tag == "*" || versionOfETag(tag) == version {
+			return true
+		}
+	}
+	return false
+}
+
+/* Checks the If-None-Match header of the request against the current entity tag of a resource
+ * etag:	tag of the representation that would be sent back
+ * if one of the tags matches -> returns true (client already has the current data, 304 Not Modified)
+ * if no tag matches or no header was sent -> returns false
+ */
+func checkIfNoneMatch(r *http.Request, etag string) bool {
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		// If-None-Match uses the weak comparison, so W/ prefixes are ignored
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+/* Sends 412 Precondition Failed back if the If-Match header does not match the version
+ * returns true if the request can continue, false if the response was already sent
+ */
+func preconditionMet(w http.ResponseWriter, r *http.Request, version int) bool {
+	if checkIfMatch(r, version) {
+		return true
+	}
+	setETag(w, version)
+	writeError(w, r, fmt.Errorf("%w: todo was changed by someone else", errPreconditionFailed))
+	return false
+}
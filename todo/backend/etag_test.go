@@ -0,0 +1,131 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckIfMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", true},
+		{"*", true},
+		{`"3"`, true},
+		{`"1", "3"`, true},
+		{`"3-text/csv"`, true},
+		{`"2"`, false},
+		{`W/"3"`, false},
+		{`3`, false},
+		{`"three"`, false},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest("PUT", "/todo/1", nil)
+		request.Header.Set("If-Match", test.header)
+		if got := checkIfMatch(request, 3); got != test.want {
+			t.Errorf("If-Match %v: got %v, want %v", test.header, got, test.want)
+		}
+	}
+}
+
+func TestCheckIfNoneMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"*", true},
+		{`"3"`, true},
+		{`W/"3"`, true},
+		{`"1", W/"3"`, true},
+		{`"2"`, false},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/todo", nil)
+		request.Header.Set("If-None-Match", test.header)
+		if got := checkIfNoneMatch(request, `"3"`); got != test.want {
+			t.Errorf("If-None-Match %v: got %v, want %v", test.header, got, test.want)
+		}
+	}
+}
+
+// writes with an outdated If-Match fail with the current ETag, reads with the current If-None-Match are not sent again
+func TestConditionalRequests(t *testing.T) {
+	server := newTestServer(t)
+	token := newTestListToken(t, server.URL)
+
+	_, body := testRequest(t, server.URL, "POST", "/todo", token, `{"name":"milk"}`)
+	created := struct{ Id int }{}
+	json.Unmarshal([]byte(body), &created)
+	todoPath := fmt.Sprintf("/todo/%v", created.Id)
+
+	// sends the request with the headers and returns the status and the ETag of the response
+	send := func(method string, path string, headers map[string]string, body string) (int, string) {
+		request, _ := http.NewRequest(method, server.URL+"/api/v1"+path, strings.NewReader(body))
+		request.Header.Set("Authorization", "Bearer "+token)
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode, response.Header.Get("ETag")
+	}
+
+	_, first := send("GET", todoPath, nil, "")
+	_, listFirst := send("GET", "/todo", nil, "")
+
+	status, second := send("PUT", todoPath, map[string]string{"If-Match": first}, `{"name":"oat milk"}`)
+	if status != http.StatusOK || second == first {
+		t.Fatalf("PUT with the current ETag: got %v with ETag %v", status, second)
+	}
+
+	// the client still has the first version
+	stale := []struct {
+		method      string
+		contentType string
+		body        string
+	}{
+		{"PUT", "", `{"name":"soy milk"}`},
+		{"PATCH", "application/merge-patch+json", `{"done":true}`},
+		{"DELETE", "", ""},
+	}
+	for _, test := range stale {
+		headers := map[string]string{"If-Match": first}
+		if test.contentType != "" {
+			headers["Content-Type"] = test.contentType
+		}
+		if status, etag := send(test.method, todoPath, headers, test.body); status != http.StatusPreconditionFailed || etag != second {
+			t.Errorf("%v with an outdated ETag: got %v with ETag %v, want 412 with %v", test.method, status, etag, second)
+		}
+	}
+
+	if status, _ := send("GET", todoPath, map[string]string{"If-None-Match": second}, ""); status != http.StatusNotModified {
+		t.Errorf("GET with the current ETag: got %v", status)
+	}
+	if status, _ := send("GET", todoPath, map[string]string{"If-None-Match": first}, ""); status != http.StatusOK {
+		t.Errorf("GET with an outdated ETag: got %v", status)
+	}
+
+	// the collection has the version of the list, every change of a todo changes it
+	status, listSecond := send("GET", "/todo", map[string]string{"If-None-Match": listFirst}, "")
+	if status != http.StatusOK || listSecond == listFirst {
+		t.Errorf("GET /todo after the change: got %v with ETag %v", status, listSecond)
+	}
+	if status, _ := send("GET", "/todo", map[string]string{"If-None-Match": listSecond}, ""); status != http.StatusNotModified {
+		t.Errorf("GET /todo with the current ETag: got %v", status)
+	}
+
+	if status, _ := send("DELETE", todoPath, map[string]string{"If-Match": second}, ""); status != http.StatusNoContent {
+		t.Errorf("DELETE with the current ETag: got %v", status)
+	}
+}
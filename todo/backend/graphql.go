@@ -0,0 +1,688 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * GraphQL endpoint (POST /api/v1/graphql)
+ * fetches a todo list with its todos, categories, stats and saved searches in one request
+ * and mirrors the REST operations of the todo list as mutations (add, update, remove, move)
+ * the endpoint uses the AUTH middleware, so the list of the bearer token is the root of every query
+ */
+
+// limits of a query, checked before the query is executed
+const (
+	// maximum nesting of fields, e.g. { list { todos { name } } } has a depth of 3
+	graphqlMaxDepth = 6
+	// maximum cost of a query, every field costs 1, the fields below a list are counted graphqlListFactor times
+	graphqlMaxComplexity = 500
+	graphqlListFactor    = 10
+)
+
+// fields that return lists, their selections are multiplied in the complexity of a query
+var graphqlListFields = map[string]bool{
+	"todos":          true,
+	"categories":     true,
+	"searches":       true,
+	"oldestOpen":     true,
+	"completionRate": true,
+}
+
+// structure of a GraphQL request body
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// key of the request data of the resolvers in the context
+type graphqlContextKey struct{}
+
+// data the resolvers need from the request
+type graphqlContext struct {
+	todoList *stores.TodoList
+	request  *http.Request
+}
+
+/*
+ * error of a resolver with the code of the problem details of the REST api
+ * the code and the field errors are sent back in the extensions of the GraphQL error
+ */
+type graphqlError struct {
+	err     error
+	problem problem
+}
+
+func (graphqlError *graphqlError) Error() string {
+	return graphqlError.err.Error()
+}
+
+// extensions of the GraphQL error (gqlerrors.ExtendedError)
+func (graphqlError *graphqlError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{
+		"code":   graphqlError.problem.Code,
+		"status": graphqlError.problem.Status,
+	}
+	if len(graphqlError.problem.Errors) > 0 {
+		extensions["errors"] = graphqlError.problem.Errors
+	}
+	return extensions
+}
+
+// returns the data of the request that is executed
+func fromContext(ctx context.Context) graphqlContext {
+	return ctx.Value(graphqlContextKey{}).(graphqlContext)
+}
+
+// wraps an error of the stores, so the client gets the same code as from the REST api
+func resolverError(ctx context.Context, err error) error {
+	return &graphqlError{err, newProblem(fromContext(ctx).request, err)}
+}
+
+// types of the schema
+var (
+	todoType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Todo",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"name":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"text":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"done":      &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"category":  &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String)))},
+			"created":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"completed": &graphql.Field{Type: graphql.DateTime},
+			"version":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	categoryStatsType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "CategoryStats",
+		Fields: graphql.Fields{
+			"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"open":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"done":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	windowStatsType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "WindowStats",
+		Fields: graphql.Fields{
+			"window":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"created":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"completed": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"rate":      &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		},
+	})
+
+	// the maps of the REST stats are lists in GraphQL, the key is a field of the entries
+	statsType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Stats",
+		Fields: graphql.Fields{
+			"total":          &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"open":           &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"done":           &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"categories":     &graphql.Field{Type: graphql.NewList(categoryStatsType), Resolve: resolveStatsMap("categories", "name")},
+			"completionRate": &graphql.Field{Type: graphql.NewList(windowStatsType), Resolve: resolveStatsMap("completionRate", "window")},
+			"oldestOpen":     &graphql.Field{Type: graphql.NewList(todoType)},
+		},
+	})
+
+	filterType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "TodoFilter",
+		Fields: graphql.Fields{
+			"category": &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"done":     &graphql.Field{Type: graphql.Boolean},
+			"query":    &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	searchType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "SavedSearch",
+		Fields: graphql.Fields{
+			"id":     &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"name":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"filter": &graphql.Field{Type: graphql.NewNonNull(filterType)},
+		},
+	})
+
+	// arguments of the todos field, same criteria as a saved search
+	filterArgs = graphql.FieldConfigArgument{
+		"category": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+		"done":     &graphql.ArgumentConfig{Type: graphql.Boolean},
+		"query":    &graphql.ArgumentConfig{Type: graphql.String},
+	}
+
+	listType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "List",
+		Fields: graphql.Fields{
+			"id":         &graphql.Field{Type: graphql.String, Resolve: resolveListId},
+			"version":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"todos":      &graphql.Field{Type: graphql.NewList(todoType), Args: filterArgs, Resolve: resolveTodos},
+			"todo":       &graphql.Field{Type: todoType, Args: idArgs, Resolve: resolveTodo},
+			"categories": &graphql.Field{Type: graphql.NewList(graphql.String), Resolve: resolveCategories},
+			"stats":      &graphql.Field{Type: statsType, Resolve: resolveStats},
+			"searches":   &graphql.Field{Type: graphql.NewList(searchType), Resolve: resolveSearches},
+		},
+	})
+
+	// fields of a new todo, id, timestamps and version are set by the server
+	newTodoInput = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "NewTodoInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"text":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"done":     &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+			"category": &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+		},
+	})
+
+	// fields of a todo that are changed, missing fields keep their value (like PATCH with a merge patch)
+	todoPatchInput = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "TodoPatchInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"text":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"done":     &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+			"category": &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+		},
+	})
+
+	// id of a todo, the optional version works like the If-Match header
+	idArgs = graphql.FieldConfigArgument{
+		"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+	}
+)
+
+// schema of the endpoint, created once at startup
+var graphqlSchema = mustGraphqlSchema()
+
+func mustGraphqlSchema() graphql.Schema {
+
+	versionArg := &graphql.ArgumentConfig{Type: graphql.Int, Description: "expected version of the todo"}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"list": &graphql.Field{
+				Type: graphql.NewNonNull(listType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return fromContext(p.Context).todoList, nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"addTodo": &graphql.Field{
+				Type:    todoType,
+				Args:    graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(newTodoInput)}},
+				Resolve: resolveAddTodo,
+			},
+			"updateTodo": &graphql.Field{
+				Type: todoType,
+				Args: graphql.FieldConfigArgument{
+					"id":      idArgs["id"],
+					"input":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(todoPatchInput)},
+					"version": versionArg,
+				},
+				Resolve: resolveUpdateTodo,
+			},
+			"removeTodo": &graphql.Field{
+				Type:    todoType,
+				Args:    graphql.FieldConfigArgument{"id": idArgs["id"], "version": versionArg},
+				Resolve: resolveRemoveTodo,
+			},
+			"moveTodo": &graphql.Field{
+				Type: todoType,
+				Args: graphql.FieldConfigArgument{
+					"id": idArgs["id"],
+					"up": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Boolean)},
+				},
+				Resolve: resolveMoveTodo,
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+	if err != nil {
+		log.Fatalf("GraphQL schema is invalid: %v", err)
+	}
+	return schema
+}
+
+/*
+ * Executes a GraphQL query or mutation on the todo list of the token
+ * queries that are nested too deep, are too expensive or contain fragment cycles are rejected with 400 Bad Request
+ * errors of resolvers are sent back in the errors of the response (200 OK), like every GraphQL server
+ */
+func PostGraphQL(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode the query from the request body
+	request := graphqlRequest{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, stores.Rules.MaxBodyBytes)).Decode(&request)
+
+	if err != nil || request.Query == "" {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, fmt.Errorf("%w: body is not a GraphQL request", errBadRequest))
+		return
+	}
+
+	// check the limits before anything is resolved
+	if err := checkQueryLimits(request.Query); err != nil {
+		log.Printf("POST /graphql (400 Bad Request): %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": []interface{}{map[string]interface{}{
+				"message":    err.Error(),
+				"extensions": map[string]interface{}{"code": "query-rejected"},
+			}},
+		})
+		return
+	}
+
+	// execute the query, the resolvers get the todo list from the context
+	ctx := context.WithValue(r.Context(), graphqlContextKey{}, graphqlContext{todoList, r})
+	result := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        ctx,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+	log.Printf("POST /graphql (200 OK, %v errors)", len(result.Errors))
+}
+
+/* Checks the depth and complexity of a query
+ * query:	GraphQL document
+ * returns:	error if the query can not be parsed or exceeds a limit
+ */
+func checkQueryLimits(query string) error {
+
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		// syntax errors are reported by the execution
+		return nil
+	}
+
+	// fragments can be used in every operation of the document
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	// fragments that spread themselves are rejected here, the validation of the graphql package
+	// does not stop on them and overflows the stack
+	if err := checkFragmentCycles(fragments); err != nil {
+		return err
+	}
+
+	measure := &queryMeasure{fragments, map[string]queryCost{}}
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		cost := measure.selections(operation.SelectionSet)
+		if cost.depth > graphqlMaxDepth {
+			return fmt.Errorf("query has a depth of %v, the maximum is %v", cost.depth, graphqlMaxDepth)
+		}
+		if cost.complexity > graphqlMaxComplexity {
+			return fmt.Errorf("query has a complexity of more than %v", graphqlMaxComplexity)
+		}
+	}
+	return nil
+}
+
+/* Checks that no fragment spreads itself, directly or through other fragments
+ * every fragment is only followed once, so the check takes linear time
+ * returns:	error with the name of a fragment of the cycle
+ */
+func checkFragmentCycles(fragments map[string]*ast.FragmentDefinition) error {
+
+	// fragments on the current path and fragments without cycles
+	onPath, checked := map[string]bool{}, map[string]bool{}
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		if onPath[name] {
+			return fmt.Errorf("fragment %v spreads itself", name)
+		}
+		if checked[name] {
+			return nil
+		}
+		onPath[name] = true
+		for _, spread := range fragmentSpreads(fragments[name].SelectionSet, nil) {
+			// unknown fragments are reported by the validation
+			if _, exists := fragments[spread]; exists {
+				if err := visit(spread); err != nil {
+					return err
+				}
+			}
+		}
+		delete(onPath, name)
+		checked[name] = true
+		return nil
+	}
+
+	for name := range fragments {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appends the names of the fragments that are spread in the selection set (also in its fields) to names
+func fragmentSpreads(selectionSet *ast.SelectionSet, names []string) []string {
+	if selectionSet == nil {
+		return names
+	}
+	for _, selection := range selectionSet.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			names = fragmentSpreads(selection.SelectionSet, names)
+		case *ast.InlineFragment:
+			names = fragmentSpreads(selection.SelectionSet, names)
+		case *ast.FragmentSpread:
+			names = append(names, selection.Name.Value)
+		}
+	}
+	return names
+}
+
+// depth and complexity of a selection set
+type queryCost struct {
+	depth      int
+	complexity int
+}
+
+/* Measures selection sets of a document without cycles (see checkFragmentCycles)
+ * every fragment is measured once, the complexity stops counting above graphqlMaxComplexity
+ */
+type queryMeasure struct {
+	fragments map[string]*ast.FragmentDefinition
+	// costs of the fragments that were measured already
+	measured map[string]queryCost
+}
+
+/* Measures the depth and complexity of a selection set
+ * returns:	depth and complexity of the selections, the complexity is at most graphqlMaxComplexity+1
+ */
+func (measure *queryMeasure) selections(selectionSet *ast.SelectionSet) queryCost {
+
+	total := queryCost{}
+	if selectionSet == nil {
+		return total
+	}
+
+	for _, selection := range selectionSet.Selections {
+
+		cost := queryCost{}
+		switch selection := selection.(type) {
+		case *ast.Field:
+			cost = measure.selections(selection.SelectionSet)
+			if graphqlListFields[selection.Name.Value] {
+				cost.complexity *= graphqlListFactor
+			}
+			cost.depth, cost.complexity = cost.depth+1, cost.complexity+1
+		case *ast.InlineFragment:
+			cost = measure.selections(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			cost = measure.fragment(selection.Name.Value)
+		}
+
+		if cost.depth > total.depth {
+			total.depth = cost.depth
+		}
+		total.complexity += cost.complexity
+
+		// the query is rejected anyway, the other selections do not have to be measured
+		if total.complexity > graphqlMaxComplexity {
+			total.complexity = graphqlMaxComplexity + 1
+			return total
+		}
+	}
+	return total
+}
+
+// measures a fragment once, spreads of unknown fragments cost nothing (they are reported by the validation)
+func (measure *queryMeasure) fragment(name string) queryCost {
+	if cost, found := measure.measured[name]; found {
+		return cost
+	}
+	fragment, exists := measure.fragments[name]
+	if !exists {
+		return queryCost{}
+	}
+	cost := measure.selections(fragment.SelectionSet)
+	measure.measured[name] = cost
+	return cost
+}
+
+// returns the todos of the list that match the arguments
+func resolveTodos(p graphql.ResolveParams) (interface{}, error) {
+
+	todoList := p.Source.(*stores.TodoList)
+
+	var category []string
+	if values, ok := p.Args["category"].([]interface{}); ok {
+		for _, value := range values {
+			category = append(category, value.(string))
+		}
+	}
+	var done *bool
+	if value, ok := p.Args["done"].(bool); ok {
+		done = &value
+	}
+	query, _ := p.Args["query"].(string)
+
+	return todoList.FilterTodos(stores.NewFilter(category, done, query)), nil
+}
+
+// returns the todo with the id or null
+func resolveTodo(p graphql.ResolveParams) (interface{}, error) {
+	foundTodo := p.Source.(*stores.TodoList).GetTodoById(p.Args["id"].(int))
+	if foundTodo == nil {
+		return nil, nil
+	}
+	return *foundTodo, nil
+}
+
+func resolveCategories(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source.(*stores.TodoList).GetCategories(), nil
+}
+
+func resolveStats(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source.(*stores.TodoList).GetStats(), nil
+}
+
+func resolveSearches(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source.(*stores.TodoList).GetSearches(), nil
+}
+
+/* Converts a map of the stats into a list sorted by key
+ * field:	json name of the map field of the stats
+ * key:		name of the field the key of the map is stored in
+ */
+func resolveStatsMap(field string, key string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+
+		// the stats are sent as json by the REST api, use the same representation
+		encoded, _ := json.Marshal(p.Source)
+		stats := map[string]map[string]map[string]interface{}{}
+		json.Unmarshal(encoded, &stats)
+
+		entries := []map[string]interface{}{}
+		for name, entry := range stats[field] {
+			entry[key] = name
+			entries = append(entries, entry)
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i][key].(string) < entries[j][key].(string)
+		})
+		return entries, nil
+	}
+}
+
+/* Returns the id of the list, null for every role but owner
+ * the id opens lists without owner, so share links and lower roles must not see it
+ */
+func resolveListId(p graphql.ResolveParams) (interface{}, error) {
+	if !stores.HasRole(roleFromRequest(fromContext(p.Context).request), stores.RoleOwner) {
+		return nil, nil
+	}
+	return fromContext(p.Context).todoList.Id, nil
+}
+
+/* Checks the role of the user for a mutation, like the ROLE middleware of the REST routes
+ * returns:	error (forbidden) if the role of the user on the list is too low
+ */
+func checkMutationRole(p graphql.ResolveParams, required string) error {
+	if !stores.HasRole(roleFromRequest(fromContext(p.Context).request), required) {
+		return resolverError(p.Context, fmt.Errorf("%w: the %v role is required", errForbidden, required))
+	}
+	return nil
+}
+
+// creates a todo from the input like POST /todo
+func resolveAddTodo(p graphql.ResolveParams) (interface{}, error) {
+
+	todoList := fromContext(p.Context).todoList
+
+	if err := checkMutationRole(p, stores.RoleEditor); err != nil {
+		return nil, err
+	}
+
+	// the input is validated like a request body
+	input, _ := json.Marshal(p.Args["input"])
+	newTodo, err := stores.NewTodoFromBytes(input)
+	if err != nil {
+		return nil, resolverError(p.Context, decodeError(err))
+	}
+
+	addedTodo, err := todoList.AddTodo(*newTodo)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	log.Printf("GraphQL addTodo %v", addedTodo.Id)
+	return *addedTodo, nil
+}
+
+// changes the fields of the input like PATCH /todo/{id} with a merge patch
+func resolveUpdateTodo(p graphql.ResolveParams) (interface{}, error) {
+
+	todoList := fromContext(p.Context).todoList
+
+	if err := checkMutationTarget(p); err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+	oldTodo := todoList.GetTodoById(p.Args["id"].(int))
+
+	input, _ := json.Marshal(p.Args["input"])
+	patchedTodo, _, err := stores.PatchTodoFromBytes(input, stores.MergePatchContentType, oldTodo)
+	if err != nil {
+		return nil, resolverError(p.Context, decodeError(err))
+	}
+
+	// a completer can only mark the todo as done or not done
+	if err := checkMutationRole(p, stores.RoleCompleter); err != nil {
+		return nil, err
+	}
+	if err := checkCompleterUpdate(fromContext(p.Context).request, stores.OnlyDoneChanged(oldTodo, patchedTodo)); err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	updatedTodo, err := todoList.UpdateTodo(*patchedTodo)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	log.Printf("GraphQL updateTodo %v", updatedTodo.Id)
+	return *updatedTodo, nil
+}
+
+// removes a todo like DELETE /todo/{id}
+func resolveRemoveTodo(p graphql.ResolveParams) (interface{}, error) {
+
+	todoList := fromContext(p.Context).todoList
+
+	if err := checkMutationRole(p, stores.RoleEditor); err != nil {
+		return nil, err
+	}
+
+	if err := checkMutationTarget(p); err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	removedTodo, err := todoList.RemoveTodo(p.Args["id"].(int))
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	log.Printf("GraphQL removeTodo %v", removedTodo.Id)
+	return *removedTodo, nil
+}
+
+// moves a todo up or down like upOrDown in PUT /todo/{id}
+func resolveMoveTodo(p graphql.ResolveParams) (interface{}, error) {
+
+	todoList := fromContext(p.Context).todoList
+
+	if err := checkMutationRole(p, stores.RoleEditor); err != nil {
+		return nil, err
+	}
+
+	movedTodo, err := todoList.MoveTodo(p.Args["id"].(int), p.Args["up"].(bool))
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	log.Printf("GraphQL moveTodo %v", movedTodo.Id)
+	return *movedTodo, nil
+}
+
+/* Checks the todo a mutation changes
+ * error:	ErrNotFound if the todo does not exist, ErrConflict if the version argument does not match
+ */
+func checkMutationTarget(p graphql.ResolveParams) error {
+
+	todoId := p.Args["id"].(int)
+	existingTodo := fromContext(p.Context).todoList.GetTodoById(todoId)
+	if existingTodo == nil {
+		return fmt.Errorf("%w: todo with id %v", stores.ErrNotFound, todoId)
+	}
+
+	// optional version check, like the If-Match header of the REST api
+	if version, ok := p.Args["version"].(int); ok && version != existingTodo.Version {
+		return fmt.Errorf("%w: todo with id %v was changed (version %v)", stores.ErrConflict, todoId, existingTodo.Version)
+	}
+	return nil
+}
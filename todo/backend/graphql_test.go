@@ -0,0 +1,73 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckQueryLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"small query", `{ list { todos { name done } } }`, ""},
+		{"maximum depth", `{ a { b { c { d { e { f } } } } } }`, ""},
+		{"too deep", `{ a { b { c { d { e { f { g } } } } } } }`, "query has a depth of 7, the maximum is 6"},
+		{"too deep in a fragment", `{ a { b { ...F } } } fragment F on Todo { c { d { e { f { g } } } } }`, "query has a depth of 7, the maximum is 6"},
+		{"maximum complexity", `{ todos { ` + strings.Repeat("name ", 49) + `} }`, ""},
+		{"too complex", `{ todos { ` + strings.Repeat("name ", 50) + `} }`, "query has a complexity of more than 500"},
+		{"fragments are counted every time they are spread", `{ todos { ...F ...F } } fragment F on Todo { ` + strings.Repeat("name ", 25) + `}`, "query has a complexity of more than 500"},
+		{"fragment spreads itself", `{ list { ...F } } fragment F on List { ...F }`, "fragment F spreads itself"},
+		{"fragment spreads itself in a field", `{ list { ...F } } fragment F on List { todos { ...F } }`, "fragment F spreads itself"},
+		{"unused fragment spreads itself", `{ list { id } } fragment F on List { ...F }`, "fragment F spreads itself"},
+		{"unknown fragment", `{ list { ...Unknown } }`, ""},
+		{"syntax error", `{ list {`, ""},
+	}
+
+	for _, test := range tests {
+		err := checkQueryLimits(test.query)
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%v: got %v", test.name, err)
+		case test.want != "" && (err == nil || err.Error() != test.want):
+			t.Errorf("%v: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+// cycles through several fragments are found, whichever fragment of the cycle is reported
+func TestCheckQueryLimitsFragmentCycle(t *testing.T) {
+	query := `{ list { ...A } } fragment A on List { ...B } fragment B on List { todos { ...C } } fragment C on List { ...A }`
+	if err := checkQueryLimits(query); err == nil || !strings.HasSuffix(err.Error(), "spreads itself") {
+		t.Errorf("got %v", err)
+	}
+}
+
+// every fragment spreads the next one twice, measuring every spread again would take 2^levels steps
+func TestCheckQueryLimitsChainedFragments(t *testing.T) {
+	for _, levels := range []int{2, 24, 200} {
+		var query strings.Builder
+		query.WriteString(`{ list { ...F0 } }`)
+		for level := 0; level < levels; level++ {
+			fmt.Fprintf(&query, ` fragment F%v on Todo { ...F%v ...F%v }`, level, level+1, level+1)
+		}
+		fmt.Fprintf(&query, ` fragment F%v on Todo { name }`, levels)
+
+		start := time.Now()
+		err := checkQueryLimits(query.String())
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%v levels: the check took %v", levels, elapsed)
+		}
+
+		// 2 levels spread the name 4 times
+		if levels == 2 && err != nil {
+			t.Errorf("%v levels: got %v", levels, err)
+		}
+		if levels > 2 && (err == nil || err.Error() != "query has a complexity of more than 500") {
+			t.Errorf("%v levels: got %v, want the complexity error", levels, err)
+		}
+	}
+}
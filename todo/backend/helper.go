@@ -1,11 +1,13 @@
 package backend
 
 import (
-	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+
+	"klaemsch.io/todo/stores"
 )
 
 /* Uses a request object to retrieve the id parameter of the request url
@@ -19,7 +21,7 @@ func getIdFromUrl(r *http.Request) (int, error) {
 	// use url package to get params from query/url
 	params, err := url.ParseQuery(r.URL.RawQuery)
 	if err != nil {
-		err = errors.New("error while parsing url query")
+		err = fmt.Errorf("%w: error while parsing url query", errBadRequest)
 		return -1, err
 	}
 
@@ -28,7 +30,7 @@ func getIdFromUrl(r *http.Request) (int, error) {
 
 	// no value for id in the url parameters -> create error and return
 	if idString == "" {
-		err = errors.New("no ID found in the URL")
+		err = fmt.Errorf("%w: no ID found in the URL", errBadRequest)
 		return -1, err
 	}
 
@@ -37,15 +39,92 @@ func getIdFromUrl(r *http.Request) (int, error) {
 
 	// atoi throws error if value for id was not a number -> create error and return
 	if err != nil {
-		err = errors.New("value for id was not a number")
+		err = fmt.Errorf("%w: value for id was not a number", errBadRequest)
 		return -1, err
 	}
 
 	return idValue, nil
 }
 
+/* Uses the path parameter {id} of the request to retrieve the id of a todo
+ * is used by the resource-style routes like /api/todo/{id}
+ * r: request
+ * if id found: returns retrieved id and nil-error
+ * if id not found: returns -1 as id and error
+ */
+func getIdFromPath(r *http.Request) (int, error) {
+
+	// try to extract the id path parameter (as a string)
+	idString := r.PathValue("id")
+
+	// no value for id in the path -> create error and return
+	if idString == "" {
+		err := fmt.Errorf("%w: no ID found in the URL path", errBadRequest)
+		return -1, err
+	}
+
+	// convert idString into an integer
+	idValue, err := strconv.Atoi(idString)
+
+	// atoi throws error if value for id was not a number -> create error and return
+	if err != nil {
+		err = fmt.Errorf("%w: value for id was not a number", errBadRequest)
+		return -1, err
+	}
+
+	return idValue, nil
+}
+
+/* Uses a numeric path parameter of the request, e.g. {deliveryId} of /webhooks/{id}/deliveries/{deliveryId}
+ * r:		request
+ * name:	name of the path parameter
+ * if found: returns the number and nil-error
+ * if not found or not a number: returns -1 and error
+ */
+func getNumberFromPath(r *http.Request, name string) (int, error) {
+
+	value, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		err = fmt.Errorf("%w: value for %v was not a number", errBadRequest, name)
+		return -1, err
+	}
+	return value, nil
+}
+
+/* Retrieves the id of a todo from the path parameter {id} or the deprecated ?id= url parameter
+ * requests using the url parameter get deprecation headers pointing to the path route
+ * w: response writer, used for the deprecation headers
+ * r: request
+ * if id found: returns retrieved id and nil-error
+ * if id not found: returns -1 as id and error
+ */
+func getTodoId(w http.ResponseWriter, r *http.Request) (int, error) {
+
+	// resource-style route -> id is part of the path
+	if r.PathValue("id") != "" {
+		return getIdFromPath(r)
+	}
+
+	// deprecated query-string route -> id is an url parameter
+	idValue, err := getIdFromUrl(r)
+	if err == nil {
+		setDeprecationHeaders(w, apiPath(r, "/todo/%v", idValue))
+	}
+	return idValue, err
+}
+
+/* Marks the response of a deprecated route
+ * w:			response writer
+ * successor:	path of the route that replaces the deprecated one
+ */
+func setDeprecationHeaders(w http.ResponseWriter, successor string) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", fmt.Sprintf("<%v>; rel=\"successor-version\"", successor))
+}
+
 /* In this app, the listId is used as an authorization token
  * this token has to be send as an Autorization Bearer Header with the request to access the todo data
+ * logged in users send the token of their session instead (64 chars) and name the list separately (see resolveTodoList)
  *
  * Extracts the Authorization Header from the request and validates the format of the token / listId
  * IMPORTANT: does only validate that the token has the correct format, not if the token is known
@@ -61,14 +140,49 @@ func GetTokenFromRequest(r *http.Request) (string, error) {
 
 	// the splitted version should have length 2, if not return error
 	if len(splittedAuthHeader) != 2 {
-		err := errors.New("incorrect authorization method")
+		err := fmt.Errorf("%w: incorrect authorization method", errForbidden)
 		return "", err
 	}
 
-	// the token should contain 32 chars, if not return error
+	// the token should contain 32 chars (list), 40 chars (access token), 48 chars (share link), 64 chars (session)
+	// or be a signed JWT, if not return error
 	token := splittedAuthHeader[1]
-	if len(token) != 32 {
-		err := errors.New("incorrect authorization method")
+	if !validToken(token) {
+		err := fmt.Errorf("%w: incorrect authorization method", errForbidden)
+		return "", err
+	}
+
+	return token, nil
+}
+
+// checks the format of a list token (32 chars), access token (40 chars), share token (48 chars), session token (64 chars) or JWT
+// the signature and the claims of a JWT are checked when the list is resolved
+func validToken(token string) bool {
+	if stores.IsJWT(token) {
+		return true
+	}
+	switch len(token) {
+	case 32, stores.AccessTokenLength, stores.ShareTokenLength, stores.SessionTokenLength:
+		return true
+	}
+	return false
+}
+
+/* Extracts the token of a streaming request
+ * the access_token url parameter is used if it is set, otherwise the Authorization Header
+ * if token found and format-valid:			returns token and nil-error
+ * if token not found or format-invalid:	returns empty string and error
+ */
+func getStreamToken(r *http.Request) (string, error) {
+
+	if !r.URL.Query().Has("access_token") {
+		return GetTokenFromRequest(r)
+	}
+
+	// the token should have the same length as in the Authorization Header
+	token := r.URL.Query().Get("access_token")
+	if !validToken(token) {
+		err := fmt.Errorf("%w: incorrect authorization method", errForbidden)
 		return "", err
 	}
 
@@ -0,0 +1,181 @@
+package backend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * Idempotency keys (Idempotency-Key header) for requests that create todos
+ * clients on flaky networks send the same key with every retry of a request,
+ * the first response is stored per list, credential and key and sent again for every retry with the same body
+ * a key that is reused with a different body is rejected (422)
+ */
+
+const (
+	// time the response of a key is stored
+	idempotencyRetention = 24 * time.Hour
+	// maximum length of a key
+	maxIdempotencyKeyLength = 255
+)
+
+// response that was sent for a key
+type idempotentResponse struct {
+	bodyHash [32]byte
+	status   int
+	header   http.Header
+	body     []byte
+	created  time.Time
+}
+
+// stored responses by list, credential and key, requests of one list are already serialized by the AUTH middleware,
+// the mutex protects the map against requests of different lists
+var (
+	idempotentResponses      = map[string]idempotentResponse{}
+	idempotentResponsesMutex sync.Mutex
+	// time the expired responses were removed the last time
+	lastIdempotencySweep time.Time
+)
+
+// records the response of a handler, so it can be stored and sent again
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (recorder *responseRecorder) Header() http.Header {
+	return recorder.header
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	if recorder.status == 0 {
+		recorder.status = status
+	}
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	recorder.WriteHeader(http.StatusOK)
+	return recorder.body.Write(data)
+}
+
+/* Middleware for handlers that create todos (use inside of AUTH)
+ * requests without Idempotency-Key header are handled as usual
+ * if the key is new -> the request is handled and the response is stored (except server errors, they can be retried)
+ * if the key is known and the body is the same -> the stored response is sent again (Idempotent-Replayed: true)
+ * if the key is known and the body differs -> 422 Unprocessable Entity
+ */
+func IDEMPOTENT(next MyHandlerFunc) MyHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r, todoList)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, r, fmt.Errorf("%w: Idempotency-Key must not be longer than %v characters", errBadRequest, maxIdempotencyKeyLength))
+			return
+		}
+
+		// read the body to compare it with the body of the first request, the handler reads it again
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, stores.Rules.MaxBodyBytes+1))
+			if err != nil {
+				writeError(w, r, fmt.Errorf("%w: body could not be read", errBadRequest))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		bodyHash := sha256.Sum256(body)
+
+		// keys of different lists and of different credentials of a list do not collide
+		storeKey := todoList.Id + " " + idempotencyScope(r) + " " + key
+		stored, found := lookupIdempotentResponse(storeKey)
+
+		if found && stored.bodyHash != bodyHash {
+			log.Printf("Idempotency-Key %q was reused with a different body", key)
+			writeError(w, r, fmt.Errorf("%w: Idempotency-Key was already used for a different request", errIdempotencyKeyReused))
+			return
+		}
+
+		if found {
+			for name, values := range stored.header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.status)
+			w.Write(stored.body)
+			log.Printf("%v %v (%v, replayed Idempotency-Key)", r.Method, r.URL.Path, stored.status)
+			return
+		}
+
+		// handle the request and record the response
+		recorder := &responseRecorder{header: http.Header{}}
+		next(recorder, r, todoList)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		if recorder.status < 500 {
+			idempotentResponsesMutex.Lock()
+			idempotentResponses[storeKey] = idempotentResponse{bodyHash, recorder.status, recorder.header.Clone(), recorder.body.Bytes(), time.Now()}
+			idempotentResponsesMutex.Unlock()
+		}
+
+		for name, values := range recorder.header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(recorder.status)
+		w.Write(recorder.body.Bytes())
+	}
+}
+
+/* Returns the credential a key belongs to, clients of the same list must not get the responses of each other
+ * access tokens, list tokens and sessions are named by their credential, JWTs of users by their user,
+ * share links and JWTs of list credentials by the hash of the token
+ */
+func idempotencyScope(r *http.Request) string {
+	if credential := credentialFromRequest(r); credential != "" {
+		return credential
+	}
+	if user := userFromRequest(r); user != nil {
+		return fmt.Sprintf("%v:%v", stores.CredentialUser, user.Id)
+	}
+	token, _ := GetTokenFromRequest(r)
+	return fmt.Sprintf("token:%x", sha256.Sum256([]byte(token)))
+}
+
+/* Returns the stored response of a key
+ * responses that are older than the retention window are not returned and removed once a minute
+ */
+func lookupIdempotentResponse(storeKey string) (idempotentResponse, bool) {
+	idempotentResponsesMutex.Lock()
+	defer idempotentResponsesMutex.Unlock()
+
+	if time.Since(lastIdempotencySweep) > time.Minute {
+		for otherKey, response := range idempotentResponses {
+			if time.Since(response.created) > idempotencyRetention {
+				delete(idempotentResponses, otherKey)
+			}
+		}
+		lastIdempotencySweep = time.Now()
+	}
+
+	response, found := idempotentResponses[storeKey]
+	if found && time.Since(response.created) > idempotencyRetention {
+		return idempotentResponse{}, false
+	}
+	return response, found
+}
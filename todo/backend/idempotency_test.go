@@ -0,0 +1,159 @@
+package backend
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"klaemsch.io/todo/stores"
+)
+
+// sends POST /todo with the Idempotency-Key and returns the response with its body
+func postTodoWithKey(t *testing.T, serverUrl string, token string, key string, body string) (*http.Response, string) {
+	t.Helper()
+	request, _ := http.NewRequest("POST", serverUrl+"/api/v1/todo", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Idempotency-Key", key)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	responseBody, _ := io.ReadAll(response.Body)
+	return response, string(responseBody)
+}
+
+// returns the number of todos of the list
+func countTodos(t *testing.T, serverUrl string, token string) int {
+	t.Helper()
+	_, body := testRequest(t, serverUrl, "GET", "/todo", token, "")
+	todos := []interface{}{}
+	if err := json.Unmarshal([]byte(body), &todos); err != nil {
+		t.Fatalf("GET /todo: %v: %v", err, body)
+	}
+	return len(todos)
+}
+
+// returns a new list and its initial access token
+func newTestListToken(t *testing.T, serverUrl string) string {
+	t.Helper()
+	_, body := testRequest(t, serverUrl, "GET", "/list", "", "")
+	return strings.TrimSpace(body)
+}
+
+// a retry gets the status, the headers and the body of the first response, the todo is created once
+func TestIdempotentReplay(t *testing.T) {
+	server := newTestServer(t)
+	token := newTestListToken(t, server.URL)
+
+	first, firstBody := postTodoWithKey(t, server.URL, token, "retry", `{"name":"milk"}`)
+	if first.StatusCode != http.StatusCreated || first.Header.Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first request: got %v (replayed %q): %v", first.StatusCode, first.Header.Get("Idempotent-Replayed"), firstBody)
+	}
+
+	replay, replayBody := postTodoWithKey(t, server.URL, token, "retry", `{"name":"milk"}`)
+	if replay.StatusCode != first.StatusCode || replayBody != firstBody {
+		t.Errorf("replay: got %v %v, want %v %v", replay.StatusCode, replayBody, first.StatusCode, firstBody)
+	}
+	for _, header := range []string{"Location", "ETag", "Content-Type"} {
+		if replay.Header.Get(header) != first.Header.Get(header) {
+			t.Errorf("replay: got %v %q, want %q", header, replay.Header.Get(header), first.Header.Get(header))
+		}
+	}
+	if replay.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("replay: Idempotent-Replayed is %q", replay.Header.Get("Idempotent-Replayed"))
+	}
+	if count := countTodos(t, server.URL, token); count != 1 {
+		t.Errorf("got %v todos, want 1", count)
+	}
+
+	// the same key with another body is another request, not a retry
+	if reused, body := postTodoWithKey(t, server.URL, token, "retry", `{"name":"eggs"}`); reused.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("key with another body: got %v: %v", reused.StatusCode, body)
+	}
+	if count := countTodos(t, server.URL, token); count != 1 {
+		t.Errorf("got %v todos after the reused key, want 1", count)
+	}
+}
+
+// keys of one credential are not replayed for other credentials of the list or for other lists
+func TestIdempotencyKeyScope(t *testing.T) {
+	server := newTestServer(t)
+	token := newTestListToken(t, server.URL)
+	otherList := newTestListToken(t, server.URL)
+
+	_, body := testRequest(t, server.URL, "POST", "/tokens", token, `{"name":"phone"}`)
+	secondToken := struct{ Token string }{}
+	json.Unmarshal([]byte(body), &secondToken)
+	if len(secondToken.Token) != stores.AccessTokenLength {
+		t.Fatalf("POST /tokens: %v", body)
+	}
+
+	for _, other := range []string{token, secondToken.Token, otherList} {
+		response, body := postTodoWithKey(t, server.URL, other, "shared", `{"name":"milk"}`)
+		if response.StatusCode != http.StatusCreated || response.Header.Get("Idempotent-Replayed") != "" {
+			t.Errorf("got %v (replayed %q): %v", response.StatusCode, response.Header.Get("Idempotent-Replayed"), body)
+		}
+	}
+	if count := countTodos(t, server.URL, token); count != 2 {
+		t.Errorf("got %v todos of both credentials, want 2", count)
+	}
+}
+
+// sends a request with the key to the middleware and returns the response
+func idempotentRequest(handler MyHandlerFunc, todoList *stores.TodoList, key string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("POST", "/todo", strings.NewReader(`{"name":"milk"}`))
+	request = withAccess(request, stores.RoleOwner, "access:1")
+	request.Header.Set("Idempotency-Key", key)
+	recorder := httptest.NewRecorder()
+	IDEMPOTENT(handler)(recorder, request, todoList)
+	return recorder
+}
+
+// server errors are not stored, the retry is handled again; stored responses expire after the retention
+func TestIdempotentRetries(t *testing.T) {
+	listId, _, err := stores.NewTodoList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	todoList := stores.GetTodoListById(listId)
+
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	if response := idempotentRequest(handler, todoList, "failing"); response.Code != http.StatusServiceUnavailable {
+		t.Fatalf("first request: got %v", response.Code)
+	}
+	if response := idempotentRequest(handler, todoList, "failing"); response.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("retry after a server error: got %v after %v calls", response.Code, calls)
+	}
+	if response := idempotentRequest(handler, todoList, "failing"); response.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("retry after the success: got %v after %v calls", response.Code, calls)
+	}
+
+	// the stored response is older than the retention
+	idempotentResponsesMutex.Lock()
+	for storeKey, response := range idempotentResponses {
+		if strings.HasPrefix(storeKey, listId+" ") {
+			response.created = time.Now().Add(-idempotencyRetention - time.Minute)
+			idempotentResponses[storeKey] = response
+		}
+	}
+	idempotentResponsesMutex.Unlock()
+
+	response := idempotentRequest(handler, todoList, "failing")
+	if response.Code != http.StatusCreated || calls != 3 || response.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry after the retention: got %v after %v calls", response.Code, calls)
+	}
+}
@@ -0,0 +1,127 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * Signed access tokens (JWT)
+ * a list token, an access token or the session of a member is exchanged for a short-lived signed token (POST /auth/token)
+ * and a refresh token; the signed token is sent as bearer token and checked without a lookup of the credential,
+ * gateways verify it with the public keys of /jwks.json (EdDSA) or the shared secret (HS256);
+ * refresh tokens are used once, a reused refresh token revokes the whole login
+ */
+
+// returns the credential of the request that can be exchanged for a signed token, "" for share links and JWTs
+func credentialFromRequest(r *http.Request) string {
+	credential, _ := r.Context().Value(credentialKey{}).(string)
+	return credential
+}
+
+// sends issued tokens back, they must not be cached (RFC 6749)
+func writeTokens(w http.ResponseWriter, tokens interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+/*
+ * Exchanges the bearer token of the request for a signed access token and a refresh token of the list
+ * the signed token has the role of the bearer token, share links and signed tokens can not be exchanged
+ */
+func PostToken(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// share links would lose their expiry and their limit of uses
+	credential := credentialFromRequest(r)
+	if credential == "" {
+		writeError(w, r, fmt.Errorf("%w: share links and signed tokens can not be exchanged", errForbidden))
+		return
+	}
+
+	tokens, err := todoList.IssueTokens(credential, roleFromRequest(r))
+
+	if err != nil {
+		log.Printf("Tokens could not be issued: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	writeTokens(w, tokens)
+	log.Printf("POST /auth/token (200 OK, %v)", tokens.Role)
+}
+
+/*
+ * Exchanges the refresh token of the request body for a new signed access token and a new refresh token
+ * the old refresh token can not be used again
+ */
+func PostRefresh(w http.ResponseWriter, r *http.Request) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode refresh token from request body
+	request, err := stores.RefreshRequestFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	tokens, err := stores.RefreshTokens(request)
+
+	if err != nil {
+		log.Printf("Tokens could not be refreshed: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	writeTokens(w, tokens)
+	log.Printf("POST /auth/refresh (200 OK, %v)", tokens.Role)
+}
+
+/*
+ * Revokes the refresh token of the request body and all refresh tokens of its login (logout)
+ * unknown refresh tokens are accepted as well, signed access tokens stay valid until they expire
+ */
+func PostRevoke(w http.ResponseWriter, r *http.Request) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode refresh token from request body
+	request, err := stores.RefreshRequestFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	stores.RevokeRefreshToken(request)
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Println("POST /auth/revoke (204 No Content)")
+}
+
+/*
+ * Returns the public keys that verify the signed access tokens (JSON Web Key Set)
+ */
+func GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	json.NewEncoder(w).Encode(stores.JWKS())
+	log.Println("GET /jwks.json (200 OK)")
+}
@@ -0,0 +1,224 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * Lists of a user
+ * a logged in user can have many named lists, GET /lists returns them in the order of the user
+ * with the number of their todos; a single list is renamed, described, colored or archived
+ * with PATCH /lists/{listId} and deleted with all of its todos with DELETE /lists/{listId}
+ */
+
+/*
+ * Returns all lists of the logged in user in the order of the user, with the number of their todos
+ * ?archived=true|false only returns the archived / not archived lists
+ */
+func GetLists(w http.ResponseWriter, r *http.Request, user *stores.User) {
+
+	// optional filter for archived lists
+	archivedValue := r.URL.Query().Get("archived")
+	var archived bool
+	if archivedValue != "" {
+		var err error
+		archived, err = strconv.ParseBool(archivedValue)
+		if err != nil {
+			log.Printf("invalid archived parameter %q", archivedValue)
+			writeError(w, r, fmt.Errorf("%w: archived has to be true or false", errBadRequest))
+			return
+		}
+	}
+
+	summaries := listSummaries(user, func(list *stores.TodoList) bool {
+		return archivedValue == "" || list.Archived == archived
+	})
+
+	json.NewEncoder(w).Encode(summaries)
+	log.Printf("GET /lists (200 OK, %v)", user.Username)
+}
+
+/* Returns the overviews of the lists of a user in the order of the user
+ * keep:	decides which lists are returned, is called while the list is locked
+ */
+func listSummaries(user *stores.User, keep func(todoList *stores.TodoList) bool) []interface{} {
+	summaries := []interface{}{}
+	for _, todoList := range stores.GetTodoListsOfUser(user.Id) {
+		todoList.Lock()
+		if keep(todoList) {
+			summaries = append(summaries, todoList.Summary())
+		}
+		todoList.Unlock()
+	}
+	return summaries
+}
+
+/*
+ * Uses the request body (name, description, color) to create a new list of the logged in user
+ * the list is added at the end of the lists of the user
+ * returns the created list
+ */
+func PostList(w http.ResponseWriter, r *http.Request, user *stores.User) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode and validate the metadata from request body
+	metadata, err := stores.ListMetadataFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	// create the list, a user can only have a limited number of lists
+	newTodoList, err := stores.NewNamedTodoList(user.Id, metadata)
+
+	if err != nil {
+		log.Printf("List could not be created: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	newTodoList.Lock()
+	summary := newTodoList.Summary()
+	newTodoList.Unlock()
+
+	// send created list back
+	w.Header().Set("Location", apiPath(r, "/lists/%v", summary.Id))
+	setETag(w, summary.Version)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(summary)
+	log.Printf("POST /lists (201 Created, %v)", user.Username)
+}
+
+/*
+ * Orders the lists of the logged in user, the body contains the ids of all lists in the new order
+ * returns the lists in the new order
+ */
+func PutListOrder(w http.ResponseWriter, r *http.Request, user *stores.User) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode the ids of the lists from request body
+	order, err := stores.ListOrderFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	// the order has to contain every list of the user exactly once
+	if err := stores.ReorderTodoLists(user.Id, order); err != nil {
+		log.Printf("Lists could not be ordered: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// send all lists back in the new order
+	json.NewEncoder(w).Encode(listSummaries(user, func(*stores.TodoList) bool { return true }))
+	log.Printf("PUT /lists/order (200 OK, %v)", user.Username)
+}
+
+/*
+ * Checks that the list in the url path (/lists/{listId}) is the list of the request
+ * writes 404 Not Found if the token does not grant access to the list in the path
+ */
+func listInPath(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) bool {
+	if r.PathValue("listId") != todoList.Id {
+		log.Println("todo list in path does not match the token")
+		writeError(w, r, fmt.Errorf("%w: todo list", stores.ErrNotFound))
+		return false
+	}
+	return true
+}
+
+/*
+ * Returns the list with the id given in the url path with the number of its todos
+ */
+func GetList(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	if !listInPath(w, r, todoList) {
+		return
+	}
+
+	summary := todoList.Summary()
+	setETag(w, summary.Version)
+	json.NewEncoder(w).Encode(summary)
+	log.Printf("GET /lists/%v (200 OK)", todoList.Id)
+}
+
+/*
+ * Renames, describes, colors or archives the list with the id given in the url path
+ * the body is a merge patch, only the sent fields are changed
+ * returns the changed list
+ */
+func PatchList(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	if !listInPath(w, r, todoList) {
+		return
+	}
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// apply the patch to the current metadata of the list
+	metadata, err := stores.PatchListFromJson(r, todoList)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	todoList.SetMetadata(metadata)
+
+	summary := todoList.Summary()
+	setETag(w, summary.Version)
+	json.NewEncoder(w).Encode(summary)
+	log.Printf("PATCH /lists/%v (200 OK)", todoList.Id)
+}
+
+/*
+ * Deletes the list with the id given in the url path with all of its todos
+ * clients that watch the list are disconnected
+ * returns the deleted list
+ */
+func DeleteList(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	if !listInPath(w, r, todoList) {
+		return
+	}
+
+	summary := todoList.Summary()
+
+	if err := stores.RemoveTodoList(todoList); err != nil {
+		log.Printf("List %v could not be deleted: %v", todoList.Id, err)
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(summary)
+	log.Printf("DELETE /lists/%v (200 OK)", todoList.Id)
+}
@@ -0,0 +1,107 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// a list of the list summaries of a response
+type testLists []struct {
+	Id       string
+	Name     string
+	Position int
+	Archived bool
+}
+
+// returns the ids of the lists
+func (lists testLists) ids() []string {
+	ids := []string{}
+	for _, list := range lists {
+		ids = append(ids, list.Id)
+	}
+	return ids
+}
+
+// ?archived= filters the lists of the user, any other value than true or false is rejected
+func TestGetListsArchived(t *testing.T) {
+	server := newTestServer(t)
+	session := newTestSession(t, server.URL, "archive-user")
+
+	_, body := testRequest(t, server.URL, "POST", "/lists", session, `{"name":"archived"}`)
+	archived := struct{ Id string }{}
+	json.Unmarshal([]byte(body), &archived)
+	_, body = testRequest(t, server.URL, "POST", "/lists", session, `{"name":"active"}`)
+	active := struct{ Id string }{}
+	json.Unmarshal([]byte(body), &active)
+
+	if status, body := testRequest(t, server.URL, "PATCH", "/lists/"+archived.Id, session, `{"archived":true}`); status != http.StatusOK {
+		t.Fatalf("PATCH /lists/%v: got %v: %v", archived.Id, status, body)
+	}
+
+	tests := []struct {
+		query    string
+		archived bool
+		active   bool
+	}{
+		{"", true, true},
+		{"?archived=true", true, false},
+		{"?archived=false", false, true},
+	}
+	for _, test := range tests {
+		status, body := testRequest(t, server.URL, "GET", "/lists"+test.query, session, "")
+		lists := testLists{}
+		json.Unmarshal([]byte(body), &lists)
+		found := map[string]bool{}
+		for _, list := range lists {
+			found[list.Id] = true
+			if test.query != "" && list.Archived != (test.query == "?archived=true") {
+				t.Errorf("GET /lists%v: got %+v", test.query, list)
+			}
+		}
+		if status != http.StatusOK || found[archived.Id] != test.archived || found[active.Id] != test.active {
+			t.Errorf("GET /lists%v: got %v with archived %v and active %v", test.query, status, found[archived.Id], found[active.Id])
+		}
+	}
+
+	if status, _ := testRequest(t, server.URL, "GET", "/lists?archived=maybe", session, ""); status != http.StatusBadRequest {
+		t.Errorf("GET /lists?archived=maybe: got %v, want 400", status)
+	}
+}
+
+// the order of the lists contains every list of the user once, the response has the new positions
+func TestPutListOrder(t *testing.T) {
+	server := newTestServer(t)
+	session := newTestSession(t, server.URL, "order-user")
+	testRequest(t, server.URL, "POST", "/lists", session, `{"name":"work"}`)
+	testRequest(t, server.URL, "POST", "/lists", session, `{"name":"home"}`)
+
+	_, body := testRequest(t, server.URL, "GET", "/lists", session, "")
+	lists := testLists{}
+	json.Unmarshal([]byte(body), &lists)
+	ids := lists.ids()
+
+	reversed := []string{}
+	for i := len(ids) - 1; i >= 0; i-- {
+		reversed = append(reversed, ids[i])
+	}
+	order, _ := json.Marshal(map[string][]string{"lists": reversed})
+
+	status, body := testRequest(t, server.URL, "PUT", "/lists/order", session, string(order))
+	ordered := testLists{}
+	json.Unmarshal([]byte(body), &ordered)
+	if status != http.StatusOK || len(ordered) != len(reversed) {
+		t.Fatalf("PUT /lists/order: got %v: %v", status, body)
+	}
+	for position, list := range ordered {
+		if list.Id != reversed[position] || list.Position != position {
+			t.Errorf("position %v: got %+v, want the list %v", position, list, reversed[position])
+		}
+	}
+
+	// the first list is missing
+	incomplete, _ := json.Marshal(map[string][]string{"lists": reversed[1:]})
+	if status, _ := testRequest(t, server.URL, "PUT", "/lists/order", session, string(incomplete)); status != http.StatusUnprocessableEntity {
+		t.Errorf("PUT /lists/order without a list: got %v, want 422", status)
+	}
+}
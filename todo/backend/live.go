@@ -0,0 +1,317 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * Live updates of a todo list over a WebSocket (GET /api/v1/events/ws) or Server-Sent Events (GET /api/v1/events)
+ * every change of the list (created, updated, deleted, moved) is sent to every connected client as json:
+ *
+ *	{"id": 12, "type": "updated", "todo": {...}, "listVersion": 34}
+ *
+ * the first message is {"type": "hello", "id": <last change the client has>, "listVersion": ...}
+ * a client that reconnects sends the id of the last change it received (?since=12) and gets the missed changes
+ * after the hello message; if they are not in the change log anymore, the first message is
+ * {"type": "reset", ...} and the client has to load the whole list again
+ * Server-Sent Events use the id of the change as event id and the type as event name,
+ * so EventSources resume with the Last-Event-ID header on their own
+ * the credential of the stream is checked again before every change and heartbeat; if the token or the share link
+ * was revoked, the session ended or the user was removed from the list, the last message is {"type": "revoked"}
+ * and the stream is closed
+ */
+
+const (
+	// the server pings the client in this interval, the client has to answer (pong) before the read timeout
+	heartbeatInterval = 30 * time.Second
+	heartbeatTimeout  = 60 * time.Second
+	// time a single message may take to be written
+	writeTimeout = 10 * time.Second
+	// time an EventSource waits before it reconnects
+	reconnectDelay = 2 * time.Second
+)
+
+// the token is sent with every connection and no cookies are used, so connections from every origin are allowed
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// first message of a stream
+type streamHello struct {
+	Type        string `json:"type"`
+	Id          int    `json:"id"`
+	ListVersion int    `json:"listVersion"`
+}
+
+/* Reads the sequence number of the last change the client received
+ * since:	value sent by the client, empty for a new client
+ * returns:	sequence number, -1 if the value is not a number (the client has to load the whole list again)
+ */
+func parseSince(since string) int {
+	sequence, err := strconv.Atoi(since)
+	if err != nil {
+		return -1
+	}
+	return sequence
+}
+
+/* Starts watching the list for a stream and collects the changes the client missed
+ * the client sends the id of the last change it received as Last-Event-ID header (EventSources) or ?since=,
+ * new clients start after the last change of the list
+ * returns:	missed changes, false if the client has to load the whole list again (hello is a reset then),
+ *			channel with the new changes, function that stops watching and the first message of the stream
+ */
+func openStream(r *http.Request, todoList *stores.TodoList) ([]stores.Change, bool, <-chan stores.Change, func(), streamHello) {
+
+	since := r.Header.Get("Last-Event-ID")
+	if since == "" {
+		since = r.URL.Query().Get("since")
+	}
+
+	// the change log and the watchers are read and changed while the list is locked,
+	// so no change is lost between the missed changes and the new changes
+	todoList.Lock()
+	hello := streamHello{Type: "hello", Id: todoList.LastChange(), ListVersion: todoList.Version}
+	if since == "" {
+		since = strconv.Itoa(hello.Id)
+	}
+	missed, resumed, changes, stop := todoList.WatchSince(parseSince(since))
+	todoList.Unlock()
+
+	// the id of hello is the change the client continues after, the missed changes follow it
+	if resumed {
+		hello.Id = parseSince(since)
+	} else {
+		hello.Type = "reset"
+	}
+
+	// the watchers are changed while the list is locked
+	stopLocked := func() {
+		todoList.Lock()
+		stop()
+		todoList.Unlock()
+	}
+	return missed, resumed, changes, stopLocked, hello
+}
+
+/* Checks that the credential that opened a stream still opens the list
+ * streams stay open for hours, revoked tokens and share links, ended sessions and removed members
+ * must not get the changes that follow; the check does not count as a use of the credential
+ * returns:	false if the stream has to be closed
+ */
+func streamAuthorized(r *http.Request, todoList *stores.TodoList) bool {
+
+	// the list was deleted
+	if stores.GetTodoListById(todoList.Id) != todoList {
+		return false
+	}
+
+	token, err := getStreamToken(r)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case stores.IsJWT(token):
+		// the token expired or the user of the token lost the access to the list
+		jwtList, _, err := resolveJWT(r, token)
+		return err == nil && jwtList == todoList
+	case len(token) == stores.ShareTokenLength:
+		shareList, _ := stores.ActiveShareLink(token)
+		return shareList == todoList
+	case len(token) == stores.AccessTokenLength:
+		return stores.ActiveAccessToken(token) == todoList
+	case len(token) != stores.SessionTokenLength:
+		return stores.GetTodoListByIdToken(token) == todoList
+	}
+
+	user := stores.GetUserOfSession(token)
+	if user == nil {
+		return false
+	}
+	todoList.Lock()
+	defer todoList.Unlock()
+	return todoList.RoleOf(user.Id) != ""
+}
+
+// last message of a stream whose credential was revoked
+var streamRevoked = map[string]string{"type": "revoked"}
+
+/*
+ * Upgrades the request to a WebSocket and sends every change of the list to the client
+ * the connection stays open until the client closes it or does not answer the heartbeat
+ */
+func GetEventsWebSocket(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// the upgrader sends an error response if the request is not a WebSocket handshake
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("GET /events/ws (upgrade failed): %v", err)
+		return
+	}
+	defer conn.Close()
+
+	missed, _, changes, stop, hello := openStream(r, todoList)
+	defer stop()
+
+	log.Printf("GET /events/ws (101 Switching Protocols, %v)", hello.Type)
+
+	// the reader handles pongs and notices when the client is gone, messages of the client are ignored
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(heartbeatTimeout))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(heartbeatTimeout))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(message interface{}) error {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return conn.WriteJSON(message)
+	}
+
+	// hello and the changes the client missed
+	if err := send(hello); err != nil {
+		return
+	}
+	for _, change := range missed {
+		if err := send(change); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			log.Println("GET /events/ws (closed by client)")
+			return
+		case <-heartbeat.C:
+			if !streamAuthorized(r, todoList) {
+				closeRevokedWebSocket(conn, send)
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case change, open := <-changes:
+			if !open {
+				// the client can reconnect with the id of the last change it received
+				message := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client fell behind, reconnect with since")
+				conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeTimeout))
+				return
+			}
+			if !streamAuthorized(r, todoList) {
+				closeRevokedWebSocket(conn, send)
+				return
+			}
+			if err := send(change); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sends the revoked message and closes the WebSocket, the client must not reconnect with the same credential
+func closeRevokedWebSocket(conn *websocket.Conn, send func(message interface{}) error) {
+	log.Println("GET /events/ws (closed, the credential was revoked)")
+	send(streamRevoked)
+	message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "the credential was revoked")
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeTimeout))
+}
+
+/*
+ * Sends every change of the list as Server-Sent Event (text/event-stream)
+ * a client that reconnects with the Last-Event-ID header (or ?since=) gets the changes it missed first
+ * the stream stays open until the client closes it
+ */
+func GetEvents(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	missed, _, changes, stop, hello := openStream(r, todoList)
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	controller := http.NewResponseController(w)
+	log.Printf("GET /events (200 OK, %v)", hello.Type)
+
+	send := func(id int, name string, data interface{}) error {
+		encoded, _ := json.Marshal(data)
+		if _, err := fmt.Fprintf(w, "id: %v\nevent: %v\ndata: %s\n\n", id, name, encoded); err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+
+	// time the EventSource waits before it reconnects, then hello and the changes the client missed
+	fmt.Fprintf(w, "retry: %v\n\n", reconnectDelay.Milliseconds())
+	if err := send(hello.Id, hello.Type, hello); err != nil {
+		return
+	}
+	for _, change := range missed {
+		if err := send(change.Id, change.Type, change); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Println("GET /events (closed by client)")
+			return
+		case <-heartbeat.C:
+			if !streamAuthorized(r, todoList) {
+				closeRevokedEvents(w, controller)
+				return
+			}
+			// comments keep proxies from closing the idle connection
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil || controller.Flush() != nil {
+				return
+			}
+		case change, open := <-changes:
+			if !open {
+				// the EventSource reconnects with the id of the last change it received
+				return
+			}
+			if !streamAuthorized(r, todoList) {
+				closeRevokedEvents(w, controller)
+				return
+			}
+			if err := send(change.Id, change.Type, change); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sends the revoked event without id, the EventSource gets 403 Forbidden when it reconnects and stops
+func closeRevokedEvents(w http.ResponseWriter, controller *http.ResponseController) {
+	log.Println("GET /events (closed, the credential was revoked)")
+	encoded, _ := json.Marshal(streamRevoked)
+	fmt.Fprintf(w, "event: revoked\ndata: %s\n\n", encoded)
+	controller.Flush()
+}
@@ -0,0 +1,248 @@
+package backend
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"klaemsch.io/todo/stores"
+)
+
+// event of a Server-Sent Events stream
+type testEvent struct {
+	id   string
+	name string
+	data string
+}
+
+/* Opens GET /events on the test server
+ * headers:	headers of the request, e.g. Last-Event-ID
+ * returns:	reader of the stream, it is closed at the end of the test
+ */
+func openTestEvents(t *testing.T, serverUrl string, path string, token string, headers map[string]string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	request, _ := http.NewRequestWithContext(ctx, "GET", serverUrl+"/api/v1"+path, nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		response.Body.Close()
+	})
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("GET %v: got %v", path, response.StatusCode)
+	}
+	return bufio.NewReader(response.Body)
+}
+
+// reads the next event of the stream, the retry field and heartbeats are skipped
+func nextEvent(t *testing.T, reader *bufio.Reader) testEvent {
+	t.Helper()
+	event := testEvent{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended before the next event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event.name != "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// returns the sequence number of the last change of the list
+func lastChange(listId string) int {
+	todoList := stores.GetTodoListById(listId)
+	todoList.Lock()
+	defer todoList.Unlock()
+	return todoList.LastChange()
+}
+
+// clients that reconnect with Last-Event-ID or ?since= get the changes they missed and then the new changes
+func TestEventsResume(t *testing.T) {
+	server := newTestServer(t)
+	token := newTestListToken(t, server.URL)
+	start := lastChange(testListId(t, server.URL, token))
+
+	for _, name := range []string{"milk", "eggs", "bread"} {
+		testRequest(t, server.URL, "POST", "/todo", token, `{"name":"`+name+`"}`)
+	}
+	last := start + 3
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		since   int
+	}{
+		{"Last-Event-ID", "/events", map[string]string{"Last-Event-ID": strconv.Itoa(start + 1)}, start + 1},
+		{"since", fmt.Sprintf("/events?since=%v", start+2), nil, start + 2},
+		{"Last-Event-ID before since", fmt.Sprintf("/events?since=%v", start), map[string]string{"Last-Event-ID": strconv.Itoa(start + 2)}, start + 2},
+		{"nothing missed", fmt.Sprintf("/events?since=%v", start+3), nil, start + 3},
+		{"new changes of the other streams", fmt.Sprintf("/events?since=%v", start+3), nil, start + 3},
+	}
+
+	for _, test := range tests {
+		stream := openTestEvents(t, server.URL, test.path, token, test.headers)
+		if hello := nextEvent(t, stream); hello.name != "hello" || hello.id != strconv.Itoa(test.since) {
+			t.Errorf("%v: got first event %+v, want hello %v", test.name, hello, test.since)
+			continue
+		}
+		for id := test.since + 1; id <= last; id++ {
+			if event := nextEvent(t, stream); event.name != "created" || event.id != strconv.Itoa(id) {
+				t.Errorf("%v: got missed event %+v, want created %v", test.name, event, id)
+			}
+		}
+
+		// the stream continues with the new changes
+		testRequest(t, server.URL, "POST", "/todo", token, `{"name":"`+test.name+`"}`)
+		last++
+		if event := nextEvent(t, stream); event.name != "created" || event.id != strconv.Itoa(last) || !strings.Contains(event.data, test.name) {
+			t.Errorf("%v: got new event %+v, want created %v", test.name, event, last)
+		}
+	}
+}
+
+// clients that missed more changes than the change log holds load the whole list again
+func TestEventsReset(t *testing.T) {
+	server := newTestServer(t)
+	token := newTestListToken(t, server.URL)
+	listId := testListId(t, server.URL, token)
+
+	// every move is one change
+	testRequest(t, server.URL, "POST", "/todo", token, `{"name":"milk"}`)
+	_, body := testRequest(t, server.URL, "POST", "/todo", token, `{"name":"eggs"}`)
+	created := struct{ Id int }{}
+	json.Unmarshal([]byte(body), &created)
+
+	todoList := stores.GetTodoListById(listId)
+	todoList.Lock()
+	for move := 0; move <= stores.ChangeLogSize; move++ {
+		if _, err := todoList.MoveTodo(created.Id, move%2 == 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := todoList.LastChange()
+	todoList.Unlock()
+
+	tests := []struct {
+		since string
+		want  string
+	}{
+		{strconv.Itoa(last - stores.ChangeLogSize), "hello"},
+		{strconv.Itoa(last - stores.ChangeLogSize - 1), "reset"},
+		{"0", "reset"},
+		{strconv.Itoa(last + 1), "reset"},
+		{"yesterday", "reset"},
+	}
+
+	for _, test := range tests {
+		stream := openTestEvents(t, server.URL, "/events?since="+test.since, token, nil)
+		first := nextEvent(t, stream)
+		if first.name != test.want {
+			t.Errorf("since %v: got %+v, want %v", test.since, first, test.want)
+		}
+		// after a reset the client continues after the last change
+		if test.want == "reset" && first.id != strconv.Itoa(last) {
+			t.Errorf("since %v: reset has id %v, want %v", test.since, first.id, last)
+		}
+		if test.want == "hello" {
+			if event := nextEvent(t, stream); event.name != "moved" || event.id != strconv.Itoa(last-stores.ChangeLogSize+1) {
+				t.Errorf("since %v: got first missed event %+v", test.since, event)
+			}
+		}
+	}
+}
+
+// streams end with a revoked event when their credential does not open the list anymore
+func TestEventsEndWhenRevoked(t *testing.T) {
+	server := newTestServer(t)
+	token := newTestListToken(t, server.URL)
+	owner := newTestSession(t, server.URL, "stream-owner")
+	member := newTestSession(t, server.URL, "stream-member")
+
+	_, body := testRequest(t, server.URL, "POST", "/lists", owner, `{"name":"streams"}`)
+	userList := struct{ Id string }{}
+	json.Unmarshal([]byte(body), &userList)
+	testRequest(t, server.URL, "PUT", "/lists/"+userList.Id+"/members/stream-member", owner, `{"role":"viewer"}`)
+
+	_, body = testRequest(t, server.URL, "POST", "/shares", token, `{"scope":"read"}`)
+	link := struct {
+		Id    int
+		Token string
+	}{}
+	json.Unmarshal([]byte(body), &link)
+
+	_, body = testRequest(t, server.URL, "POST", "/tokens", token, `{"name":"phone"}`)
+	device := struct {
+		Id    int
+		Token string
+	}{}
+	json.Unmarshal([]byte(body), &device)
+
+	tests := []struct {
+		name string
+		// path of the stream and of the change, token of the stream
+		path   string
+		stream string
+		// token that revokes the access and makes the change
+		owner  string
+		revoke string
+	}{
+		{"share link", "", link.Token, token, fmt.Sprintf("/shares/%v", link.Id)},
+		{"access token", "", device.Token, token, fmt.Sprintf("/tokens/%v", device.Id)},
+		{"member", "?list=" + userList.Id, member, owner, "/lists/" + userList.Id + "/members/stream-member"},
+	}
+
+	for _, test := range tests {
+		stream := openTestEvents(t, server.URL, "/events"+test.path, test.stream, nil)
+		ownerStream := openTestEvents(t, server.URL, "/events"+test.path, test.owner, nil)
+		nextEvent(t, stream)
+		nextEvent(t, ownerStream)
+
+		if status, body := testRequest(t, server.URL, "DELETE", test.revoke, test.owner, ""); status != http.StatusOK {
+			t.Fatalf("%v: DELETE %v: got %v: %v", test.name, test.revoke, status, body)
+		}
+		testRequest(t, server.URL, "POST", "/todo"+test.path, test.owner, `{"name":"secret"}`)
+
+		if event := nextEvent(t, stream); event.name != "revoked" {
+			t.Errorf("%v: got %+v, want revoked", test.name, event)
+		}
+		if _, err := io.ReadAll(stream); err != nil {
+			t.Errorf("%v: the stream was not closed: %v", test.name, err)
+		}
+		if event := nextEvent(t, ownerStream); event.name != "created" {
+			t.Errorf("%v: the owner got %+v", test.name, event)
+		}
+	}
+}
+
+// browsers send a preflight request before they open the WebSocket
+func TestEventsWebSocketPreflight(t *testing.T) {
+	server := newTestServer(t)
+	if status, _ := testRequest(t, server.URL, "OPTIONS", "/events/ws", "", ""); status != http.StatusNoContent {
+		t.Errorf("OPTIONS /events/ws: got %v", status)
+	}
+}
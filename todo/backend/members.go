@@ -0,0 +1,143 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * Sharing of lists
+ * the owner of a list shares it with other users by their username and a role:
+ * viewer (reads), completer (marks todos as done), editor (changes todos) or owner (changes the list);
+ * the routes that change something need a role (ROLE middleware), the handlers of PUT / PATCH /todo
+ * check that a completer only changes done
+ */
+
+/* Returns the role of the user on the list of the request
+ * requests with a list token have the owner role
+ */
+func roleFromRequest(r *http.Request) string {
+	role, _ := r.Context().Value(roleKey{}).(string)
+	return role
+}
+
+/* Checks that a user with the completer role only marks a todo as done or not done
+ * users with the editor role can change everything
+ * onlyDone:	true if the update does not change other fields and does not move the todo
+ * returns:		error (403 Forbidden) if a completer changes more
+ */
+func checkCompleterUpdate(r *http.Request, onlyDone bool) error {
+	if onlyDone || stores.HasRole(roleFromRequest(r), stores.RoleEditor) {
+		return nil
+	}
+	return fmt.Errorf("%w: the completer role can only mark todos as done or not done", errForbidden)
+}
+
+/*
+ * Returns every user with access to the list, the owner first
+ */
+func GetMembers(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	if !listInPath(w, r, todoList) {
+		return
+	}
+
+	json.NewEncoder(w).Encode(todoList.GetMembers())
+	log.Printf("GET /lists/%v/members (200 OK)", todoList.Id)
+}
+
+/*
+ * Shares the list with the user given in the url path (/lists/{listId}/members/{username})
+ * or changes the role of a member, the body contains the role
+ * returns the member (201 Created for an invitation)
+ */
+func PutMember(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	if !listInPath(w, r, todoList) {
+		return
+	}
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode the role from request body
+	request, err := stores.MemberFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	username := r.PathValue("username")
+	user := stores.GetUserByUsername(username)
+
+	if user == nil {
+		log.Printf("user %v not found", username)
+		writeError(w, r, fmt.Errorf("%w: user %v", stores.ErrNotFound, username))
+		return
+	}
+
+	newMember, invited, err := todoList.SetMember(user, request.Role)
+
+	if err != nil {
+		log.Printf("List could not be shared with %v: %v", username, err)
+		writeError(w, r, err)
+		return
+	}
+
+	// send the member back
+	if invited {
+		w.Header().Set("Location", apiPath(r, "/lists/%v/members/%v", todoList.Id, user.Username))
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(newMember)
+	log.Printf("PUT /lists/%v/members/%v (%v)", todoList.Id, user.Username, request.Role)
+}
+
+/*
+ * Revokes the access of the user given in the url path to the list
+ * owners remove every member, every member can leave the list
+ * returns the removed member
+ */
+func DeleteMember(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	if !listInPath(w, r, todoList) {
+		return
+	}
+
+	username := r.PathValue("username")
+	user := stores.GetUserByUsername(username)
+
+	if user == nil {
+		log.Printf("user %v not found", username)
+		writeError(w, r, fmt.Errorf("%w: user %v", stores.ErrNotFound, username))
+		return
+	}
+
+	// members without the owner role can only remove themselves
+	if current := userFromRequest(r); !stores.HasRole(roleFromRequest(r), stores.RoleOwner) && (current == nil || current.Id != user.Id) {
+		log.Printf("DELETE /lists/%v/members/%v (403 Forbidden)", todoList.Id, user.Username)
+		writeError(w, r, fmt.Errorf("%w: the owner role is required to remove other members", errForbidden))
+		return
+	}
+
+	removedMember, err := todoList.RemoveMember(user.Id)
+
+	if err != nil {
+		log.Printf("%v is not a member of the list: %v", username, err)
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(removedMember)
+	log.Printf("DELETE /lists/%v/members/%v (200 OK)", todoList.Id, user.Username)
+}
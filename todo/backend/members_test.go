@@ -0,0 +1,174 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// sends a request with the headers to the test server and returns the status and the body
+func testRequestWithHeaders(t *testing.T, serverUrl string, method string, path string, headers map[string]string, body string) (int, string) {
+	t.Helper()
+	request, _ := http.NewRequest(method, serverUrl+"/api/v1"+path, strings.NewReader(body))
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("%v %v: %v", method, path, err)
+	}
+	defer response.Body.Close()
+	responseBody, _ := io.ReadAll(response.Body)
+	return response.StatusCode, string(responseBody)
+}
+
+// returns the status of the first error of a GraphQL response, 200 without errors
+func graphqlStatus(body string) int {
+	decoded := struct {
+		Errors []struct {
+			Extensions struct{ Status int }
+		}
+	}{}
+	json.Unmarshal([]byte(body), &decoded)
+	if len(decoded.Errors) == 0 {
+		return http.StatusOK
+	}
+	return decoded.Errors[0].Extensions.Status
+}
+
+// completers can only mark todos as done or not done, in every api that changes todos
+func TestCompleterOnlyChangesDone(t *testing.T) {
+	server := newTestServer(t)
+	token := newTestListToken(t, server.URL)
+
+	_, body := testRequest(t, server.URL, "POST", "/todo", token, `{"name":"milk"}`)
+	testRequest(t, server.URL, "POST", "/todo", token, `{"name":"eggs"}`)
+	created := struct{ Id int }{}
+	json.Unmarshal([]byte(body), &created)
+
+	_, body = testRequest(t, server.URL, "POST", "/shares", token, `{"scope":"complete"}`)
+	link := struct{ Token string }{}
+	json.Unmarshal([]byte(body), &link)
+
+	todoPath := fmt.Sprintf("/todo/%v", created.Id)
+	mergePatch := map[string]string{"Authorization": "Bearer " + link.Token, "Content-Type": "application/merge-patch+json"}
+	jsonPatch := map[string]string{"Authorization": "Bearer " + link.Token, "Content-Type": "application/json-patch+json"}
+	put := map[string]string{"Authorization": "Bearer " + link.Token}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		body    string
+		want    int
+	}{
+		{"PUT name", "PUT", todoPath, put, `{"name":"oat milk"}`, http.StatusForbidden},
+		{"PUT text", "PUT", todoPath, put, `{"name":"milk","text":"1 liter"}`, http.StatusForbidden},
+		{"PUT category", "PUT", todoPath, put, `{"name":"milk","category":["dairy"]}`, http.StatusForbidden},
+		{"PUT move", "PUT", todoPath, put, `{"name":"milk","upOrDown":-1}`, http.StatusForbidden},
+		{"PUT done", "PUT", todoPath, put, `{"name":"milk","done":true}`, http.StatusOK},
+		{"PATCH name", "PATCH", todoPath, mergePatch, `{"name":"oat milk"}`, http.StatusForbidden},
+		{"PATCH text", "PATCH", todoPath, mergePatch, `{"text":"1 liter"}`, http.StatusForbidden},
+		{"PATCH category", "PATCH", todoPath, jsonPatch, `[{"op":"replace","path":"/category","value":["dairy"]}]`, http.StatusForbidden},
+		{"PATCH move", "PATCH", todoPath, mergePatch, `{"upOrDown":-1}`, http.StatusForbidden},
+		{"PATCH done", "PATCH", todoPath, jsonPatch, `[{"op":"replace","path":"/done","value":false}]`, http.StatusOK},
+		{"POST todo", "POST", "/todo", put, `{"name":"bread"}`, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		if status, body := testRequestWithHeaders(t, server.URL, test.method, test.path, test.headers, test.body); status != test.want {
+			t.Errorf("%v: got %v, want %v: %v", test.name, status, test.want, body)
+		}
+	}
+
+	mutations := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"updateTodo name", `mutation { updateTodo(id: ID, input: {name: "oat milk"}) { id } }`, http.StatusForbidden},
+		{"updateTodo text", `mutation { updateTodo(id: ID, input: {text: "1 liter"}) { id } }`, http.StatusForbidden},
+		{"updateTodo category", `mutation { updateTodo(id: ID, input: {category: ["dairy"]}) { id } }`, http.StatusForbidden},
+		{"moveTodo", `mutation { moveTodo(id: ID, up: false) { id } }`, http.StatusForbidden},
+		{"updateTodo done", `mutation { updateTodo(id: ID, input: {done: true}) { done } }`, http.StatusOK},
+	}
+
+	for _, mutation := range mutations {
+		query, _ := json.Marshal(map[string]string{"query": strings.Replace(mutation.query, "ID", fmt.Sprint(created.Id), 1)})
+		_, body := testRequest(t, server.URL, "POST", "/graphql", link.Token, string(query))
+		if status := graphqlStatus(body); status != mutation.want {
+			t.Errorf("%v: got %v, want %v: %v", mutation.name, status, mutation.want, body)
+		}
+	}
+
+	// nothing but done was changed and the todo was not moved, new todos are added at the start
+	_, body = testRequest(t, server.URL, "GET", "/todo", token, "")
+	todos := []struct {
+		Name     string
+		Text     string
+		Done     bool
+		Category []string
+	}{}
+	json.Unmarshal([]byte(body), &todos)
+	if len(todos) != 2 || todos[0].Name != "eggs" || todos[1].Name != "milk" || todos[1].Text != "" || len(todos[1].Category) != 0 || !todos[1].Done {
+		t.Errorf("got todos %+v", todos)
+	}
+}
+
+// creates a user (unless an earlier run of the test created it), logs in and returns the session token
+func newTestSession(t *testing.T, serverUrl string, username string) string {
+	t.Helper()
+	credentials := `{"username":"` + username + `","password":"correct horse"}`
+	if status, body := testRequest(t, serverUrl, "POST", "/users", "", credentials); status != http.StatusCreated && status != http.StatusConflict {
+		t.Fatalf("POST /users: got %v: %v", status, body)
+	}
+	_, body := testRequest(t, serverUrl, "POST", "/sessions", "", credentials)
+	session := struct{ Token string }{}
+	json.Unmarshal([]byte(body), &session)
+	return session.Token
+}
+
+// members without the owner role can leave the list, but can not remove other members
+func TestDeleteMemberRemovesOnlyThemselves(t *testing.T) {
+	server := newTestServer(t)
+	owner := newTestSession(t, server.URL, "member-owner")
+	editor := newTestSession(t, server.URL, "member-editor")
+	viewer := newTestSession(t, server.URL, "member-viewer")
+
+	_, body := testRequest(t, server.URL, "POST", "/lists", owner, `{"name":"members"}`)
+	list := struct{ Id string }{}
+	json.Unmarshal([]byte(body), &list)
+	testRequest(t, server.URL, "PUT", "/lists/"+list.Id+"/members/member-editor", owner, `{"role":"editor"}`)
+	testRequest(t, server.URL, "PUT", "/lists/"+list.Id+"/members/member-viewer", owner, `{"role":"viewer"}`)
+
+	tests := []struct {
+		name   string
+		token  string
+		member string
+		want   int
+	}{
+		{"editor removes the viewer", editor, "member-viewer", http.StatusForbidden},
+		{"editor removes the owner", editor, "member-owner", http.StatusForbidden},
+		{"viewer removes the editor", viewer, "member-editor", http.StatusForbidden},
+		{"viewer leaves", viewer, "member-viewer", http.StatusOK},
+		{"viewer after leaving", viewer, "member-viewer", http.StatusNotFound},
+		{"editor leaves", editor, "member-editor", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		if status, body := testRequest(t, server.URL, "DELETE", "/lists/"+list.Id+"/members/"+test.member, test.token, ""); status != test.want {
+			t.Errorf("%v: got %v, want %v: %v", test.name, status, test.want, body)
+		}
+	}
+
+	_, body = testRequest(t, server.URL, "GET", "/lists/"+list.Id+"/members", owner, "")
+	members := []interface{}{}
+	json.Unmarshal([]byte(body), &members)
+	if len(members) != 1 {
+		t.Errorf("got members %v, want the owner", body)
+	}
+}
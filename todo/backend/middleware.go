@@ -1,6 +1,8 @@
 package backend
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 
 	"klaemsch.io/todo/stores"
@@ -15,8 +17,9 @@ func CORS(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Access-Control-Allow-Origin", "*")
 		w.Header().Add("Access-Control-Allow-Credentials", "true")
-		w.Header().Add("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		w.Header().Add("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		w.Header().Add("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, If-Match, If-None-Match, Last-Event-ID, Idempotency-Key, X-Todo-List")
+		w.Header().Add("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+		w.Header().Add("Access-Control-Expose-Headers", "ETag, Location, Deprecation, Sunset, Link, Idempotent-Replayed")
 
 		if r.Method == "OPTIONS" {
 			http.Error(w, http.StatusText(http.StatusNoContent), http.StatusNoContent)
@@ -30,6 +33,8 @@ func CORS(next http.HandlerFunc) http.HandlerFunc {
 type MyHandlerFunc func(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList)
 
 /* http Middleware for extracting and validating the content of the Authorization Header (token)
+ * the token is the id of a list (anonymous lists), an access token, a share token, the session of a user
+ * that has access to the named list or a signed access token (JWT) of the list (see resolveTodoList)
  * if token / listId is valid -> next function / request handler
  * if token / listId is invalid -> returns error
  */
@@ -41,20 +46,96 @@ func AUTH(next MyHandlerFunc) http.HandlerFunc {
 		token, err := GetTokenFromRequest(r)
 
 		if err != nil {
-			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			writeError(w, r, err)
 			return
 		}
 
-		// checks if the token / listId is in the todo list store
-		todoList := stores.GetTodoListById(token)
+		// resolves the user of a session and checks the access to the list
+		todoList, r, err := resolveTodoList(r, token)
 
-		if todoList == nil {
+		if err != nil {
 			// if token / listId is invalid return error
-			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			writeError(w, r, err)
 			return
 		}
 
+		// lock the list while the request is handled, so reads and changes of one request
+		// (e.g. checking a version and updating a todo) are not mixed with other requests
+		todoList.Lock()
+		defer todoList.Unlock()
+
 		// call next function with todoList
 		next(w, r, todoList)
 	}
 }
+
+/* http Middleware for requests that stream changes of a todo list (WebSocket, Server-Sent Events)
+ * works like AUTH, but does not lock the list, because the request is open as long as the client listens
+ * the handler has to lock the list itself while reading it
+ * browsers can not set headers for WebSockets and EventSources, so the token can also be sent
+ * as access_token url parameter (RFC 6750) and the list of a session as list url parameter
+ */
+func AUTHSTREAM(next MyHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		token, err := getStreamToken(r)
+
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		todoList, r, err := resolveTodoList(r, token)
+
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		next(w, r, todoList)
+	}
+}
+
+/* Middleware for list requests that need more than read access, is called after AUTH
+ * required:	the minimum role of the user on the list (viewer, completer, editor, owner)
+ * if the role of the user is too low -> returns error (403 Forbidden)
+ */
+func ROLE(required string, next MyHandlerFunc) MyHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+		if !stores.HasRole(roleFromRequest(r), required) {
+			writeError(w, r, fmt.Errorf("%w: the %v role is required", errForbidden, required))
+			return
+		}
+
+		next(w, r, todoList)
+	}
+}
+
+type UserHandlerFunc func(w http.ResponseWriter, r *http.Request, user *stores.User)
+
+/* http Middleware for requests of logged in users that do not belong to a list (account, logout)
+ * the Authorization Header has to contain the token of a session
+ * if the session is valid -> next function / request handler with the user of the session
+ * if the session is unknown or expired -> returns error (401 Unauthorized)
+ */
+func USER(next UserHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		token, err := GetTokenFromRequest(r)
+
+		if err != nil || len(token) != stores.SessionTokenLength {
+			writeError(w, r, fmt.Errorf("%w: log in and send the token of the session", errUnauthorized))
+			return
+		}
+
+		user := stores.GetUserOfSession(token)
+
+		if user == nil {
+			writeError(w, r, fmt.Errorf("%w: unknown or expired session", errUnauthorized))
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)), user)
+	}
+}
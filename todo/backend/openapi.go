@@ -0,0 +1,864 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * The OpenAPI document of the api is generated from two sources:
+ * - the routes that are registered with RegisterVersion and RegisterLegacy (main.go)
+ * - the documentation of every route in operationDocs below
+ * openapi_test.go compares both and fails if a route has no documentation, a documentation has no route
+ * or a handler writes a status code that is not documented, so handlers and spec can not drift apart unnoticed
+ */
+
+// a route that was registered at the default ServeMux
+type registeredRoute struct {
+	// full pattern, e.g. "GET /api/v1/todo/{id}"
+	Pattern string
+	// pattern of the route in its version, e.g. "GET /todo/{id}", key of operationDocs
+	DocKey string
+	// unversioned legacy route
+	Legacy bool
+}
+
+// all routes registered with handleFunc, in order of registration
+var registeredRoutes []registeredRoute
+
+// documentation of a single route (method + path)
+type operationDoc struct {
+	Summary    string
+	Deprecated bool
+	// the list token, the session of a user with access to the list (X-Todo-List) or a signed access token is required
+	Auth bool
+	// the session of a user is required
+	Session bool
+	// the minimum role of the user on the list (ROLE middleware), "" if every role may read
+	Role      string
+	Query     []parameterDoc
+	Headers   []parameterDoc
+	Request   map[string]interface{}
+	Responses map[int]responseDoc
+	// the 200 response is sent in every format of the encoders (Accept header)
+	Negotiated bool
+}
+
+// documentation of a query parameter
+type parameterDoc struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// documentation of a response (content type is application/json if a schema is set)
+type responseDoc struct {
+	Description string
+	ContentType string
+	Schema      interface{}
+}
+
+// helpers to describe schemas in the documentation
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func arrayOf(items interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+func jsonBody(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": schema}
+}
+
+// query parameter of the deprecated routes
+var idQuery = parameterDoc{"id", "integer", "id of the todo (deprecated, use the path parameter)"}
+
+// query parameters of the routes that stream the changes of a list
+var (
+	sinceQuery       = parameterDoc{"since", "integer", "id of the last change the client received, the missed changes are sent first"}
+	accessTokenQuery = parameterDoc{"access_token", "string", "token of the list, for clients that can not send the Authorization header"}
+)
+
+// header of requests of logged in users
+var listHeader = parameterDoc{"X-Todo-List", "string", "id of the list, required with the token of a session"}
+
+// header of requests that can be retried without creating duplicates
+var idempotencyKeyHeader = parameterDoc{"Idempotency-Key", "string", "unique key of the request, retries of the same credential with the same key and body get the first response again for 24 hours"}
+
+// response of the batch endpoint
+var batchResponse = map[string]interface{}{
+	"type":       "object",
+	"properties": map[string]interface{}{"results": arrayOf(ref("BatchResult"))},
+}
+
+// request body of the GraphQL endpoint
+var graphqlRequestSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []string{"query"},
+	"properties": map[string]interface{}{
+		"query":         map[string]interface{}{"type": "string"},
+		"variables":     map[string]interface{}{"type": "object"},
+		"operationName": map[string]interface{}{"type": "string"},
+	},
+}
+
+// documentation of every route, the key is the pattern of the route in its version (OPTIONS routes are not documented)
+var operationDocs = map[string]operationDoc{
+	"GET /todo": {
+		Summary: "Returns all todos of the list (or a single todo with the deprecated ?id=)",
+		Auth:    true,
+		Query:   []parameterDoc{idQuery},
+		Responses: map[int]responseDoc{
+			200: {"all todos of the list in the format of the Accept header", "", arrayOf(ref("Todo"))},
+			304: {"todos did not change (If-None-Match)", "", nil},
+			406: {"no format of the Accept header is supported", problemContentType, ref("Problem")},
+		},
+		Negotiated: true,
+	},
+	"POST /todo": {
+		Summary: "Creates a new todo",
+		Auth:    true,
+		Role:    stores.RoleEditor,
+		Headers: []parameterDoc{idempotencyKeyHeader},
+		Request: jsonBody(ref("Todo")),
+		Responses: map[int]responseDoc{
+			201: {"the created todo (or the first response of a retry with the same Idempotency-Key)", "", ref("Todo")},
+			422: {"invalid todo or Idempotency-Key reused with a different body", problemContentType, ref("Problem")},
+		},
+	},
+	"PUT /todo": {
+		Summary:    "Replaces the todo with the id given in the body",
+		Deprecated: true,
+		Auth:       true,
+		Role:       stores.RoleCompleter,
+		Request:    jsonBody(ref("TodoUpdate")),
+		Responses: map[int]responseDoc{
+			200: {"the updated todo", "", ref("Todo")},
+		},
+	},
+	"DELETE /todo": {
+		Summary:    "Deletes the todo with the given id",
+		Deprecated: true,
+		Auth:       true,
+		Role:       stores.RoleEditor,
+		Query:      []parameterDoc{idQuery},
+		Responses: map[int]responseDoc{
+			200: {"the deleted todo", "", ref("Todo")},
+		},
+	},
+	"POST /todo/batch": {
+		Summary: "Applies create, update, delete and move operations all or nothing",
+		Auth:    true,
+		Role:    stores.RoleEditor,
+		Request: jsonBody(ref("BatchRequest")),
+		Responses: map[int]responseDoc{
+			200: {"results of every operation", "", batchResponse},
+		},
+	},
+	"GET /todo/{id}": {
+		Summary: "Returns a single todo",
+		Auth:    true,
+		Responses: map[int]responseDoc{
+			200: {"the todo in the format of the Accept header", "", ref("Todo")},
+			304: {"todo did not change (If-None-Match)", "", nil},
+			406: {"no format of the Accept header is supported", problemContentType, ref("Problem")},
+		},
+		Negotiated: true,
+	},
+	"PUT /todo/{id}": {
+		Summary: "Replaces a todo",
+		Auth:    true,
+		Role:    stores.RoleCompleter,
+		Request: jsonBody(ref("TodoUpdate")),
+		Responses: map[int]responseDoc{
+			200: {"the updated todo", "", ref("Todo")},
+		},
+	},
+	"PATCH /todo/{id}": {
+		Summary: "Changes single fields of a todo",
+		Auth:    true,
+		Role:    stores.RoleCompleter,
+		Request: map[string]interface{}{
+			stores.MergePatchContentType: ref("TodoUpdate"),
+			stores.JsonPatchContentType:  arrayOf(ref("PatchOperation")),
+		},
+		Responses: map[int]responseDoc{
+			200: {"the patched todo", "", ref("Todo")},
+			415: {"the patch is neither a merge patch nor a json patch", problemContentType, ref("Problem")},
+		},
+	},
+	"DELETE /todo/{id}": {
+		Summary: "Deletes a todo",
+		Auth:    true,
+		Role:    stores.RoleEditor,
+		Responses: map[int]responseDoc{
+			204: {"the todo was deleted", "", nil},
+		},
+	},
+	"GET /lists": {
+		Summary: "Returns all lists of the logged in user in the order of the user, with the number of their todos",
+		Session: true,
+		Query:   []parameterDoc{{"archived", "boolean", "only the archived (true) or not archived (false) lists"}},
+		Responses: map[int]responseDoc{
+			200: {"the lists of the user", "", arrayOf(ref("List"))},
+			401: {"no session or the session expired", problemContentType, ref("Problem")},
+		},
+	},
+	"POST /lists": {
+		Summary: "Creates a named list of the logged in user, at the end of the lists of the user",
+		Session: true,
+		Request: jsonBody(ref("ListMetadata")),
+		Responses: map[int]responseDoc{
+			201: {"the created list", "", ref("List")},
+			401: {"no session or the session expired", problemContentType, ref("Problem")},
+			422: {"invalid name, description or color", problemContentType, ref("Problem")},
+		},
+	},
+	"PUT /lists/order": {
+		Summary: "Orders the lists of the logged in user, the body contains the ids of all lists in the new order",
+		Session: true,
+		Request: jsonBody(ref("ListOrder")),
+		Responses: map[int]responseDoc{
+			200: {"the lists of the user in the new order", "", arrayOf(ref("List"))},
+			401: {"no session or the session expired", problemContentType, ref("Problem")},
+			422: {"the order does not contain every list of the user exactly once", problemContentType, ref("Problem")},
+		},
+	},
+	"GET /lists/{listId}": {
+		Summary: "Returns the list with the number of its todos",
+		Auth:    true,
+		Responses: map[int]responseDoc{
+			200: {"the list", "", ref("List")},
+		},
+	},
+	"PATCH /lists/{listId}": {
+		Summary: "Renames, describes, colors or archives the list (merge patch, only the sent fields are changed)",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Request: jsonBody(ref("ListMetadata")),
+		Responses: map[int]responseDoc{
+			200: {"the changed list", "", ref("List")},
+			422: {"invalid name, description or color", problemContentType, ref("Problem")},
+		},
+	},
+	"DELETE /lists/{listId}": {
+		Summary: "Deletes the list with all of its todos, clients that watch the list are disconnected",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Responses: map[int]responseDoc{
+			200: {"the deleted list", "", ref("List")},
+		},
+	},
+	"GET /lists/{listId}/members": {
+		Summary: "Returns every user with access to the list and its role, the owner first",
+		Auth:    true,
+		Responses: map[int]responseDoc{
+			200: {"the members of the list", "", arrayOf(ref("Member"))},
+		},
+	},
+	"PUT /lists/{listId}/members/{username}": {
+		Summary: "Shares the list with a user (viewer, completer, editor or owner) or changes the role of a member",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Request: jsonBody(ref("MemberRequest")),
+		Responses: map[int]responseDoc{
+			200: {"the member with its new role", "", ref("Member")},
+			201: {"the invited member", "", ref("Member")},
+			409: {"the list has no owner or the role of the owner was changed", problemContentType, ref("Problem")},
+			422: {"unknown role", problemContentType, ref("Problem")},
+		},
+	},
+	"DELETE /lists/{listId}/members/{username}": {
+		Summary: "Revokes the access of a member, owners remove every member and every member can leave the list",
+		Auth:    true,
+		Responses: map[int]responseDoc{
+			200: {"the removed member", "", ref("Member")},
+			403: {"only owners remove other members", problemContentType, ref("Problem")},
+		},
+	},
+	"GET /lists/{listId}/todos": {
+		Summary: "Returns all todos of the list",
+		Auth:    true,
+		Responses: map[int]responseDoc{
+			200: {"all todos of the list", "", arrayOf(ref("Todo"))},
+		},
+	},
+	"GET /search": {
+		Summary: "Returns all saved searches (or a single one with ?id=)",
+		Auth:    true,
+		Query:   []parameterDoc{{"id", "integer", "id of the saved search"}},
+		Responses: map[int]responseDoc{
+			200: {"all saved searches of the list", "", arrayOf(ref("SavedSearch"))},
+		},
+	},
+	"POST /search": {
+		Summary: "Creates a saved search",
+		Auth:    true,
+		Role:    stores.RoleEditor,
+		Request: jsonBody(ref("SavedSearch")),
+		Responses: map[int]responseDoc{
+			200: {"the created saved search", "", ref("SavedSearch")},
+		},
+	},
+	"PUT /search": {
+		Summary: "Replaces the saved search with the id given in the body",
+		Auth:    true,
+		Role:    stores.RoleEditor,
+		Request: jsonBody(ref("SavedSearch")),
+		Responses: map[int]responseDoc{
+			200: {"the updated saved search", "", ref("SavedSearch")},
+		},
+	},
+	"DELETE /search": {
+		Summary: "Deletes a saved search",
+		Auth:    true,
+		Role:    stores.RoleEditor,
+		Query:   []parameterDoc{{"id", "integer", "id of the saved search"}},
+		Responses: map[int]responseDoc{
+			200: {"the deleted saved search", "", ref("SavedSearch")},
+		},
+	},
+	"GET /search/todos": {
+		Summary: "Returns the todos that currently match a saved search",
+		Auth:    true,
+		Query:   []parameterDoc{{"id", "integer", "id of the saved search"}},
+		Responses: map[int]responseDoc{
+			200: {"matching todos", "", arrayOf(ref("Todo"))},
+		},
+	},
+	"GET /list": {
+		Summary: "Creates a new todo list and returns its initial access token (only sent this time), lists created with a session belong to the user and return the id",
+		Responses: map[int]responseDoc{
+			200: {"initial access token of the new list (id of lists of users)", "text/plain", map[string]interface{}{"type": "string"}},
+		},
+	},
+	"POST /users": {
+		Summary: "Registers a user account (the password is stored as bcrypt hash)",
+		Request: jsonBody(ref("Credentials")),
+		Responses: map[int]responseDoc{
+			201: {"the created user", "", ref("User")},
+			409: {"the username is already taken", problemContentType, ref("Problem")},
+		},
+	},
+	"GET /users/me": {
+		Summary: "Returns the account of the logged in user with the ids of its lists",
+		Session: true,
+		Responses: map[int]responseDoc{
+			200: {"the user and its lists", "", ref("UserProfile")},
+			401: {"no session or the session expired", problemContentType, ref("Problem")},
+		},
+	},
+	"POST /sessions": {
+		Summary: "Logs a user in, the token of the session is sent as bearer token with the following requests",
+		Request: jsonBody(ref("Credentials")),
+		Responses: map[int]responseDoc{
+			201: {"the new session", "", ref("Session")},
+			401: {"wrong username or password", problemContentType, ref("Problem")},
+			429: {"too many failed logins of the username, the Retry-After header names the seconds to wait", problemContentType, ref("Problem")},
+		},
+	},
+	"DELETE /sessions": {
+		Summary: "Logs the user out, the token of the session can not be used anymore",
+		Session: true,
+		Responses: map[int]responseDoc{
+			204: {"the session ended", "", nil},
+		},
+	},
+	"GET /list/stats": {
+		Summary: "Returns statistics of the list",
+		Auth:    true,
+		Responses: map[int]responseDoc{
+			200: {"statistics of the list", "", ref("ListStats")},
+		},
+	},
+	"POST /sync": {
+		Summary: "Applies the offline changes of a client and returns the changes of the list since its last sync",
+		Auth:    true,
+		Role:    stores.RoleEditor,
+		Request: jsonBody(ref("SyncRequest")),
+		Responses: map[int]responseDoc{
+			200: {"changes since the sync token, results of the changes of the client and the next sync token", "", ref("SyncResponse")},
+		},
+	},
+	"GET /shares": {
+		Summary: "Returns all share links of the list (without their tokens)",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Responses: map[int]responseDoc{
+			200: {"all share links of the list", "", arrayOf(ref("ShareLink"))},
+		},
+	},
+	"POST /shares": {
+		Summary: "Creates a share link, its token opens the list read-only (scope read) or to mark todos as done (scope complete); maxUses limits the number of requests, not the number of people or devices",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Request: jsonBody(ref("ShareLink")),
+		Responses: map[int]responseDoc{
+			201: {"the created share link with its token", "", ref("ShareLink")},
+			422: {"invalid scope, expiry or usage limit", problemContentType, ref("Problem")},
+		},
+	},
+	"DELETE /shares/{id}": {
+		Summary: "Revokes a share link, its token can not be used anymore",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Responses: map[int]responseDoc{
+			200: {"the revoked share link", "", ref("ShareLink")},
+		},
+	},
+	"GET /tokens": {
+		Summary: "Returns all access tokens of the list with the time of their last use (without the tokens)",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Responses: map[int]responseDoc{
+			200: {"all access tokens of the list", "", arrayOf(ref("AccessToken"))},
+		},
+	},
+	"POST /tokens": {
+		Summary: "Issues a named access token, after the first one the id of the list is not accepted as token anymore",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Request: jsonBody(ref("AccessToken")),
+		Responses: map[int]responseDoc{
+			201: {"the issued access token with its token", "", ref("AccessToken")},
+			422: {"invalid name", problemContentType, ref("Problem")},
+		},
+	},
+	"POST /tokens/{id}/rotate": {
+		Summary: "Replaces the token of an access token, the old token can not be used anymore",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Responses: map[int]responseDoc{
+			200: {"the access token with its new token", "", ref("AccessToken")},
+		},
+	},
+	"DELETE /tokens/{id}": {
+		Summary: "Revokes an access token, the last access token of a list without owner can not be revoked",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Responses: map[int]responseDoc{
+			200: {"the revoked access token", "", ref("AccessToken")},
+			409: {"the last access token of a list without owner", problemContentType, ref("Problem")},
+		},
+	},
+	"POST /auth/token": {
+		Summary: "Exchanges the list token, an access token or the session of a member for a signed access token (JWT) with the same role and a refresh token",
+		Auth:    true,
+		Responses: map[int]responseDoc{
+			200: {"the signed access token and the refresh token", "", ref("TokenResponse")},
+			403: {"share links and signed tokens can not be exchanged", problemContentType, ref("Problem")},
+		},
+	},
+	"POST /auth/refresh": {
+		Summary: "Exchanges a refresh token for a new signed access token and a new refresh token, a reused refresh token revokes the login",
+		Request: jsonBody(ref("RefreshRequest")),
+		Responses: map[int]responseDoc{
+			200: {"the signed access token and the refresh token", "", ref("TokenResponse")},
+			400: {"the refresh token is unknown, expired, used or its credential was revoked", problemContentType, ref("Problem")},
+		},
+	},
+	"POST /auth/revoke": {
+		Summary: "Revokes a refresh token and every refresh token of its login, signed access tokens expire on their own",
+		Request: jsonBody(ref("RefreshRequest")),
+		Responses: map[int]responseDoc{
+			204: {"the refresh token was revoked (unknown tokens are accepted as well)", "", nil},
+		},
+	},
+	"GET /jwks.json": {
+		Summary: "Returns the public keys of the EdDSA signed access tokens as JSON Web Key Set, HS256 secrets are not published",
+		Responses: map[int]responseDoc{
+			200: {"the current and the retired keys", "application/jwk-set+json", map[string]interface{}{"type": "object"}},
+		},
+	},
+	"GET /replica": {
+		Summary: "Returns the CRDT state of the list (positions, last-writer-wins fields and tombstones of every todo)",
+		Auth:    true,
+		Responses: map[int]responseDoc{
+			200: {"CRDT state of the list in the order of the positions", "", ref("ReplicaState")},
+		},
+	},
+	"POST /replica": {
+		Summary: "Merges the CRDT state of a replica into the list, every replica that merges the same states ends up with the same list",
+		Auth:    true,
+		Role:    stores.RoleEditor,
+		Request: jsonBody(ref("ReplicaRequest")),
+		Responses: map[int]responseDoc{
+			200: {"merged CRDT state of the list", "", ref("ReplicaState")},
+			409: {"the list would hold too many todos", problemContentType, ref("Problem")},
+		},
+	},
+	"GET /events": {
+		Summary: "Streams every change of the list as Server-Sent Events, resumes after the Last-Event-ID",
+		Auth:    true,
+		Query:   []parameterDoc{sinceQuery, accessTokenQuery},
+		Responses: map[int]responseDoc{
+			200: {"event stream with a hello (or reset) event followed by the changes of the list, ends with a revoked event when the credential does not open the list anymore", "text/event-stream", map[string]interface{}{"type": "string"}},
+		},
+	},
+	"GET /events/ws": {
+		Summary: "Opens a WebSocket that receives every change of the list",
+		Auth:    true,
+		Query:   []parameterDoc{sinceQuery, accessTokenQuery},
+		Responses: map[int]responseDoc{
+			101: {"WebSocket with a hello (or reset) message followed by the changes of the list, ends with a revoked message when the credential does not open the list anymore", "", nil},
+			400: {"request is not a WebSocket handshake", "", nil},
+		},
+	},
+	"POST /graphql": {
+		Summary: "Executes a GraphQL query or mutation on the todo list",
+		Auth:    true,
+		Request: jsonBody(graphqlRequestSchema),
+		Responses: map[int]responseDoc{
+			200: {"result of the query, errors of resolvers are part of the result", "", map[string]interface{}{"type": "object"}},
+			400: {"body is not a GraphQL request or the query is too deep or too complex", "", map[string]interface{}{"type": "object"}},
+		},
+	},
+	"GET /webhooks": {
+		Summary: "Returns all webhooks of the list (without their secrets)",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Responses: map[int]responseDoc{
+			200: {"all webhooks of the list", "", arrayOf(ref("Webhook"))},
+		},
+	},
+	"POST /webhooks": {
+		Summary: "Subscribes a url to the changes of the list, the deliveries are signed with the secret (X-Todo-Signature-256)",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Request: jsonBody(ref("Webhook")),
+		Responses: map[int]responseDoc{
+			201: {"the created webhook with its secret (a random one if none was sent)", "", ref("Webhook")},
+		},
+	},
+	"GET /webhooks/{id}": {
+		Summary: "Returns a single webhook (without its secret)",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Responses: map[int]responseDoc{
+			200: {"the webhook", "", ref("Webhook")},
+		},
+	},
+	"DELETE /webhooks/{id}": {
+		Summary: "Deletes a webhook, its pending deliveries are not sent anymore",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Responses: map[int]responseDoc{
+			200: {"the deleted webhook", "", ref("Webhook")},
+		},
+	},
+	"GET /webhooks/{id}/deliveries": {
+		Summary: "Returns the recorded deliveries of a webhook with every attempt, the latest delivery first",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Responses: map[int]responseDoc{
+			200: {"deliveries of the webhook", "", arrayOf(ref("Delivery"))},
+		},
+	},
+	"POST /webhooks/{id}/deliveries/{deliveryId}/redeliver": {
+		Summary: "Sends a delivery to the webhook again",
+		Auth:    true,
+		Role:    stores.RoleOwner,
+		Responses: map[int]responseDoc{
+			202: {"the delivery, it is sent in the background", "", ref("Delivery")},
+			409: {"the delivery is still pending", problemContentType, ref("Problem")},
+		},
+	},
+	"GET /openapi.json": {
+		Summary: "Returns this OpenAPI document",
+		Responses: map[int]responseDoc{
+			200: {"the OpenAPI document", "", map[string]interface{}{"type": "object"}},
+		},
+	},
+}
+
+/* Registers a route at the default ServeMux and remembers it for the OpenAPI document
+ * pattern:	method and full path, e.g. "GET /api/v1/todo/{id}"
+ * docKey:	pattern of the route in its version, e.g. "GET /todo/{id}"
+ * legacy:	if true, the route is documented as deprecated
+ * handler:	handler of the route
+ */
+func handleFunc(pattern string, docKey string, legacy bool, handler http.HandlerFunc) {
+	registeredRoutes = append(registeredRoutes, registeredRoute{pattern, docKey, legacy})
+	http.HandleFunc(pattern, handler)
+}
+
+/*
+ * Returns the OpenAPI document of the api
+ */
+func GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildOpenAPI())
+	log.Println("GET /openapi.json (200 OK)")
+}
+
+// regex to find the path parameters of a pattern, e.g. {id}
+var pathParameterPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// creates the OpenAPI 3.1 document from the registered routes and their documentation
+func buildOpenAPI() map[string]interface{} {
+
+	paths := map[string]map[string]interface{}{}
+
+	for _, route := range registeredRoutes {
+		doc, documented := operationDocs[route.DocKey]
+		if !documented {
+			continue
+		}
+		doc.Deprecated = doc.Deprecated || route.Legacy
+		method, path, _ := strings.Cut(route.Pattern, " ")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(method)] = buildOperation(path, doc)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   "Todo API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": componentSchemas(),
+			"securitySchemes": map[string]interface{}{
+				"listToken": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "id of the todo list (lists without owner and access tokens), an access token (POST /tokens) or the token of a share link (POST /shares)",
+				},
+				"session": map[string]interface{}{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "token of the session of a logged in user (POST /sessions), the list is named with the X-Todo-List header",
+				},
+				"jwt": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+					"description":  "signed access token of a list (POST /auth/token), verified with the keys of /jwks.json",
+				},
+			},
+		},
+	}
+}
+
+// creates the OpenAPI operation object of a documented route
+func buildOperation(path string, doc operationDoc) map[string]interface{} {
+
+	operation := map[string]interface{}{
+		"summary": doc.Summary,
+	}
+	if doc.Deprecated {
+		operation["deprecated"] = true
+	}
+	if doc.Auth {
+		operation["security"] = []interface{}{map[string]interface{}{"listToken": []string{}}, map[string]interface{}{"session": []string{}}, map[string]interface{}{"jwt": []string{}}}
+		doc.Headers = append(doc.Headers, listHeader)
+	}
+	if doc.Session {
+		operation["security"] = []interface{}{map[string]interface{}{"session": []string{}}}
+	}
+	if doc.Role != "" {
+		operation["x-required-role"] = doc.Role
+		// the responses of the documentation are copied, the 403 response is only added to this operation
+		responses := map[int]responseDoc{http.StatusForbidden: {"the role of the user on the list is too low", problemContentType, ref("Problem")}}
+		for status, response := range doc.Responses {
+			responses[status] = response
+		}
+		doc.Responses = responses
+	}
+
+	// path parameters are taken from the pattern, query and header parameters from the documentation
+	parameters := []interface{}{}
+	for _, match := range pathParameterPattern.FindAllStringSubmatch(path, -1) {
+		parameterType := "string"
+		if match[1] == "id" {
+			parameterType = "integer"
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true,
+			"schema": map[string]interface{}{"type": parameterType},
+		})
+	}
+	for _, query := range doc.Query {
+		parameters = append(parameters, map[string]interface{}{
+			"name": query.Name, "in": "query", "description": query.Description,
+			"schema": map[string]interface{}{"type": query.Type},
+		})
+	}
+	for _, header := range doc.Headers {
+		parameters = append(parameters, map[string]interface{}{
+			"name": header.Name, "in": "header", "description": header.Description,
+			"schema": map[string]interface{}{"type": header.Type},
+		})
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if doc.Request != nil {
+		content := map[string]interface{}{}
+		for contentType, schema := range doc.Request {
+			content[contentType] = map[string]interface{}{"schema": schema}
+		}
+		operation["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	// every operation can fail with problem details
+	responses := map[string]interface{}{
+		"default": map[string]interface{}{
+			"description": "error (RFC 7807 problem details)",
+			"content":     map[string]interface{}{problemContentType: map[string]interface{}{"schema": ref("Problem")}},
+		},
+	}
+	for status, response := range doc.Responses {
+		responseObject := map[string]interface{}{"description": response.Description}
+		if response.Schema != nil {
+			contentType := response.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			responseObject["content"] = map[string]interface{}{contentType: map[string]interface{}{"schema": response.Schema}}
+		}
+		// the data is the same in every format, tables (csv, markdown) are plain text
+		if response.Schema != nil && status == http.StatusOK && doc.Negotiated {
+			content := map[string]interface{}{}
+			for _, mediaType := range encoderMediaTypes() {
+				schema := response.Schema
+				if strings.HasPrefix(mediaType, "text/") {
+					schema = map[string]interface{}{"type": "string"}
+				}
+				content[mediaType] = map[string]interface{}{"schema": schema}
+			}
+			responseObject["content"] = content
+		}
+		responses[fmt.Sprint(status)] = responseObject
+	}
+	operation["responses"] = responses
+
+	return operation
+}
+
+// returns the schemas of all json structures, derived from the structs of the stores and the backend
+func componentSchemas() map[string]interface{} {
+
+	types := stores.SchemaTypes()
+	types["Problem"] = reflect.TypeOf(problem{})
+
+	// named types are referenced instead of inlined
+	names := map[reflect.Type]string{}
+	for name, schemaType := range types {
+		names[schemaType] = name
+	}
+
+	schemas := map[string]interface{}{}
+	for name, schemaType := range types {
+		schemas[name] = schemaFromType(schemaType, names, true)
+	}
+
+	// fields of request bodies that are set by the server are read only, other fields are rejected
+	for name, fields := range stores.RequestFields() {
+		writable := map[string]bool{}
+		for _, field := range fields {
+			writable[field] = true
+		}
+		schema := schemas[name].(map[string]interface{})
+		for property, propertySchema := range schema["properties"].(map[string]interface{}) {
+			if !writable[property] {
+				propertySchema.(map[string]interface{})["readOnly"] = true
+			}
+		}
+		schema["additionalProperties"] = false
+	}
+
+	// the todo of a batch operation is decoded like the body of POST /todo (create) or PUT /todo/{id} (update)
+	batchProperties := schemas["BatchOperation"].(map[string]interface{})["properties"].(map[string]interface{})
+	batchProperties["todo"] = map[string]interface{}{"anyOf": []interface{}{ref("Todo"), ref("TodoUpdate")}}
+
+	// every request with the token of a share link is one use (see stores.UseShareLink)
+	shareProperties := schemas["ShareLink"].(map[string]interface{})["properties"].(map[string]interface{})
+	shareProperties["maxUses"].(map[string]interface{})["description"] = "number of requests the token can be used for (a quota of requests, every request of every client counts), null if it is not limited"
+	shareProperties["uses"].(map[string]interface{})["description"] = "number of requests that were made with the token"
+	return schemas
+}
+
+/* Creates the json schema of a go type, using the json tags of struct fields
+ * names:	types that have their own schema and are referenced
+ * root:	if true, the type is described even if it has its own schema
+ */
+func schemaFromType(schemaType reflect.Type, names map[reflect.Type]string, root bool) map[string]interface{} {
+
+	if name, named := names[schemaType]; named && !root {
+		return ref(name)
+	}
+
+	switch schemaType {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{}
+	}
+
+	switch schemaType.Kind() {
+	case reflect.Pointer:
+		// pointers can be null
+		schema := schemaFromType(schemaType.Elem(), names, false)
+		if elemType, ok := schema["type"].(string); ok {
+			schema["type"] = []string{elemType, "null"}
+			return schema
+		}
+		return map[string]interface{}{"oneOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64, reflect.Float32:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return arrayOf(schemaFromType(schemaType.Elem(), names, false))
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFromType(schemaType.Elem(), names, false)}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		addStructProperties(schemaType, names, properties)
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+
+	return map[string]interface{}{}
+}
+
+// adds the json fields of a struct (and its embedded structs) to the properties of a schema
+func addStructProperties(structType reflect.Type, names map[reflect.Type]string, properties map[string]interface{}) {
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+
+		// embedded structs add their fields to the same object
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addStructProperties(field.Type, names, properties)
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaFromType(field.Type, names, false)
+	}
+}
@@ -0,0 +1,432 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"klaemsch.io/todo/stores"
+)
+
+// the routes can only be registered once at the default ServeMux
+var registerRoutesOnce sync.Once
+
+// starts a server with the routes of main.go
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	registerRoutesOnce.Do(func() {
+		RegisterVersion("v1", V1Routes())
+		RegisterLegacy("v1", V1Routes(), time.Now().Add(24*time.Hour))
+	})
+	server := httptest.NewServer(http.DefaultServeMux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// returns the names of all schemas a documentation references
+func referencedSchemas(doc operationDoc) []string {
+	encoded, _ := json.Marshal([]interface{}{doc.Request, doc.Responses})
+	var names []string
+	for _, match := range regexp.MustCompile(`#/components/schemas/(\w+)`).FindAllStringSubmatch(string(encoded), -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// decoders of the request schemas with the fields of stores.RequestFields
+var requestDecoders = map[string]func(r *http.Request) error{
+	"Todo":           func(r *http.Request) error { _, err := stores.NewTodoFromJson(r); return err },
+	"TodoUpdate":     func(r *http.Request) error { _, _, err := stores.UpdateTodoFromJson(r); return err },
+	"SavedSearch":    func(r *http.Request) error { _, err := stores.NewSearchFromJson(r); return err },
+	"ListMetadata":   func(r *http.Request) error { _, err := stores.ListMetadataFromJson(r); return err },
+	"MemberRequest":  func(r *http.Request) error { _, err := stores.MemberFromJson(r); return err },
+	"Credentials":    func(r *http.Request) error { _, err := stores.CredentialsFromJson(r, true); return err },
+	"ShareLink":      func(r *http.Request) error { _, err := stores.ShareLinkFromJson(r); return err },
+	"AccessToken":    func(r *http.Request) error { _, err := stores.AccessTokenFromJson(r); return err },
+	"RefreshRequest": func(r *http.Request) error { _, err := stores.RefreshRequestFromJson(r); return err },
+	"Webhook":        func(r *http.Request) error { _, err := stores.NewWebhookFromJson(r); return err },
+}
+
+// returns a value of the type of a property schema, references are objects
+func sampleValue(schema map[string]interface{}) interface{} {
+	schemaType := schema["type"]
+	if types, nullable := schemaType.([]string); nullable {
+		schemaType = types[0]
+	}
+	switch {
+	case schema["format"] == "date-time":
+		return time.Now().Add(time.Hour).Format(time.RFC3339)
+	case schemaType == "string":
+		return "value"
+	case schemaType == "integer":
+		return 1
+	case schemaType == "boolean":
+		return true
+	case schemaType == "array":
+		return []interface{}{}
+	}
+	return map[string]interface{}{}
+}
+
+/* Sends every property of a request schema alone to its decoder
+ * read only and unknown properties have to be rejected, the other properties have to be accepted
+ * (their values may still break a rule of the field)
+ * returns:	the differences between the schema and the decoder
+ */
+func checkRequestSchema(name string, schema map[string]interface{}) []string {
+
+	decoder, found := requestDecoders[name]
+	if !found {
+		return []string{fmt.Sprintf("request schema %v has no decoder in the test", name)}
+	}
+	if schema["additionalProperties"] != false {
+		return []string{fmt.Sprintf("request schema %v allows additional properties", name)}
+	}
+
+	// codes of the violations of a single property
+	decode := func(property string, value interface{}) []string {
+		body, _ := json.Marshal(map[string]interface{}{property: value})
+		err := decoder(httptest.NewRequest("POST", "/", strings.NewReader(string(body))))
+		codes := []string{}
+		var validationError *stores.ValidationError
+		if errors.As(err, &validationError) {
+			for _, violation := range validationError.Fields {
+				if violation.Field == property {
+					codes = append(codes, violation.Code)
+				}
+			}
+		}
+		return codes
+	}
+	rejected := func(codes []string) bool {
+		for _, code := range codes {
+			if code == "unknown_field" || code == "read_only" || code == "invalid_type" {
+				return true
+			}
+		}
+		return false
+	}
+
+	var problems []string
+	properties := schema["properties"].(map[string]interface{})
+	for property, propertySchema := range properties {
+		readOnly := propertySchema.(map[string]interface{})["readOnly"] == true
+		codes := decode(property, sampleValue(propertySchema.(map[string]interface{})))
+		if readOnly && !rejected(codes) {
+			problems = append(problems, fmt.Sprintf("read only property %v.%v is accepted by the decoder", name, property))
+		}
+		if !readOnly && rejected(codes) {
+			problems = append(problems, fmt.Sprintf("property %v.%v is rejected by the decoder: %v", name, property, codes))
+		}
+	}
+	if !rejected(decode("unknownProperty", "value")) {
+		problems = append(problems, fmt.Sprintf("unknown properties of %v are accepted by the decoder", name))
+	}
+	return problems
+}
+
+// every route needs its documentation and every documentation its route,
+// json request bodies are documented with the fields their decoders accept
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	newTestServer(t)
+
+	var problems []string
+	registered := map[string]bool{}
+
+	for _, route := range registeredRoutes {
+		registered[route.DocKey] = true
+		if strings.HasPrefix(route.DocKey, "OPTIONS ") {
+			continue
+		}
+		if _, documented := operationDocs[route.DocKey]; !documented {
+			problems = append(problems, "route without documentation: "+route.Pattern)
+		}
+	}
+
+	for pattern, doc := range operationDocs {
+		if !registered[pattern] {
+			problems = append(problems, "documentation without route: "+pattern)
+		}
+		// every referenced schema has to exist
+		for _, name := range referencedSchemas(doc) {
+			if _, exists := componentSchemas()[name]; !exists {
+				problems = append(problems, fmt.Sprintf("unknown schema %v in %v", name, pattern))
+			}
+		}
+	}
+
+	// the decoded request schemas, also inside of arrays and other schemas
+	schemas := componentSchemas()
+	for name := range stores.RequestFields() {
+		problems = append(problems, checkRequestSchema(name, schemas[name].(map[string]interface{}))...)
+	}
+	for pattern, doc := range operationDocs {
+		if schema, isRef := doc.Request["application/json"].(map[string]interface{}); isRef && schema["$ref"] != nil {
+			name := strings.TrimPrefix(schema["$ref"].(string), "#/components/schemas/")
+			if _, decoded := stores.RequestFields()[name]; !decoded && !undecodedRequestSchemas[name] {
+				problems = append(problems, fmt.Sprintf("request schema %v of %v has no fields in stores.RequestFields", name, pattern))
+			}
+		}
+	}
+
+	sort.Strings(problems)
+	for _, problem := range problems {
+		t.Error(problem)
+	}
+}
+
+// a request against the api and the status code the handler has to write
+type apiScenario struct {
+	// pattern of the route in its version, key of operationDocs
+	route string
+	// path and body can use values of earlier responses, e.g. {todo}
+	path    string
+	token   string
+	headers map[string]string
+	body    string
+	status  int
+	// keeps values of the response for later requests
+	save func(values map[string]string, response *http.Response, body []byte)
+}
+
+// stores a field of the json response under the key
+func saveField(key string, field string) func(map[string]string, *http.Response, []byte) {
+	return func(values map[string]string, response *http.Response, body []byte) {
+		decoded := map[string]interface{}{}
+		json.Unmarshal(body, &decoded)
+		values[key] = fmt.Sprint(decoded[field])
+	}
+}
+
+// stores the ETag of the response under the key
+func saveETag(key string) func(map[string]string, *http.Response, []byte) {
+	return func(values map[string]string, response *http.Response, body []byte) {
+		values[key] = response.Header.Get("ETag")
+	}
+}
+
+// request schemas that are decoded on their own, not with the fields of stores.RequestFields
+var undecodedRequestSchemas = map[string]bool{
+	"BatchRequest":   true,
+	"SyncRequest":    true,
+	"ReplicaRequest": true,
+	"ListOrder":      true,
+}
+
+// statuses that no scenario writes, with the reason
+var unexercisedStatuses = map[string]string{
+	"GET /events/ws 101": "the WebSocket handshake is covered by the clients of the stream",
+	"POST /webhooks/{id}/deliveries/{deliveryId}/redeliver 202": "deliveries run in the background, covered by the webhook tests of the stores",
+	"POST /webhooks/{id}/deliveries/{deliveryId}/redeliver 409": "deliveries run in the background, covered by the webhook tests of the stores",
+	"POST /replica 409": "needs a list with the maximum number of todos",
+}
+
+/* Sends requests to every documented route and compares the status codes with the documentation
+ * success statuses have to be documented for the route, errors have to be problem details (default response)
+ * or documented with their own content type; every documented status has to be written by a scenario
+ */
+func TestHandlersWriteDocumentedStatus(t *testing.T) {
+	server := newTestServer(t)
+
+	scenarios := []apiScenario{
+		{route: "GET /list", path: "/list", status: 200, save: func(values map[string]string, _ *http.Response, body []byte) {
+			values["auth"] = strings.TrimSpace(string(body))
+		}},
+		{route: "POST /graphql", path: "/graphql", token: "auth", body: `{"query":"{ list { id } }"}`, status: 200, save: func(values map[string]string, _ *http.Response, body []byte) {
+			values["list"] = graphqlListId(body)
+		}},
+		{route: "GET /openapi.json", path: "/openapi.json", status: 200},
+		{route: "POST /todo", path: "/todo", token: "auth", body: `{"name":"milk"}`, status: 201, save: saveField("todo", "id")},
+		{route: "POST /todo", path: "/todo", token: "auth", body: `{"name":""}`, status: 422},
+		{route: "POST /todo", path: "/todo", token: "", body: `{"name":"milk"}`, status: 403},
+		{route: "GET /todo", path: "/todo", token: "auth", status: 200, save: saveETag("listETag")},
+		{route: "GET /todo", path: "/todo", token: "auth", headers: map[string]string{"If-None-Match": "{listETag}"}, status: 304},
+		{route: "GET /todo", path: "/todo", token: "auth", headers: map[string]string{"Accept": "image/png"}, status: 406},
+		{route: "GET /todo/{id}", path: "/todo/{todo}", token: "auth", status: 200, save: saveETag("todoETag")},
+		{route: "GET /todo/{id}", path: "/todo/{todo}", token: "auth", headers: map[string]string{"If-None-Match": "{todoETag}"}, status: 304},
+		{route: "GET /todo/{id}", path: "/todo/{todo}", token: "auth", headers: map[string]string{"Accept": "image/png"}, status: 406},
+		{route: "GET /todo/{id}", path: "/todo/12345678", token: "auth", status: 404},
+		{route: "PUT /todo/{id}", path: "/todo/{todo}", token: "auth", body: `{"name":"oat milk"}`, status: 200},
+		{route: "PUT /todo/{id}", path: "/todo/{todo}", token: "auth", headers: map[string]string{"If-Match": `"0"`}, body: `{"name":"milk"}`, status: 412},
+		{route: "PUT /todo", path: "/todo", token: "auth", body: `{"id":{todo},"name":"milk"}`, status: 200},
+		{route: "PATCH /todo/{id}", path: "/todo/{todo}", token: "auth", headers: map[string]string{"Content-Type": "application/merge-patch+json"}, body: `{"done":true}`, status: 200},
+		{route: "PATCH /todo/{id}", path: "/todo/{todo}", token: "auth", headers: map[string]string{"Content-Type": "application/json"}, body: `{"done":true}`, status: 415},
+		{route: "POST /todo/batch", path: "/todo/batch", token: "auth", body: `{"operations":[{"op":"create","ref":"a","todo":{"name":"eggs"}}]}`, status: 200},
+		{route: "GET /list/stats", path: "/list/stats", token: "auth", status: 200},
+		{route: "GET /lists/{listId}/todos", path: "/lists/{list}/todos", token: "auth", status: 200},
+		{route: "GET /lists/{listId}", path: "/lists/{list}", token: "auth", status: 200},
+		{route: "GET /lists/{listId}/members", path: "/lists/{list}/members", token: "auth", status: 200},
+		{route: "POST /search", path: "/search", token: "auth", body: `{"name":"open","filter":{"done":false}}`, status: 200, save: saveField("search", "id")},
+		{route: "GET /search", path: "/search", token: "auth", status: 200},
+		{route: "PUT /search", path: "/search", token: "auth", body: `{"id":{search},"name":"done","filter":{"done":true}}`, status: 200},
+		{route: "GET /search/todos", path: "/search/todos?id={search}", token: "auth", status: 200},
+		{route: "DELETE /search", path: "/search?id={search}", token: "auth", status: 200},
+		{route: "GET /replica", path: "/replica", token: "auth", status: 200},
+		{route: "POST /replica", path: "/replica", token: "auth", body: `{"replica":"phone","todos":[]}`, status: 200},
+		{route: "POST /sync", path: "/sync", token: "auth", body: `{"changes":[]}`, status: 200},
+		{route: "POST /graphql", path: "/graphql", token: "auth", body: `{"query":"{ todos { id } }"}`, status: 200},
+		{route: "POST /graphql", path: "/graphql", token: "auth", body: `{"variables":{}}`, status: 400},
+		{route: "GET /events", path: "/events", token: "auth", status: 200},
+		{route: "GET /events/ws", path: "/events/ws", token: "auth", status: 400},
+		{route: "POST /webhooks", path: "/webhooks", token: "auth", body: `{"url":"https://hooks.example.com/todo","events":["created"]}`, status: 201, save: saveField("webhook", "id")},
+		{route: "GET /webhooks", path: "/webhooks", token: "auth", status: 200},
+		{route: "GET /webhooks/{id}", path: "/webhooks/{webhook}", token: "auth", status: 200},
+		{route: "GET /webhooks/{id}/deliveries", path: "/webhooks/{webhook}/deliveries", token: "auth", status: 200},
+		{route: "POST /webhooks/{id}/deliveries/{deliveryId}/redeliver", path: "/webhooks/{webhook}/deliveries/12345678/redeliver", token: "auth", status: 404},
+		{route: "DELETE /webhooks/{id}", path: "/webhooks/{webhook}", token: "auth", status: 200},
+		{route: "POST /shares", path: "/shares", token: "auth", body: `{"scope":"read"}`, status: 201, save: func(values map[string]string, response *http.Response, body []byte) {
+			saveField("share", "id")(values, response, body)
+			saveField("shareToken", "token")(values, response, body)
+		}},
+		{route: "POST /shares", path: "/shares", token: "auth", body: `{"scope":"write"}`, status: 422},
+		{route: "GET /shares", path: "/shares", token: "auth", status: 200},
+		{route: "GET /todo", path: "/todo", token: "shareToken", status: 200},
+		{route: "POST /todo", path: "/todo", token: "shareToken", body: `{"name":"milk"}`, status: 403},
+		{route: "POST /auth/token", path: "/auth/token", token: "shareToken", status: 403},
+		{route: "DELETE /shares/{id}", path: "/shares/{share}", token: "auth", status: 200},
+		{route: "POST /auth/token", path: "/auth/token", token: "auth", status: 200, save: func(values map[string]string, response *http.Response, body []byte) {
+			saveField("jwt", "access_token")(values, response, body)
+			saveField("refresh", "refresh_token")(values, response, body)
+		}},
+		{route: "GET /todo", path: "/todo", token: "jwt", status: 200},
+		{route: "POST /auth/refresh", path: "/auth/refresh", body: `{"refresh_token":"{refresh}"}`, status: 200, save: saveField("nextRefresh", "refresh_token")},
+		{route: "POST /auth/refresh", path: "/auth/refresh", body: `{"refresh_token":"{refresh}"}`, status: 400},
+		{route: "POST /auth/revoke", path: "/auth/revoke", body: `{"refresh_token":"{nextRefresh}"}`, status: 204},
+		{route: "GET /jwks.json", path: "/jwks.json", status: 200},
+		{route: "POST /tokens", path: "/tokens", token: "auth", body: `{"name":"phone"}`, status: 201, save: func(values map[string]string, response *http.Response, body []byte) {
+			saveField("accessToken", "id")(values, response, body)
+			saveField("auth", "token")(values, response, body)
+		}},
+		{route: "POST /tokens", path: "/tokens", token: "auth", body: `{"name":""}`, status: 422},
+		{route: "GET /todo", path: "/todo", token: "list", status: 403},
+		{route: "GET /tokens", path: "/tokens", token: "auth", status: 200, save: func(values map[string]string, _ *http.Response, body []byte) {
+			decoded := []struct{ Id int }{}
+			json.Unmarshal(body, &decoded)
+			values["initial"] = fmt.Sprint(decoded[0].Id)
+		}},
+		{route: "POST /tokens/{id}/rotate", path: "/tokens/{accessToken}/rotate", token: "auth", status: 200, save: saveField("auth", "token")},
+		{route: "DELETE /tokens/{id}", path: "/tokens/{initial}", token: "auth", status: 200},
+		{route: "DELETE /tokens/{id}", path: "/tokens/{accessToken}", token: "auth", status: 409},
+		{route: "POST /tokens", path: "/tokens", token: "auth", body: `{"name":"laptop"}`, status: 201, save: saveField("laptop", "id")},
+		{route: "DELETE /tokens/{id}", path: "/tokens/{laptop}", token: "auth", status: 200},
+		{route: "DELETE /todo/{id}", path: "/todo/{todo}", token: "auth", status: 204},
+		{route: "POST /todo", path: "/todo", token: "auth", body: `{"name":"bread"}`, status: 201, save: saveField("todo", "id")},
+		{route: "DELETE /todo", path: "/todo?id={todo}", token: "auth", status: 200},
+
+		// accounts and lists of users
+		{route: "POST /users", path: "/users", body: `{"username":"alice","password":"correct horse"}`, status: 201},
+		{route: "POST /users", path: "/users", body: `{"username":"alice","password":"correct horse"}`, status: 409},
+		{route: "POST /users", path: "/users", body: `{"username":"bob","password":"battery staple"}`, status: 201},
+		{route: "PUT /lists/{listId}/members/{username}", path: "/lists/{list}/members/bob", token: "auth", body: `{"role":"viewer"}`, status: 409},
+		{route: "POST /sessions", path: "/sessions", body: `{"username":"alice","password":"wrong"}`, status: 401},
+		{route: "POST /sessions", path: "/sessions", body: `{"username":"alice","password":"correct horse"}`, status: 201, save: saveField("alice", "token")},
+		{route: "POST /sessions", path: "/sessions", body: `{"username":"bob","password":"battery staple"}`, status: 201, save: saveField("bob", "token")},
+		{route: "GET /users/me", path: "/users/me", token: "alice", status: 200},
+		{route: "POST /lists", path: "/lists", token: "alice", body: `{"name":"shopping"}`, status: 201, save: saveField("shopping", "id")},
+		{route: "POST /lists", path: "/lists", token: "alice", body: `{"name":"chores","color":"red"}`, status: 422},
+		{route: "GET /lists", path: "/lists", token: "alice", status: 200},
+		{route: "GET /lists", path: "/lists", status: 401},
+		{route: "POST /lists", path: "/lists", body: `{"name":"chores"}`, status: 401},
+		{route: "PUT /lists/order", path: "/lists/order", token: "alice", body: `{"lists":["{shopping}"]}`, status: 200},
+		{route: "PUT /lists/order", path: "/lists/order", token: "alice", body: `{"lists":[]}`, status: 422},
+		{route: "PUT /lists/order", path: "/lists/order", body: `{"lists":[]}`, status: 401},
+		{route: "PATCH /lists/{listId}", path: "/lists/{shopping}", token: "alice", body: `{"description":"weekly"}`, status: 200},
+		{route: "PATCH /lists/{listId}", path: "/lists/{shopping}", token: "alice", body: `{"name":""}`, status: 422},
+		{route: "PUT /lists/{listId}/members/{username}", path: "/lists/{shopping}/members/bob", token: "alice", body: `{"role":"viewer"}`, status: 201},
+		{route: "PUT /lists/{listId}/members/{username}", path: "/lists/{shopping}/members/bob", token: "alice", body: `{"role":"editor"}`, status: 200},
+		{route: "PUT /lists/{listId}/members/{username}", path: "/lists/{shopping}/members/bob", token: "alice", body: `{"role":"boss"}`, status: 422},
+		{route: "GET /todo", path: "/todo", token: "bob", headers: map[string]string{"X-Todo-List": "{shopping}"}, status: 200},
+		{route: "DELETE /lists/{listId}/members/{username}", path: "/lists/{shopping}/members/alice", token: "bob", status: 403},
+		{route: "DELETE /lists/{listId}/members/{username}", path: "/lists/{shopping}/members/bob", token: "alice", status: 200},
+		{route: "GET /lists/{listId}", path: "/lists/{shopping}", token: "bob", status: 404},
+		{route: "DELETE /lists/{listId}", path: "/lists/{shopping}", token: "alice", status: 200},
+		{route: "DELETE /sessions", path: "/sessions", token: "alice", status: 204},
+		{route: "GET /users/me", path: "/users/me", token: "alice", status: 401},
+	}
+	// logins of a username are delayed after too many failed logins
+	for attempt := 0; attempt <= stores.LoginFreeAttempts; attempt++ {
+		scenarios = append(scenarios, apiScenario{route: "POST /sessions", path: "/sessions", body: `{"username":"mallory","password":"guess"}`, status: 401})
+	}
+	scenarios = append(scenarios, apiScenario{route: "POST /sessions", path: "/sessions", body: `{"username":"mallory","password":"guess"}`, status: 429})
+
+	values := map[string]string{}
+	seen := map[string]bool{}
+
+	for index, scenario := range scenarios {
+		doc, documented := operationDocs[scenario.route]
+		if !documented {
+			t.Fatalf("scenario %v: route %v is not documented", index, scenario.route)
+		}
+
+		// placeholders are replaced with the values of earlier responses
+		replacements := []string{}
+		for key, value := range values {
+			replacements = append(replacements, "{"+key+"}", value)
+		}
+		replacer := strings.NewReplacer(replacements...)
+		method, _, _ := strings.Cut(scenario.route, " ")
+		path := replacer.Replace(scenario.path)
+
+		// streams never end, the status is known as soon as the headers arrive
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		request, _ := http.NewRequestWithContext(ctx, method, server.URL+"/api/v1"+path, strings.NewReader(replacer.Replace(scenario.body)))
+		if scenario.token != "" {
+			request.Header.Set("Authorization", "Bearer "+values[scenario.token])
+		}
+		for name, value := range scenario.headers {
+			request.Header.Set(name, replacer.Replace(value))
+		}
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			cancel()
+			t.Fatalf("scenario %v: %v %v: %v", index, method, path, err)
+		}
+		var body []byte
+		if response.Header.Get("Content-Type") != "text/event-stream" {
+			body, _ = io.ReadAll(response.Body)
+		}
+		response.Body.Close()
+		cancel()
+
+		name := fmt.Sprintf("scenario %v (%v %v)", index, method, path)
+		if response.StatusCode != scenario.status {
+			t.Errorf("%v: got status %v, want %v: %s", name, response.StatusCode, scenario.status, body)
+			continue
+		}
+
+		// the status has to be documented, errors can also be problem details of the default response
+		key := fmt.Sprintf("%v %v", scenario.route, response.StatusCode)
+		seen[key] = true
+		_, listed := doc.Responses[response.StatusCode]
+		roleDenied := response.StatusCode == http.StatusForbidden && doc.Role != ""
+		problemDetails := response.StatusCode >= 400 && response.Header.Get("Content-Type") == problemContentType
+		if !listed && !roleDenied && !problemDetails {
+			t.Errorf("%v: status %v is not documented", name, response.StatusCode)
+		}
+
+		if scenario.save != nil {
+			scenario.save(values, response, body)
+		}
+	}
+
+	// every documented status has to be written by a scenario
+	for route, doc := range operationDocs {
+		for status := range doc.Responses {
+			key := fmt.Sprintf("%v %v", route, status)
+			if _, skipped := unexercisedStatuses[key]; !seen[key] && !skipped {
+				t.Errorf("documented status %v is not written by any scenario", key)
+			}
+		}
+	}
+}
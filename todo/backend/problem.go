@@ -0,0 +1,124 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * errors of the backend that are not returned by the stores
+ * handlers wrap them with details, e.g. fmt.Errorf("%w: body is corrupted", errBadRequest)
+ */
+var (
+	errBadRequest           = errors.New("bad request")
+	errUnauthorized         = errors.New("unauthorized")
+	errForbidden            = errors.New("forbidden")
+	errPreconditionFailed   = errors.New("precondition failed")
+	errNotAcceptable        = errors.New("not acceptable")
+	errIdempotencyKeyReused = errors.New("idempotency key reused")
+	errTooManyRequests      = errors.New("too many requests")
+)
+
+// content type of problem details responses (RFC 7807)
+const problemContentType = "application/problem+json"
+
+// structure of a problem details response (RFC 7807)
+type problem struct {
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Detail   string              `json:"detail,omitempty"`
+	Instance string              `json:"instance,omitempty"`
+	Code     string              `json:"code"`
+	Errors   []stores.FieldError `json:"errors,omitempty"`
+	// extension member of failed batch requests
+	Results interface{} `json:"results,omitempty"`
+}
+
+// maps an error to the status and machine-readable code of the problem response
+type problemMapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// the first mapping that matches the error (errors.Is) is used
+var problemMappings = []problemMapping{
+	{stores.ErrNotFound, http.StatusNotFound, "not-found"},
+	{stores.ErrConflict, http.StatusConflict, "conflict"},
+	{stores.ErrValidation, http.StatusUnprocessableEntity, "validation-failed"},
+	{stores.ErrQuota, http.StatusConflict, "quota-exceeded"},
+	{stores.ErrInvalidRefreshToken, http.StatusBadRequest, "invalid-grant"},
+	{errBadRequest, http.StatusBadRequest, "bad-request"},
+	{errUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{errForbidden, http.StatusForbidden, "forbidden"},
+	{errPreconditionFailed, http.StatusPreconditionFailed, "precondition-failed"},
+	{stores.ErrUnsupportedMediaType, http.StatusUnsupportedMediaType, "unsupported-media-type"},
+	{errNotAcceptable, http.StatusNotAcceptable, "not-acceptable"},
+	{errIdempotencyKeyReused, http.StatusUnprocessableEntity, "idempotency-key-reused"},
+	{errTooManyRequests, http.StatusTooManyRequests, "too-many-requests"},
+}
+
+/* Creates the problem details for an error
+ * known errors are mapped to their status and code, every other error is an internal server error
+ * the message of internal errors is not sent to the client
+ */
+func newProblem(r *http.Request, err error) problem {
+
+	problem := problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(http.StatusInternalServerError),
+		Status:   http.StatusInternalServerError,
+		Instance: r.URL.Path,
+		Code:     "internal-error",
+	}
+
+	for _, mapping := range problemMappings {
+		if errors.Is(err, mapping.err) {
+			problem.Type = "urn:klaemsch:todo:problem:" + mapping.code
+			problem.Title = http.StatusText(mapping.status)
+			problem.Status = mapping.status
+			problem.Code = mapping.code
+			problem.Detail = err.Error()
+			break
+		}
+	}
+
+	// field-level details of validation errors
+	var validationError *stores.ValidationError
+	if errors.As(err, &validationError) {
+		problem.Errors = validationError.Fields
+	}
+
+	return problem
+}
+
+/* Converts an error of decoding a request body into the error that is sent back
+ * validation errors (with their field details) and conflicts of the stores are kept,
+ * every other error means the body is not valid json
+ */
+func decodeError(err error) error {
+	if errors.Is(err, stores.ErrValidation) || errors.Is(err, stores.ErrConflict) || errors.Is(err, stores.ErrUnsupportedMediaType) {
+		return err
+	}
+	return fmt.Errorf("%w: body is corrupted", errBadRequest)
+}
+
+/* Sends the problem details of an error back (application/problem+json)
+ * replaces http.Error for every error response of the api
+ */
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, newProblem(r, err))
+}
+
+// sends already created problem details back
+func writeProblem(w http.ResponseWriter, problem problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
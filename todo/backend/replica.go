@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * Returns the CRDT state of the todo list (see stores/crdt.go)
+ * replicas that start from scratch load the state once and merge their edits afterwards
+ */
+func GetReplica(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	state := todoList.ReplicaState()
+
+	setETag(w, todoList.Version)
+	json.NewEncoder(w).Encode(state)
+	log.Printf("GET /replica (200 OK, %v todos)", len(state.Todos))
+}
+
+/*
+ * Merges the CRDT state of a replica into the todo list (see stores/crdt.go for the merge rules)
+ * returns the merged state of the list, the replica merges it the same way and ends up with the same list
+ */
+func PostReplica(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode the state of the replica from request body
+	request, err := stores.ReplicaFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	// merge the state, invalid todos or a full list leave the list unchanged
+	state, err := todoList.MergeReplica(request)
+
+	if err != nil {
+		log.Printf("State of replica %v could not be merged: %v", request.Replica, err)
+		writeError(w, r, err)
+		return
+	}
+
+	// send the merged state back with the new version of the list
+	setETag(w, todoList.Version)
+	json.NewEncoder(w).Encode(state)
+	log.Printf("POST /replica (200 OK, %v todos received from %v)", len(request.Todos), request.Replica)
+}
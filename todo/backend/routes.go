@@ -0,0 +1,102 @@
+package backend
+
+import "klaemsch.io/todo/stores"
+
+/* Returns the routes of version 1 of the api, registered under /api/v1/... (see RegisterVersion)
+ * routes that change a list need a role of the user on the list (ROLE), reading needs any role
+ * deprecated aliases: ?id= url parameter and id in the PUT body, replaced by /todo/{id}
+ * every route needs its documentation in operationDocs (checked by openapi_test.go)
+ */
+func V1Routes() Routes {
+	return Routes{
+		"OPTIONS /todo":                   CORS(nil),
+		"GET /todo":                       CORS(AUTH(GetTodo)),
+		"POST /todo":                      CORS(AUTH(ROLE(stores.RoleEditor, IDEMPOTENT(PostTodo)))),
+		"PUT /todo":                       CORS(AUTH(ROLE(stores.RoleCompleter, PutTodo))),
+		"DELETE /todo":                    CORS(AUTH(ROLE(stores.RoleEditor, DeleteTodo))),
+		"OPTIONS /todo/batch":             CORS(nil),
+		"POST /todo/batch":                CORS(AUTH(ROLE(stores.RoleEditor, PostBatch))),
+		"OPTIONS /todo/{id}":              CORS(nil),
+		"GET /todo/{id}":                  CORS(AUTH(GetTodoById)),
+		"PUT /todo/{id}":                  CORS(AUTH(ROLE(stores.RoleCompleter, PutTodo))),
+		"PATCH /todo/{id}":                CORS(AUTH(ROLE(stores.RoleCompleter, PatchTodo))),
+		"DELETE /todo/{id}":               CORS(AUTH(ROLE(stores.RoleEditor, DeleteTodo))),
+		"OPTIONS /lists":                  CORS(nil),
+		"GET /lists":                      CORS(USER(GetLists)),
+		"POST /lists":                     CORS(USER(PostList)),
+		"OPTIONS /lists/order":            CORS(nil),
+		"PUT /lists/order":                CORS(USER(PutListOrder)),
+		"OPTIONS /lists/{listId}":         CORS(nil),
+		"GET /lists/{listId}":             CORS(AUTH(GetList)),
+		"PATCH /lists/{listId}":           CORS(AUTH(ROLE(stores.RoleOwner, PatchList))),
+		"DELETE /lists/{listId}":          CORS(AUTH(ROLE(stores.RoleOwner, DeleteList))),
+		"OPTIONS /lists/{listId}/members": CORS(nil),
+		"GET /lists/{listId}/members":     CORS(AUTH(GetMembers)),
+		"OPTIONS /lists/{listId}/members/{username}": CORS(nil),
+		"PUT /lists/{listId}/members/{username}":     CORS(AUTH(ROLE(stores.RoleOwner, PutMember))),
+		"DELETE /lists/{listId}/members/{username}":  CORS(AUTH(DeleteMember)),
+		"OPTIONS /lists/{listId}/todos":              CORS(nil),
+		"GET /lists/{listId}/todos":                  CORS(AUTH(GetListTodos)),
+		"OPTIONS /search":                            CORS(nil),
+		"GET /search":                                CORS(AUTH(GetSearch)),
+		"POST /search":                               CORS(AUTH(ROLE(stores.RoleEditor, PostSearch))),
+		"PUT /search":                                CORS(AUTH(ROLE(stores.RoleEditor, PutSearch))),
+		"DELETE /search":                             CORS(AUTH(ROLE(stores.RoleEditor, DeleteSearch))),
+		"OPTIONS /search/todos":                      CORS(nil),
+		"GET /search/todos":                          CORS(AUTH(GetSearchTodos)),
+		"OPTIONS /list":                              CORS(nil),
+		"GET /list":                                  CORS(NewTodoList),
+		"OPTIONS /users":                             CORS(nil),
+		"POST /users":                                CORS(PostUser),
+		"OPTIONS /users/me":                          CORS(nil),
+		"GET /users/me":                              CORS(USER(GetMe)),
+		"OPTIONS /sessions":                          CORS(nil),
+		"POST /sessions":                             CORS(PostSession),
+		"DELETE /sessions":                           CORS(USER(DeleteSession)),
+		"OPTIONS /list/stats":                        CORS(nil),
+		"GET /list/stats":                            CORS(AUTH(GetListStats)),
+		"OPTIONS /webhooks":                          CORS(nil),
+		"GET /webhooks":                              CORS(AUTH(ROLE(stores.RoleOwner, GetWebhooks))),
+		"POST /webhooks":                             CORS(AUTH(ROLE(stores.RoleOwner, PostWebhook))),
+		"OPTIONS /webhooks/{id}":                     CORS(nil),
+		"GET /webhooks/{id}":                         CORS(AUTH(ROLE(stores.RoleOwner, GetWebhookById))),
+		"DELETE /webhooks/{id}":                      CORS(AUTH(ROLE(stores.RoleOwner, DeleteWebhook))),
+		"OPTIONS /webhooks/{id}/deliveries":          CORS(nil),
+		"GET /webhooks/{id}/deliveries":              CORS(AUTH(ROLE(stores.RoleOwner, GetDeliveries))),
+		"OPTIONS /webhooks/{id}/deliveries/{deliveryId}/redeliver": CORS(nil),
+		"POST /webhooks/{id}/deliveries/{deliveryId}/redeliver":    CORS(AUTH(ROLE(stores.RoleOwner, PostRedeliver))),
+		"OPTIONS /shares":             CORS(nil),
+		"GET /shares":                 CORS(AUTH(ROLE(stores.RoleOwner, GetShareLinks))),
+		"POST /shares":                CORS(AUTH(ROLE(stores.RoleOwner, PostShareLink))),
+		"OPTIONS /shares/{id}":        CORS(nil),
+		"DELETE /shares/{id}":         CORS(AUTH(ROLE(stores.RoleOwner, DeleteShareLink))),
+		"OPTIONS /tokens":             CORS(nil),
+		"GET /tokens":                 CORS(AUTH(ROLE(stores.RoleOwner, GetAccessTokens))),
+		"POST /tokens":                CORS(AUTH(ROLE(stores.RoleOwner, PostAccessToken))),
+		"OPTIONS /tokens/{id}":        CORS(nil),
+		"DELETE /tokens/{id}":         CORS(AUTH(ROLE(stores.RoleOwner, DeleteAccessToken))),
+		"OPTIONS /tokens/{id}/rotate": CORS(nil),
+		"POST /tokens/{id}/rotate":    CORS(AUTH(ROLE(stores.RoleOwner, PostRotateAccessToken))),
+		"OPTIONS /auth/token":         CORS(nil),
+		"POST /auth/token":            CORS(AUTH(PostToken)),
+		"OPTIONS /auth/refresh":       CORS(nil),
+		"POST /auth/refresh":          CORS(PostRefresh),
+		"OPTIONS /auth/revoke":        CORS(nil),
+		"POST /auth/revoke":           CORS(PostRevoke),
+		"OPTIONS /jwks.json":          CORS(nil),
+		"GET /jwks.json":              CORS(GetJWKS),
+		"OPTIONS /replica":            CORS(nil),
+		"GET /replica":                CORS(AUTH(GetReplica)),
+		"POST /replica":               CORS(AUTH(ROLE(stores.RoleEditor, PostReplica))),
+		"OPTIONS /sync":               CORS(nil),
+		"POST /sync":                  CORS(AUTH(ROLE(stores.RoleEditor, PostSync))),
+		"OPTIONS /events":             CORS(nil),
+		"GET /events":                 CORS(AUTHSTREAM(GetEvents)),
+		"OPTIONS /events/ws":          CORS(nil),
+		"GET /events/ws":              CORS(AUTHSTREAM(GetEventsWebSocket)),
+		"OPTIONS /graphql":            CORS(nil),
+		"POST /graphql":               CORS(AUTH(PostGraphQL)),
+		"OPTIONS /openapi.json":       CORS(nil),
+		"GET /openapi.json":           CORS(GetOpenAPI),
+	}
+}
@@ -0,0 +1,176 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * Returns data of
+ * a) all saved searches if no id is given
+ * b) only the saved search with given id (id as url parameter)
+ */
+func GetSearch(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// no id parameter given -> return all saved searches
+	if !r.URL.Query().Has("id") {
+		json.NewEncoder(w).Encode(todoList.GetSearches())
+		log.Println("GET /search (200 OK)")
+		return
+	}
+
+	// get id from url
+	idValue, err := getIdFromUrl(r)
+
+	// if an error occurs while extracting the id from the url -> 400 Bad Request
+	if err != nil {
+		log.Print(err.Error())
+		writeError(w, r, err)
+		return
+	}
+
+	// get saved search with given id
+	search := todoList.GetSearchById(idValue)
+
+	if search == nil {
+		log.Printf("saved search with id %v not found", idValue)
+		writeError(w, r, fmt.Errorf("%w: saved search with id %v", stores.ErrNotFound, idValue))
+	} else {
+		json.NewEncoder(w).Encode(search)
+		log.Printf("GET /search?id=%v (200 OK)", idValue)
+	}
+}
+
+/*
+ * Uses the request body to create a new saved search in the todo list
+ * returns the posted saved search
+ */
+func PostSearch(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode json from request body
+	search, err := stores.NewSearchFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	// add saved search to the todo list
+	newSearch, err := todoList.AddSearch(*search)
+
+	if err != nil {
+		log.Printf("Saved search could not be added: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// send posted saved search back
+	json.NewEncoder(w).Encode(newSearch)
+	log.Println("POST /search (200 OK)")
+}
+
+/*
+ * Uses the request body to update the name and filter of a saved search
+ * returns the updated saved search
+ */
+func PutSearch(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode json from request body
+	search, err := stores.UpdateSearchFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	// update saved search in the todo list
+	updatedSearch, err := todoList.UpdateSearch(*search)
+
+	if err != nil {
+		log.Printf("Saved search with id %v not found, could not be updated", search.Id)
+		writeError(w, r, err)
+		return
+	}
+
+	// send updated saved search back
+	json.NewEncoder(w).Encode(updatedSearch)
+	log.Printf("PUT /search?id=%v (200 OK)", updatedSearch.Id)
+}
+
+/*
+ * Uses the given id to delete the corresponding saved search
+ * returns the saved search that was deleted
+ */
+func DeleteSearch(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// get id from url
+	idValue, err := getIdFromUrl(r)
+
+	// if an error occurs while extracting the id from the url -> 400 Bad Request
+	if err != nil {
+		log.Print(err.Error())
+		writeError(w, r, err)
+		return
+	}
+
+	// remove saved search with given id
+	removedSearch, err := todoList.RemoveSearch(idValue)
+
+	if err != nil {
+		log.Printf("Saved search with id %v not found, could not be deleted", idValue)
+		writeError(w, r, err)
+	} else {
+		json.NewEncoder(w).Encode(*removedSearch)
+		log.Printf("DELETE /search?id=%v (200 OK)", idValue)
+	}
+}
+
+/*
+ * Evaluates the saved search with the id given in the url parameter
+ * returns all todos of the todo list that currently match the saved search
+ */
+func GetSearchTodos(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// get id from url
+	idValue, err := getIdFromUrl(r)
+
+	// if an error occurs while extracting the id from the url -> 400 Bad Request
+	if err != nil {
+		log.Print(err.Error())
+		writeError(w, r, err)
+		return
+	}
+
+	// get saved search with given id
+	search := todoList.GetSearchById(idValue)
+
+	if search == nil {
+		log.Printf("saved search with id %v not found", idValue)
+		writeError(w, r, fmt.Errorf("%w: saved search with id %v", stores.ErrNotFound, idValue))
+		return
+	}
+
+	// run the filter of the saved search against the live todo list
+	json.NewEncoder(w).Encode(todoList.FilterTodos(search.Filter))
+	log.Printf("GET /search/todos?id=%v (200 OK)", idValue)
+}
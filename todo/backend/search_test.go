@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// a saved search is evaluated against the current todos of the list every time
+func TestSearchTodosAreLive(t *testing.T) {
+	server := newTestServer(t)
+	token := newTestListToken(t, server.URL)
+
+	_, body := testRequest(t, server.URL, "POST", "/search", token, `{"name":"open shopping","filter":{"category":["shop"],"done":false}}`)
+	search := struct{ Id int }{}
+	json.Unmarshal([]byte(body), &search)
+	searchPath := fmt.Sprintf("/search/todos?id=%v", search.Id)
+
+	// returns the names of the todos of the saved search
+	matching := func() []string {
+		status, body := testRequest(t, server.URL, "GET", searchPath, token, "")
+		if status != http.StatusOK {
+			t.Fatalf("GET %v: got %v: %v", searchPath, status, body)
+		}
+		todos := []struct{ Name string }{}
+		json.Unmarshal([]byte(body), &todos)
+		names := []string{}
+		for _, matchingTodo := range todos {
+			names = append(names, matchingTodo.Name)
+		}
+		return names
+	}
+
+	if names := matching(); len(names) != 0 {
+		t.Errorf("empty list: got %v", names)
+	}
+
+	_, body = testRequest(t, server.URL, "POST", "/todo", token, `{"name":"milk","category":["shop"]}`)
+	milk := struct{ Id int }{}
+	json.Unmarshal([]byte(body), &milk)
+	testRequest(t, server.URL, "POST", "/todo", token, `{"name":"taxes","category":["work"]}`)
+	testRequest(t, server.URL, "POST", "/todo", token, `{"name":"bread","category":["Shop"]}`)
+
+	if names := matching(); fmt.Sprint(names) != "[bread milk]" {
+		t.Errorf("got %v, want [bread milk]", names)
+	}
+
+	testRequest(t, server.URL, "PUT", fmt.Sprintf("/todo/%v", milk.Id), token, `{"name":"milk","category":["shop"],"done":true}`)
+	if names := matching(); fmt.Sprint(names) != "[bread]" {
+		t.Errorf("after milk was done: got %v, want [bread]", names)
+	}
+
+	testRequest(t, server.URL, "DELETE", fmt.Sprintf("/search?id=%v", search.Id), token, "")
+	if status, body := testRequest(t, server.URL, "GET", searchPath, token, ""); status != http.StatusNotFound {
+		t.Errorf("removed search: got %v: %v", status, body)
+	}
+}
@@ -0,0 +1,90 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * Share links
+ * the owner of a list mints share tokens that are sent as bearer token instead of the list id,
+ * they open the list read-only (scope read) or allow to mark todos as done (scope complete),
+ * can expire or be limited to a number of requests and are revoked by the owner
+ */
+
+/*
+ * Returns all share links of the todo list (without their tokens)
+ */
+func GetShareLinks(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+	json.NewEncoder(w).Encode(todoList.GetShareLinks())
+	log.Println("GET /shares (200 OK)")
+}
+
+/*
+ * Uses the request body (scope, expiresAt, maxUses) to create a new share link of the todo list
+ * returns the created share link, the only response that contains its token
+ */
+func PostShareLink(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode json from request body
+	link, err := stores.ShareLinkFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	// add share link to the todo list
+	newShareLink, err := todoList.AddShareLink(*link)
+
+	if err != nil {
+		log.Printf("Share link could not be added: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// send created share link back
+	w.Header().Set("Location", apiPath(r, "/shares/%v", newShareLink.Id))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newShareLink)
+	log.Printf("POST /shares (201 Created, id %v)", newShareLink.Id)
+}
+
+/*
+ * Uses the id given in the url path to revoke the corresponding share link
+ * returns the share link that was revoked, its token can not be used anymore
+ */
+func DeleteShareLink(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// get id from url
+	idValue, err := getIdFromPath(r)
+
+	// if an error occurs while extracting the id from the url -> 400 Bad Request
+	if err != nil {
+		log.Print(err.Error())
+		writeError(w, r, err)
+		return
+	}
+
+	revokedShareLink, err := todoList.RemoveShareLink(idValue)
+
+	if err != nil {
+		log.Printf("Share link with id %v not found, could not be revoked", idValue)
+		writeError(w, r, err)
+	} else {
+		json.NewEncoder(w).Encode(revokedShareLink)
+		log.Printf("DELETE /shares/%v (200 OK)", idValue)
+	}
+}
@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"klaemsch.io/todo/stores"
+)
+
+// sends a request to the test server and returns the status and the body (streams are not read)
+func testRequest(t *testing.T, serverUrl string, method string, path string, token string, body string) (int, string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, method, serverUrl+"/api/v1"+path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("%v %v: %v", method, path, err)
+	}
+	defer response.Body.Close()
+	if response.Header.Get("Content-Type") == "text/event-stream" {
+		return response.StatusCode, ""
+	}
+	responseBody, _ := io.ReadAll(response.Body)
+	return response.StatusCode, string(responseBody)
+}
+
+// returns the id of the list of a graphql response to { list { id } }
+func graphqlListId(body []byte) string {
+	decoded := struct {
+		Data struct{ List struct{ Id string } }
+	}{}
+	json.Unmarshal(body, &decoded)
+	return decoded.Data.List.Id
+}
+
+// returns the id of the list, it is only sent to owners
+func testListId(t *testing.T, serverUrl string, token string) string {
+	t.Helper()
+	_, body := testRequest(t, serverUrl, "POST", "/graphql", token, `{"query":"{ list { id } }"}`)
+	return graphqlListId([]byte(body))
+}
+
+// new lists are opened with their initial access token, the id is no credential of the list
+func TestNewListIssuesAccessToken(t *testing.T) {
+	server := newTestServer(t)
+
+	_, body := testRequest(t, server.URL, "GET", "/list", "", "")
+	token := strings.TrimSpace(body)
+	if len(token) != stores.AccessTokenLength {
+		t.Fatalf("got %q, want an access token", token)
+	}
+	listId := testListId(t, server.URL, token)
+	if listId == "" || listId == token {
+		t.Fatalf("got list id %q for token %q", listId, token)
+	}
+
+	if status, body := testRequest(t, server.URL, "GET", "/todo", listId, ""); status != http.StatusForbidden {
+		t.Errorf("GET /todo with the id: got %v: %v", status, body)
+	}
+	if status, body := testRequest(t, server.URL, "GET", "/todo", token, ""); status != http.StatusOK {
+		t.Errorf("GET /todo with the token: got %v: %v", status, body)
+	}
+}
+
+// holders of a share link never get the id or another owner credential
+func TestShareLinkGetsNoOwnerCredential(t *testing.T) {
+	server := newTestServer(t)
+
+	_, body := testRequest(t, server.URL, "GET", "/list", "", "")
+	ownerToken := strings.TrimSpace(body)
+	listId := testListId(t, server.URL, ownerToken)
+	testRequest(t, server.URL, "POST", "/todo", ownerToken, `{"name":"milk"}`)
+
+	for _, scope := range []string{"read", "complete"} {
+		status, body := testRequest(t, server.URL, "POST", "/shares", ownerToken, `{"scope":"`+scope+`"}`)
+		share := struct{ Token string }{}
+		if json.Unmarshal([]byte(body), &share); status != http.StatusCreated || share.Token == "" {
+			t.Fatalf("%v: share link could not be created: %v %v", scope, status, body)
+		}
+
+		// no response the share link can read contains the id
+		for route := range operationDocs {
+			method, path, _ := strings.Cut(route, " ")
+			if method != "GET" || strings.Contains(path, "{") || path == "/list" {
+				continue
+			}
+			if _, body := testRequest(t, server.URL, method, path, share.Token, ""); strings.Contains(body, listId) || strings.Contains(body, ownerToken) {
+				t.Errorf("%v: %v sends the id of the list: %v", scope, route, body)
+			}
+		}
+		_, body = testRequest(t, server.URL, "POST", "/graphql", share.Token, `{"query":"{ list { id version todos { name } } }"}`)
+		if strings.Contains(body, listId) || !strings.Contains(body, `"id":null`) {
+			t.Errorf("%v: graphql sends the id of the list: %v", scope, body)
+		}
+
+		// owner credentials are not issued to share links
+		for _, attempt := range []struct{ path, body string }{
+			{"/tokens", `{"name":"stolen"}`},
+			{"/auth/token", ""},
+			{"/shares", `{"scope":"complete"}`},
+		} {
+			if status, body := testRequest(t, server.URL, "POST", attempt.path, share.Token, attempt.body); status != http.StatusForbidden {
+				t.Errorf("%v: POST %v got %v: %v", scope, attempt.path, status, body)
+			}
+		}
+	}
+
+	// the owner still gets the id
+	if testListId(t, server.URL, ownerToken) != listId {
+		t.Errorf("graphql does not send the id to the owner")
+	}
+}
@@ -0,0 +1,43 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * Delta sync of offline clients (see stores/sync.go for the conflict rules)
+ * the client sends its last sync token and the changes it made offline,
+ * returns the changes of the list since the sync token, a result for every change of the client
+ * and the sync token for the next sync
+ * changes with conflicts or invalid todos do not fail the request, they are reported in their result
+ */
+func PostSync(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode sync token and changes from request body
+	request, err := stores.SyncFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	response := todoList.Sync(request)
+
+	// send changes and results back with the new version of the list
+	setETag(w, todoList.Version)
+	json.NewEncoder(w).Encode(response)
+	log.Printf("POST /sync (200 OK, %v changes sent, %v changes received)", len(response.Changes), len(response.Results))
+}
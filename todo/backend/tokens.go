@@ -0,0 +1,118 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * Access tokens
+ * the owner of a list issues named tokens (e.g. one per device) that are sent as bearer token instead of the list id,
+ * they are stored hashed, can be rotated and revoked and record when they were used the last time;
+ * after the first access token the id of the list is not accepted as token anymore
+ */
+
+/*
+ * Returns all access tokens of the todo list (without the tokens)
+ */
+func GetAccessTokens(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+	json.NewEncoder(w).Encode(todoList.GetAccessTokens())
+	log.Println("GET /tokens (200 OK)")
+}
+
+/*
+ * Uses the request body (name) to issue a new access token of the todo list
+ * returns the created access token, the only response that contains the token
+ */
+func PostAccessToken(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode json from request body
+	credential, err := stores.AccessTokenFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	// add access token to the todo list
+	newAccessToken, err := todoList.AddAccessToken(*credential)
+
+	if err != nil {
+		log.Printf("Access token could not be issued: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// send created access token back
+	w.Header().Set("Location", apiPath(r, "/tokens/%v", newAccessToken.Id))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newAccessToken)
+	log.Printf("POST /tokens (201 Created, id %v)", newAccessToken.Id)
+}
+
+/*
+ * Replaces the token of the access token with the id given in the url path (/tokens/{id}/rotate)
+ * returns the access token with the new token, the old token can not be used anymore
+ */
+func PostRotateAccessToken(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// get id from url
+	idValue, err := getIdFromPath(r)
+
+	// if an error occurs while extracting the id from the url -> 400 Bad Request
+	if err != nil {
+		log.Print(err.Error())
+		writeError(w, r, err)
+		return
+	}
+
+	rotatedAccessToken, err := todoList.RotateAccessToken(idValue)
+
+	if err != nil {
+		log.Printf("Access token with id %v could not be rotated: %v", idValue, err)
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rotatedAccessToken)
+	log.Printf("POST /tokens/%v/rotate (200 OK)", idValue)
+}
+
+/*
+ * Uses the id given in the url path to revoke the corresponding access token
+ * returns the access token that was revoked, the last access token of a list without owner can not be revoked
+ */
+func DeleteAccessToken(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// get id from url
+	idValue, err := getIdFromPath(r)
+
+	// if an error occurs while extracting the id from the url -> 400 Bad Request
+	if err != nil {
+		log.Print(err.Error())
+		writeError(w, r, err)
+		return
+	}
+
+	revokedAccessToken, err := todoList.RemoveAccessToken(idValue)
+
+	if err != nil {
+		log.Printf("Access token with id %v could not be revoked: %v", idValue, err)
+		writeError(w, r, err)
+	} else {
+		json.NewEncoder(w).Encode(revokedAccessToken)
+		log.Printf("DELETE /tokens/%v (200 OK)", idValue)
+	}
+}
@@ -0,0 +1,291 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * User accounts and sessions
+ * users register with username and password (POST /users) and log in (POST /sessions),
+ * the token of the session is sent as bearer token like the id of a list;
+ * lists created with a session belong to the user and can only be opened with a session of the user,
+ * the list of a request is named with the X-Todo-List header (or the list url parameter of streams)
+ * lists without owner are opened by their access tokens, legacy lists also by their id
+ */
+
+// key of the user of a session in the context of a request
+type userKey struct{}
+
+// key of the role of the user on the list of a request (see members.go)
+type roleKey struct{}
+
+// key of the credential of a request that can be exchanged for a JWT (see jwt.go)
+type credentialKey struct{}
+
+/* Returns the user of the session of a request
+ * returns nil for requests with a list token
+ */
+func userFromRequest(r *http.Request) *stores.User {
+	user, _ := r.Context().Value(userKey{}).(*stores.User)
+	return user
+}
+
+/* Adds the role and the credential of the request to its context
+ * role:		role of the token on the list
+ * credential:	credential of the request, can be exchanged for a JWT (stores.CredentialList, access:<id>, user:<id>),
+ *				"" for share links and JWTs
+ */
+func withAccess(r *http.Request, role string, credential string) *http.Request {
+	ctx := context.WithValue(r.Context(), roleKey{}, role)
+	return r.WithContext(context.WithValue(ctx, credentialKey{}, credential))
+}
+
+// returns the list named by the request: the {listId} path parameter, the X-Todo-List header or the list url parameter
+func requestedListId(r *http.Request) string {
+	listId := r.PathValue("listId")
+	if listId == "" {
+		listId = r.Header.Get("X-Todo-List")
+	}
+	if listId == "" {
+		listId = r.URL.Query().Get("list")
+	}
+	return listId
+}
+
+/* Looks up the todo list of a request and checks the access of the token to the list
+ * list token (32 chars):		the list with this id, only if it does not belong to a user and has no access tokens
+ * access token (40 chars):		the list of the access token with the owner role (see tokens.go)
+ * share token (48 chars):		the list of the share link with the role of its scope (see shares.go)
+ * session token (64 chars):	the list named by the {listId} path parameter, the X-Todo-List header
+ *								or the list url parameter, only if the user of the session owns it
+ *								or the list was shared with the user
+ * JWT (header.claims.signature):	the list of the list claim with the role claim (see jwt.go)
+ * returns: the todo list, the request with the user of the session and its role in its context, or error
+ */
+func resolveTodoList(r *http.Request, token string) (*stores.TodoList, *http.Request, error) {
+
+	if stores.IsJWT(token) {
+		return resolveJWT(r, token)
+	}
+
+	if len(token) == stores.ShareTokenLength {
+		// expired, used up and revoked links are rejected like unknown tokens
+		todoList, role := stores.UseShareLink(token)
+		if todoList == nil {
+			return nil, r, fmt.Errorf("%w: unknown, expired or revoked share link", errForbidden)
+		}
+		return todoList, withAccess(r, role, ""), nil
+	}
+
+	if len(token) == stores.AccessTokenLength {
+		// rotated and revoked tokens are rejected like unknown tokens
+		todoList, accessTokenId := stores.UseAccessToken(token)
+		if todoList == nil {
+			return nil, r, fmt.Errorf("%w: unknown or revoked access token", errForbidden)
+		}
+		return todoList, withAccess(r, stores.RoleOwner, fmt.Sprintf("%v:%v", stores.CredentialAccessToken, accessTokenId)), nil
+	}
+
+	if len(token) != stores.SessionTokenLength {
+		// checks if the token / listId is in the todo list store, only legacy lists without access tokens are opened by their id
+		todoList := stores.GetTodoListByIdToken(token)
+		if todoList == nil {
+			return nil, r, fmt.Errorf("%w: unknown token", errForbidden)
+		}
+		if todoList.Owner != "" {
+			return nil, r, fmt.Errorf("%w: the list belongs to a user, log in to open it", errForbidden)
+		}
+		// the list token grants full control of the list
+		return todoList, withAccess(r, stores.RoleOwner, stores.CredentialList), nil
+	}
+
+	user := stores.GetUserOfSession(token)
+	if user == nil {
+		return nil, r, fmt.Errorf("%w: unknown or expired session", errUnauthorized)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+
+	// the list of the request
+	listId := requestedListId(r)
+	if listId == "" {
+		return nil, r, fmt.Errorf("%w: name the list with the X-Todo-List header", errBadRequest)
+	}
+
+	// lists that were not shared with the user are reported as not found
+	todoList := stores.GetTodoListById(listId)
+	if todoList == nil {
+		return nil, r, fmt.Errorf("%w: todo list %v", stores.ErrNotFound, listId)
+	}
+
+	// the members of the list are changed while the list is locked
+	todoList.Lock()
+	role := todoList.RoleOf(user.Id)
+	todoList.Unlock()
+
+	if role == "" {
+		return nil, r, fmt.Errorf("%w: todo list %v", stores.ErrNotFound, listId)
+	}
+	return todoList, withAccess(r, role, fmt.Sprintf("%v:%v", stores.CredentialUser, user.Id)), nil
+}
+
+/* Looks up the todo list of a JWT
+ * signature, expiry and audience are checked by the stores, the list named by the request has to be the list claim;
+ * tokens of users only keep the role the user still has on the list
+ * returns: the todo list, the request with the user and the role in its context, or error (401 Unauthorized)
+ */
+func resolveJWT(r *http.Request, token string) (*stores.TodoList, *http.Request, error) {
+
+	claims, err := stores.VerifyJWT(token)
+	if err != nil {
+		return nil, r, fmt.Errorf("%w: %v", errUnauthorized, err)
+	}
+
+	todoList := stores.GetTodoListById(claims.List)
+	if todoList == nil {
+		return nil, r, fmt.Errorf("%w: the list of the token does not exist", errUnauthorized)
+	}
+	if listId := requestedListId(r); listId != "" && listId != claims.List {
+		return nil, r, fmt.Errorf("%w: todo list %v", stores.ErrNotFound, listId)
+	}
+
+	role := claims.Role
+	if claims.Subject != "" {
+		user := stores.GetUserById(claims.Subject)
+		if user == nil {
+			return nil, r, fmt.Errorf("%w: the user of the token does not exist", errUnauthorized)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+
+		// the list may have been unshared since the token was issued
+		todoList.Lock()
+		role = stores.LowerRole(role, todoList.RoleOf(user.Id))
+		todoList.Unlock()
+
+		if role == "" {
+			return nil, r, fmt.Errorf("%w: todo list %v", stores.ErrNotFound, claims.List)
+		}
+	}
+	return todoList, withAccess(r, role, ""), nil
+}
+
+/*
+ * Creates a new user account with the username and password of the request body
+ * returns the created user
+ */
+func PostUser(w http.ResponseWriter, r *http.Request) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode and validate username and password from request body
+	request, err := stores.CredentialsFromJson(r, true)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	// create the account, the username has to be unique
+	newUser, err := stores.RegisterUser(request)
+
+	if err != nil {
+		log.Printf("User could not be registered: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// send created user back
+	w.Header().Set("Location", apiPath(r, "/users/me"))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newUser)
+	log.Printf("POST /users (201 Created, %v)", newUser.Username)
+}
+
+/*
+ * Logs a user in with the username and password of the request body
+ * returns the new session, its token is sent as bearer token with the following requests
+ */
+func PostSession(w http.ResponseWriter, r *http.Request) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode username and password from request body
+	request, err := stores.CredentialsFromJson(r, false)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	// usernames with too many failed logins have to wait, so passwords can not be guessed
+	if delay := stores.LoginDelay(request.Username); delay > 0 {
+		seconds := int(math.Ceil(delay.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		log.Printf("POST /sessions (429 Too Many Requests, %v)", request.Username)
+		writeError(w, r, fmt.Errorf("%w: too many failed logins, try again in %v seconds", errTooManyRequests, seconds))
+		return
+	}
+
+	// unknown usernames and wrong passwords get the same response
+	user := stores.AuthenticateUser(request)
+	stores.RecordLogin(request.Username, user != nil)
+
+	if user == nil {
+		log.Println("POST /sessions (401 Unauthorized)")
+		writeError(w, r, fmt.Errorf("%w: wrong username or password", errUnauthorized))
+		return
+	}
+
+	newSession, err := stores.NewSession(user)
+
+	if err != nil {
+		log.Printf("Error while creating session: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// send the session back
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newSession)
+	log.Printf("POST /sessions (201 Created, %v)", user.Username)
+}
+
+/*
+ * Logs the user out, the token of the session can not be used anymore
+ */
+func DeleteSession(w http.ResponseWriter, r *http.Request, user *stores.User) {
+
+	// USER already checked the token
+	token, _ := GetTokenFromRequest(r)
+	stores.RemoveSession(token)
+
+	w.WriteHeader(http.StatusNoContent)
+	log.Printf("DELETE /sessions (204 No Content, %v)", user.Username)
+}
+
+/*
+ * Returns the account of the logged in user with the ids of its lists
+ */
+func GetMe(w http.ResponseWriter, r *http.Request, user *stores.User) {
+	json.NewEncoder(w).Encode(user.Profile())
+	log.Printf("GET /users/me (200 OK, %v)", user.Username)
+}
@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+ * Versions of the api
+ * every version registers its routes under /api/<version>/..., all versions share the stores package
+ * a new version (e.g. v2) starts with the routes of the previous version and replaces the handlers that change:
+ *
+ *	v2 := v1.With(backend.Routes{"GET /todo/{id}": backend.CORS(backend.AUTH(backend.GetTodoByIdV2))})
+ *	backend.RegisterVersion("v2", v2)
+ *
+ * the unversioned legacy routes (/api/...) are mapped to v1 and marked as deprecated
+ */
+
+// routes of a version of the api by pattern, the patterns do not contain the /api/<version> prefix
+type Routes map[string]http.HandlerFunc
+
+/* Returns a copy of the routes with some routes replaced or added
+ * overrides:	routes that replace the route with the same pattern, or are added if the pattern is new
+ */
+func (routes Routes) With(overrides Routes) Routes {
+
+	result := Routes{}
+	for pattern, handler := range routes {
+		result[pattern] = handler
+	}
+	for pattern, handler := range overrides {
+		result[pattern] = handler
+	}
+	return result
+}
+
+// returns the patterns of the routes in a stable order
+func (routes Routes) patterns() []string {
+	patterns := make([]string, 0, len(routes))
+	for pattern := range routes {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// key of the api path prefix (e.g. /api/v1) in the request context
+type versionPrefixKey struct{}
+
+/* Registers the routes of a version under /api/<version>
+ * version:	name of the version, e.g. "v1"
+ * routes:	routes of the version
+ */
+func RegisterVersion(version string, routes Routes) {
+	prefix := "/api/" + version
+	for _, pattern := range routes.patterns() {
+		method, path, _ := strings.Cut(pattern, " ")
+		handleFunc(method+" "+prefix+path, pattern, false, withVersionPrefix(prefix, routes[pattern]))
+	}
+}
+
+/* Registers the routes of a version under the unversioned /api prefix
+ * responses of these routes carry Deprecation, Sunset and Link headers pointing to the versioned route
+ * version:	name of the version the legacy routes are mapped to, e.g. "v1"
+ * routes:	routes of the version
+ * sunset:	date after which the legacy routes may be removed
+ */
+func RegisterLegacy(version string, routes Routes, sunset time.Time) {
+	prefix := "/api/" + version
+	for _, pattern := range routes.patterns() {
+		method, path, _ := strings.Cut(pattern, " ")
+		handleFunc(method+" /api"+path, pattern, true, LEGACY(prefix, sunset, withVersionPrefix(prefix, routes[pattern])))
+	}
+}
+
+/* http Middleware for marking the responses of legacy routes as deprecated
+ * prefix:	prefix of the versioned route that replaces the legacy route
+ * sunset:	date after which the legacy route may be removed
+ */
+func LEGACY(prefix string, sunset time.Time, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		setDeprecationHeaders(w, prefix+r.URL.Path[len("/api"):])
+		next(w, r)
+	}
+}
+
+// stores the prefix of the version in the request context, so handlers can create links to their version
+func withVersionPrefix(prefix string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), versionPrefixKey{}, prefix)))
+	}
+}
+
+/* Creates the path of a resource in the version of the request
+ * format:	path without prefix, e.g. "/todo/%v"
+ * returns:	path with prefix, e.g. "/api/v1/todo/5"
+ */
+func apiPath(r *http.Request, format string, args ...interface{}) string {
+	prefix, ok := r.Context().Value(versionPrefixKey{}).(string)
+	if !ok {
+		prefix = "/api/v1"
+	}
+	return prefix + fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,83 @@
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// responses of legacy routes name the versioned route and the date the legacy route may be removed
+func TestLegacyHeaders(t *testing.T) {
+	sunset := time.Date(2030, time.January, 31, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	handler := LEGACY("/api/v1", sunset, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest("GET", "/api/todo/5?verbose=true", nil))
+
+	want := map[string]string{
+		"Deprecation": "true",
+		"Sunset":      "Thu, 31 Jan 2030 11:00:00 GMT",
+		"Link":        `</api/v1/todo/5>; rel="successor-version"`,
+	}
+	for header, value := range want {
+		if got := recorder.Header().Get(header); got != value {
+			t.Errorf("%v: got %q, want %q", header, got, value)
+		}
+	}
+	if recorder.Code != http.StatusTeapot {
+		t.Errorf("the handler was not called, got %v", recorder.Code)
+	}
+}
+
+// the unversioned routes answer like v1 with deprecation headers, the v1 routes without them
+func TestLegacyRoutes(t *testing.T) {
+	server := newTestServer(t)
+	token := newTestListToken(t, server.URL)
+
+	legacy, legacyBody := testResponse(t, server.URL, "GET", "/api/todo", token, "")
+	versioned, versionedBody := testResponse(t, server.URL, "GET", "/api/v1/todo", token, "")
+
+	if legacy.StatusCode != http.StatusOK || legacyBody != versionedBody {
+		t.Errorf("legacy route: got %v %v, want %v", legacy.StatusCode, legacyBody, versionedBody)
+	}
+	if legacy.Header.Get("Deprecation") != "true" || legacy.Header.Get("Link") != `</api/v1/todo>; rel="successor-version"` {
+		t.Errorf("legacy route: got Deprecation %q and Link %q", legacy.Header.Get("Deprecation"), legacy.Header.Get("Link"))
+	}
+	if sunset, err := http.ParseTime(legacy.Header.Get("Sunset")); err != nil || !sunset.After(time.Now()) {
+		t.Errorf("legacy route: got Sunset %q (%v)", legacy.Header.Get("Sunset"), err)
+	}
+	for _, header := range []string{"Deprecation", "Sunset", "Link"} {
+		if versioned.Header.Get(header) != "" {
+			t.Errorf("versioned route: got %v %q", header, versioned.Header.Get(header))
+		}
+	}
+
+	// links of legacy responses point to the versioned resource
+	created, _ := testResponse(t, server.URL, "POST", "/api/todo", token, `{"name":"milk"}`)
+	if location := created.Header.Get("Location"); !strings.HasPrefix(location, "/api/v1/todo/") {
+		t.Errorf("legacy POST /todo: got Location %q", location)
+	}
+}
+
+// a new version replaces single routes and keeps the others
+func TestRoutesWith(t *testing.T) {
+	v1 := V1Routes()
+	replacement := func(w http.ResponseWriter, r *http.Request) {}
+	v2 := v1.With(Routes{"GET /todo/{id}": replacement, "GET /todo/{id}/history": replacement})
+
+	if len(v2) != len(v1)+1 {
+		t.Errorf("got %v routes, want %v", len(v2), len(v1)+1)
+	}
+	recorder := httptest.NewRecorder()
+	v2["GET /todo/{id}"](recorder, httptest.NewRequest("GET", "/todo/1", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.Len() != 0 {
+		t.Errorf("the route was not replaced")
+	}
+	if v1["GET /todo/{id}"] == nil || len(V1Routes()) != len(v1) {
+		t.Errorf("the routes of v1 were changed")
+	}
+}
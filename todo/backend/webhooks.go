@@ -0,0 +1,175 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * Returns all webhooks of the todo list (without their secrets)
+ */
+func GetWebhooks(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+	json.NewEncoder(w).Encode(todoList.GetWebhooks())
+	log.Println("GET /webhooks (200 OK)")
+}
+
+/*
+ * Uses the request body to create a new webhook in the todo list
+ * returns the created webhook, the only response that contains its secret
+ */
+func PostWebhook(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// check if body is empty -> send 400 Bad Request back
+	if r.Body == nil {
+		log.Println("Request body is nil")
+		writeError(w, r, fmt.Errorf("%w: request body is nil", errBadRequest))
+		return
+	}
+
+	// decode json from request body
+	hook, err := stores.NewWebhookFromJson(r)
+
+	if err != nil {
+		log.Printf("Error while decoding body: %v", err)
+		writeError(w, r, decodeError(err))
+		return
+	}
+
+	// add webhook to the todo list
+	newWebhook, err := todoList.AddWebhook(*hook)
+
+	if err != nil {
+		log.Printf("Webhook could not be added: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	// send created webhook back
+	w.Header().Set("Location", apiPath(r, "/webhooks/%v", newWebhook.Id))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newWebhook)
+	log.Printf("POST /webhooks (201 Created, id %v)", newWebhook.Id)
+}
+
+/*
+ * Returns the webhook with the id given in the url path (/webhooks/{id})
+ */
+func GetWebhookById(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// get id from url
+	idValue, err := getIdFromPath(r)
+
+	// if an error occurs while extracting the id from the url -> 400 Bad Request
+	if err != nil {
+		log.Print(err.Error())
+		writeError(w, r, err)
+		return
+	}
+
+	hook := todoList.GetWebhookById(idValue)
+
+	if hook == nil {
+		log.Printf("webhook with id %v not found", idValue)
+		writeError(w, r, fmt.Errorf("%w: webhook with id %v", stores.ErrNotFound, idValue))
+		return
+	}
+
+	json.NewEncoder(w).Encode(hook)
+	log.Printf("GET /webhooks/%v (200 OK)", idValue)
+}
+
+/*
+ * Uses the id given in the url path to delete the corresponding webhook
+ * returns the webhook that was deleted, its pending deliveries are not sent anymore
+ */
+func DeleteWebhook(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// get id from url
+	idValue, err := getIdFromPath(r)
+
+	// if an error occurs while extracting the id from the url -> 400 Bad Request
+	if err != nil {
+		log.Print(err.Error())
+		writeError(w, r, err)
+		return
+	}
+
+	removedWebhook, err := todoList.RemoveWebhook(idValue)
+
+	if err != nil {
+		log.Printf("Webhook with id %v not found, could not be deleted", idValue)
+		writeError(w, r, err)
+	} else {
+		json.NewEncoder(w).Encode(removedWebhook)
+		log.Printf("DELETE /webhooks/%v (200 OK)", idValue)
+	}
+}
+
+/*
+ * Returns the recorded deliveries of the webhook with the id given in the url path, the latest delivery first
+ */
+func GetDeliveries(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// get id from url
+	idValue, err := getIdFromPath(r)
+
+	// if an error occurs while extracting the id from the url -> 400 Bad Request
+	if err != nil {
+		log.Print(err.Error())
+		writeError(w, r, err)
+		return
+	}
+
+	if todoList.GetWebhookById(idValue) == nil {
+		log.Printf("webhook with id %v not found", idValue)
+		writeError(w, r, fmt.Errorf("%w: webhook with id %v", stores.ErrNotFound, idValue))
+		return
+	}
+
+	json.NewEncoder(w).Encode(todoList.GetDeliveries(idValue))
+	log.Printf("GET /webhooks/%v/deliveries (200 OK)", idValue)
+}
+
+/*
+ * Sends a recorded delivery to its webhook again (/webhooks/{id}/deliveries/{deliveryId}/redeliver)
+ * returns the delivery, its new attempts are recorded like the attempts of new deliveries
+ */
+func PostRedeliver(w http.ResponseWriter, r *http.Request, todoList *stores.TodoList) {
+
+	// get id of the webhook from url
+	idValue, err := getIdFromPath(r)
+
+	// if an error occurs while extracting the id from the url -> 400 Bad Request
+	if err != nil {
+		log.Print(err.Error())
+		writeError(w, r, err)
+		return
+	}
+
+	// get id of the delivery from url
+	deliveryId, err := getNumberFromPath(r, "deliveryId")
+
+	if err != nil {
+		log.Print(err.Error())
+		writeError(w, r, err)
+		return
+	}
+
+	// send the delivery again, a pending delivery can not be sent again -> 409 Conflict
+	redelivery, err := todoList.Redeliver(idValue, deliveryId)
+
+	if err != nil {
+		log.Printf("Delivery %v of webhook %v could not be sent again: %v", deliveryId, idValue, err)
+		writeError(w, r, err)
+		return
+	}
+
+	// the delivery is sent in the background
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(redelivery)
+	log.Printf("POST /webhooks/%v/deliveries/%v/redeliver (202 Accepted)", idValue, deliveryId)
+}
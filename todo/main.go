@@ -3,8 +3,13 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"klaemsch.io/todo/backend"
+	"klaemsch.io/todo/rpc"
+	"klaemsch.io/todo/stores"
 )
 
 /*
@@ -15,15 +20,39 @@ import (
  * but for now this way is sufficient
  */
 
+// date after which the unversioned /api/... routes may be removed
+var legacySunset = time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+
 // https://pkg.go.dev/net/http#hdr-Patterns
 func main() {
-	http.HandleFunc("OPTIONS /api/todo", backend.CORS(nil))
-	http.HandleFunc("GET /api/todo", backend.CORS(backend.AUTH(backend.GetTodo)))
-	http.HandleFunc("POST /api/todo", backend.CORS(backend.AUTH(backend.PostTodo)))
-	http.HandleFunc("PUT /api/todo", backend.CORS(backend.AUTH(backend.PutTodo)))
-	http.HandleFunc("DELETE /api/todo", backend.CORS(backend.AUTH(backend.DeleteTodo)))
-	http.HandleFunc("OPTIONS /api/list", backend.CORS(nil))
-	http.HandleFunc("GET /api/list", backend.CORS(backend.NewTodoList))
+
+	// routes of version 1 of the api, registered under /api/v1/...
+	v1 := backend.V1Routes()
+
+	// signed access tokens use Ed25519 keys of the server, unless HS256 secrets shared with a gateway are configured
+	// TODO_JWT_SECRETS is a comma separated list, the first secret signs and all of them verify (rotation)
+	var jwtSecrets []string
+	if secrets := os.Getenv("TODO_JWT_SECRETS"); secrets != "" {
+		jwtSecrets = strings.Split(secrets, ",")
+	}
+	if err := stores.ConfigureJWT(os.Getenv("TODO_JWT_ALGORITHM"), jwtSecrets); err != nil {
+		log.Fatal(err)
+	}
+
+	// new lists are opened with an access token, TODO_LEGACY_ID_ACCESS=true lets old clients open them by their id
+	stores.LegacyIdAccess = os.Getenv("TODO_LEGACY_ID_ACCESS") == "true"
+
+	backend.RegisterVersion("v1", v1)
+
+	// the unversioned routes of the first releases are aliases of v1 until the sunset date
+	backend.RegisterLegacy("v1", v1, legacySunset)
+
+	// the gRPC api uses the same stores on its own port
+	go func() {
+		log.Println("gRPC server started on port 9000")
+		log.Fatal(rpc.ListenAndServe(":9000"))
+	}()
+
 	log.Println("Server started on port 8000")
 	log.Fatal(http.ListenAndServe(":8000", nil))
 }
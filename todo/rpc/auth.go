@@ -0,0 +1,251 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"klaemsch.io/todo/stores"
+)
+
+// methods that can be called without a token
+var publicMethods = map[string]bool{
+	TodoService_CreateList_FullMethodName: true,
+}
+
+/* minimum role of the token on the list for each method, like the ROLE middleware of the http api
+ * methods that are not listed need the owner role
+ */
+var methodRoles = map[string]string{
+	TodoService_ListTodos_FullMethodName:  stores.RoleViewer,
+	TodoService_GetTodo_FullMethodName:    stores.RoleViewer,
+	TodoService_WatchTodos_FullMethodName: stores.RoleViewer,
+	// completers can only mark todos as done or not done, the other changes are checked by UpdateTodo
+	TodoService_UpdateTodo_FullMethodName: stores.RoleCompleter,
+	TodoService_CreateTodo_FullMethodName: stores.RoleEditor,
+	TodoService_DeleteTodo_FullMethodName: stores.RoleEditor,
+	TodoService_MoveTodo_FullMethodName:   stores.RoleEditor,
+}
+
+// key of the todo list of the token in the context of a call
+type todoListKey struct{}
+
+// key of the role of the token on the todo list in the context of a call
+type roleKey struct{}
+
+// returns the todo list of the token of the call
+func todoListFromContext(ctx context.Context) *stores.TodoList {
+	return ctx.Value(todoListKey{}).(*stores.TodoList)
+}
+
+// returns the role of the token of the call on its todo list
+func roleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(roleKey{}).(string)
+	return role
+}
+
+// extracts the token from the metadata of the call ("authorization: Bearer <token>")
+func tokenFromContext(ctx context.Context) (string, error) {
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) != 1 {
+		return "", status.Error(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	token, found := strings.CutPrefix(values[0], "Bearer ")
+	if !found {
+		return "", status.Error(codes.Unauthenticated, "incorrect authorization method")
+	}
+	return token, nil
+}
+
+/* Looks up the todo list and the role of the token of the call, like the AUTH middleware of the http api
+ * list token (32 chars):		the list with this id with the owner role, only legacy lists without access tokens
+ * access token (40 chars):		the list of the access token with the owner role
+ * share token (48 chars):		the list of the share link with the role of its scope
+ * JWT (header.claims.signature):	the list of the list claim with the role claim
+ * returns:	the todo list and the role or an error with the status UNAUTHENTICATED or PERMISSION_DENIED
+ */
+func authenticate(ctx context.Context) (*stores.TodoList, string, error) {
+
+	token, err := tokenFromContext(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if stores.IsJWT(token) {
+		return authenticateJWT(token)
+	}
+
+	switch len(token) {
+	case stores.ShareTokenLength:
+		// expired, used up and revoked links are rejected like unknown tokens
+		todoList, role := stores.UseShareLink(token)
+		if todoList == nil {
+			return nil, "", status.Error(codes.PermissionDenied, "unknown, expired or revoked share link")
+		}
+		return todoList, role, nil
+
+	case stores.AccessTokenLength:
+		// access tokens open every list they were issued for
+		todoList, _ := stores.UseAccessToken(token)
+		if todoList == nil {
+			return nil, "", status.Error(codes.PermissionDenied, "unknown or revoked access token")
+		}
+		return todoList, stores.RoleOwner, nil
+
+	case 32:
+		// lists of users are only opened with a session of the http api or a JWT, lists with access tokens not by their id
+		todoList := stores.GetTodoListByIdToken(token)
+		if todoList == nil {
+			return nil, "", status.Error(codes.PermissionDenied, "unknown token")
+		}
+		if todoList.Owner != "" {
+			return nil, "", status.Error(codes.PermissionDenied, "the list belongs to a user")
+		}
+		return todoList, stores.RoleOwner, nil
+	}
+
+	// sessions are only used by the http api, their users exchange them for a JWT
+	return nil, "", status.Error(codes.Unauthenticated, "incorrect authorization method")
+}
+
+/* Looks up the todo list of a JWT, like resolveJWT of the http api
+ * tokens of users only keep the role the user still has on the list
+ * returns:	the todo list and the role or an error with the status UNAUTHENTICATED or PERMISSION_DENIED
+ */
+func authenticateJWT(token string) (*stores.TodoList, string, error) {
+
+	claims, err := stores.VerifyJWT(token)
+	if err != nil {
+		return nil, "", status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	todoList := stores.GetTodoListById(claims.List)
+	if todoList == nil {
+		return nil, "", status.Error(codes.Unauthenticated, "the list of the token does not exist")
+	}
+
+	role := claims.Role
+	if claims.Subject != "" {
+		if stores.GetUserById(claims.Subject) == nil {
+			return nil, "", status.Error(codes.Unauthenticated, "the user of the token does not exist")
+		}
+
+		// the list may have been unshared since the token was issued
+		todoList.Lock()
+		role = stores.LowerRole(role, todoList.RoleOf(claims.Subject))
+		todoList.Unlock()
+
+		if role == "" {
+			return nil, "", status.Error(codes.PermissionDenied, "the list is not shared with the user of the token")
+		}
+	}
+	return todoList, role, nil
+}
+
+/* Checks that the token of a stream still opens its list, like streamAuthorized of the http api
+ * revoked share links and access tokens and users who were removed from the list do not get the changes that follow,
+ * the check does not count as a use of the share link
+ * returns:	false if the stream has to be ended
+ */
+func streamAuthorized(ctx context.Context, todoList *stores.TodoList) bool {
+
+	// the list was deleted
+	if stores.GetTodoListById(todoList.Id) != todoList {
+		return false
+	}
+
+	token, err := tokenFromContext(ctx)
+	if err != nil {
+		return false
+	}
+
+	if stores.IsJWT(token) {
+		jwtList, _, err := authenticateJWT(token)
+		return err == nil && jwtList == todoList
+	}
+
+	switch len(token) {
+	case stores.ShareTokenLength:
+		shareList, _ := stores.ActiveShareLink(token)
+		return shareList == todoList
+	case stores.AccessTokenLength:
+		return stores.ActiveAccessToken(token) == todoList
+	case 32:
+		return stores.GetTodoListByIdToken(token) == todoList
+	}
+	return false
+}
+
+/* Checks the role of the token for the method and adds the todo list and the role to the context
+ * returns:	the context or an error with the status PERMISSION_DENIED if the role is too low
+ */
+func authorize(ctx context.Context, method string, todoList *stores.TodoList, role string) (context.Context, error) {
+
+	required, found := methodRoles[method]
+	if !found {
+		required = stores.RoleOwner
+	}
+	if !stores.HasRole(role, required) {
+		return nil, status.Errorf(codes.PermissionDenied, "the %v role is required", required)
+	}
+
+	ctx = context.WithValue(ctx, todoListKey{}, todoList)
+	return context.WithValue(ctx, roleKey{}, role), nil
+}
+
+/* gRPC interceptor of unary calls, adds the todo list and the role of the token to the context
+ * the list is locked while the call is handled, like in the AUTH middleware
+ */
+func authUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+
+	if publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	todoList, role, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, err = authorize(ctx, info.FullMethod, todoList, role)
+	if err != nil {
+		return nil, err
+	}
+
+	todoList.Lock()
+	defer todoList.Unlock()
+
+	return handler(ctx, req)
+}
+
+// server stream with the context that contains the todo list
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *authenticatedStream) Context() context.Context {
+	return stream.ctx
+}
+
+/* gRPC interceptor of streaming calls, adds the todo list and the role of the token to the context
+ * the list is not locked, streams run until the client cancels them and lock the list only when they read it
+ */
+func authStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+	todoList, role, err := authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	ctx, err := authorize(stream.Context(), info.FullMethod, todoList, role)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &authenticatedStream{stream, ctx})
+}
@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"klaemsch.io/todo/stores"
+)
+
+// authenticates the token and authorizes it for the method, like the interceptors
+func authorizeToken(token string, method string) (context.Context, error) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	todoList, role, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return authorize(ctx, method, todoList, role)
+}
+
+// creates a share link of the list with the scope and returns its token
+func addTestShareLink(t *testing.T, todoList *stores.TodoList, scope string) string {
+	t.Helper()
+	newShareLink, err := stores.ShareLinkFromJson(httptest.NewRequest("POST", "/shares", strings.NewReader(`{"scope":"`+scope+`"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	todoList.Lock()
+	defer todoList.Unlock()
+	created, err := todoList.AddShareLink(*newShareLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created.Token
+}
+
+// gRPC accepts the credentials of the http api with the same roles
+func TestAuthenticateCredentials(t *testing.T) {
+	listId, initialToken, err := stores.NewTodoList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	todoList := stores.GetTodoListById(listId)
+	readLink := addTestShareLink(t, todoList, "read")
+	completeLink := addTestShareLink(t, todoList, "complete")
+	ownerJWT, _, _ := stores.IssueJWT(listId, "", stores.RoleOwner)
+	viewerJWT, _, _ := stores.IssueJWT(listId, "", stores.RoleViewer)
+	forgedJWT := ownerJWT[:strings.LastIndex(ownerJWT, ".")+1] + "c2lnbmF0dXJl"
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		want   codes.Code
+	}{
+		{"access token", initialToken.Token, TodoService_DeleteTodo_FullMethodName, codes.OK},
+		{"list id", listId, TodoService_ListTodos_FullMethodName, codes.PermissionDenied},
+		{"unknown access token", strings.Repeat("0", stores.AccessTokenLength), TodoService_ListTodos_FullMethodName, codes.PermissionDenied},
+		{"read link reads", readLink, TodoService_WatchTodos_FullMethodName, codes.OK},
+		{"read link completes", readLink, TodoService_UpdateTodo_FullMethodName, codes.PermissionDenied},
+		{"complete link completes", completeLink, TodoService_UpdateTodo_FullMethodName, codes.OK},
+		{"complete link creates", completeLink, TodoService_CreateTodo_FullMethodName, codes.PermissionDenied},
+		{"owner JWT", ownerJWT, TodoService_MoveTodo_FullMethodName, codes.OK},
+		{"viewer JWT reads", viewerJWT, TodoService_GetTodo_FullMethodName, codes.OK},
+		{"viewer JWT deletes", viewerJWT, TodoService_DeleteTodo_FullMethodName, codes.PermissionDenied},
+		{"forged JWT", forgedJWT, TodoService_ListTodos_FullMethodName, codes.Unauthenticated},
+		{"session token", strings.Repeat("0", 64), TodoService_ListTodos_FullMethodName, codes.Unauthenticated},
+	}
+
+	for _, test := range tests {
+		if _, err := authorizeToken(test.token, test.method); status.Code(err) != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+// completers can only mark todos as done or not done
+func TestUpdateTodoOfCompleter(t *testing.T) {
+	listId, initialToken, _ := stores.NewTodoList("")
+	todoList := stores.GetTodoListById(listId)
+	server := &Server{}
+
+	ownerCtx, _ := authorizeToken(initialToken.Token, TodoService_CreateTodo_FullMethodName)
+	created, err := server.CreateTodo(ownerCtx, &CreateTodoRequest{Todo: &TodoInput{Name: "milk"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, err := authorizeToken(addTestShareLink(t, todoList, "complete"), TodoService_UpdateTodo_FullMethodName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := map[string]*TodoInput{
+		"name":     {Name: "oat milk"},
+		"text":     {Name: "milk", Text: "1 liter"},
+		"category": {Name: "milk", Category: []string{"dairy"}},
+	}
+	for field, input := range changes {
+		if _, err := server.UpdateTodo(ctx, &UpdateTodoRequest{Id: created.Id, Todo: input}); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("change of the %v: got %v, want PermissionDenied", field, err)
+		}
+	}
+	if _, err := authorizeToken(addTestShareLink(t, todoList, "complete"), TodoService_MoveTodo_FullMethodName); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("move: got %v, want PermissionDenied", err)
+	}
+	if updated, err := server.UpdateTodo(ctx, &UpdateTodoRequest{Id: created.Id, Todo: &TodoInput{Name: "milk", Done: true}}); err != nil || !updated.Done {
+		t.Errorf("completion: got %v (%v)", updated, err)
+	}
+}
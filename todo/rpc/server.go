@@ -0,0 +1,291 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"klaemsch.io/todo/stores"
+)
+
+/*
+ * gRPC server of the todo lists (see todo.proto)
+ * the todos of the stores are converted from and to their json representation,
+ * so the same validation as in the http api is used
+ */
+type Server struct {
+	UnimplementedTodoServiceServer
+}
+
+/* Starts the gRPC server
+ * addr:	address the server listens on, e.g. ":9000"
+ * returns:	error if the server could not be started or stopped
+ */
+func ListenAndServe(addr string) error {
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(authUnary), grpc.StreamInterceptor(authStream))
+	RegisterTodoServiceServer(server, &Server{})
+
+	return server.Serve(listener)
+}
+
+// types of the events of the stores in the api
+var eventTypes = map[string]TodoEvent_Type{
+	stores.ChangeCreated: TodoEvent_TYPE_CREATED,
+	stores.ChangeUpdated: TodoEvent_TYPE_UPDATED,
+	stores.ChangeDeleted: TodoEvent_TYPE_DELETED,
+	stores.ChangeMoved:   TodoEvent_TYPE_MOVED,
+}
+
+// creates a new todo list and returns its token (the initial access token, the id of legacy lists)
+func (server *Server) CreateList(ctx context.Context, req *CreateListRequest) (*CreateListResponse, error) {
+
+	token, initialToken, err := stores.NewTodoList("")
+	if err != nil {
+		return nil, statusError(err)
+	}
+	if initialToken != nil {
+		token = initialToken.Token
+	}
+
+	log.Println("gRPC CreateList (OK)")
+	return &CreateListResponse{Token: token}, nil
+}
+
+// returns all todos of the list
+func (server *Server) ListTodos(ctx context.Context, req *ListTodosRequest) (*ListTodosResponse, error) {
+
+	todoList := todoListFromContext(ctx)
+
+	response := &ListTodosResponse{ListVersion: int64(todoList.Version)}
+	for _, listTodo := range todoList.GetTodos() {
+		message, err := todoMessage(listTodo)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		response.Todos = append(response.Todos, message)
+	}
+
+	log.Println("gRPC ListTodos (OK)")
+	return response, nil
+}
+
+// returns the todo with the id of the request
+func (server *Server) GetTodo(ctx context.Context, req *GetTodoRequest) (*Todo, error) {
+
+	foundTodo := todoListFromContext(ctx).GetTodoById(int(req.Id))
+	if foundTodo == nil {
+		return nil, status.Errorf(codes.NotFound, "todo with id %v not found", req.Id)
+	}
+
+	log.Printf("gRPC GetTodo %v (OK)", req.Id)
+	return todoMessage(foundTodo)
+}
+
+// creates a todo in the list
+func (server *Server) CreateTodo(ctx context.Context, req *CreateTodoRequest) (*Todo, error) {
+
+	newTodo, err := stores.NewTodoFromBytes(inputJson(req.Todo))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	addedTodo, err := todoListFromContext(ctx).AddTodo(*newTodo)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	log.Printf("gRPC CreateTodo %v (OK)", addedTodo.Id)
+	return todoMessage(addedTodo)
+}
+
+// replaces the fields of a todo
+func (server *Server) UpdateTodo(ctx context.Context, req *UpdateTodoRequest) (*Todo, error) {
+
+	todoList := todoListFromContext(ctx)
+
+	oldTodo := todoList.GetTodoById(int(req.Id))
+	if oldTodo == nil {
+		return nil, status.Errorf(codes.NotFound, "todo with id %v not found", req.Id)
+	}
+	if req.Version != nil && int(*req.Version) != oldTodo.Version {
+		return nil, status.Errorf(codes.Aborted, "todo with id %v was changed (version %v)", req.Id, oldTodo.Version)
+	}
+
+	// every field of the input replaces the field of the todo
+	updatedTodo, _, err := stores.PatchTodoFromBytes(inputJson(req.Todo), stores.MergePatchContentType, oldTodo)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	// a completer can only mark the todo as done or not done
+	if !stores.HasRole(roleFromContext(ctx), stores.RoleEditor) && !stores.OnlyDoneChanged(oldTodo, updatedTodo) {
+		return nil, status.Error(codes.PermissionDenied, "the completer role can only mark todos as done or not done")
+	}
+
+	updatedTodo, err = todoList.UpdateTodo(*updatedTodo)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	log.Printf("gRPC UpdateTodo %v (OK)", req.Id)
+	return todoMessage(updatedTodo)
+}
+
+// removes a todo from the list
+func (server *Server) DeleteTodo(ctx context.Context, req *DeleteTodoRequest) (*Todo, error) {
+
+	todoList := todoListFromContext(ctx)
+
+	oldTodo := todoList.GetTodoById(int(req.Id))
+	if oldTodo == nil {
+		return nil, status.Errorf(codes.NotFound, "todo with id %v not found", req.Id)
+	}
+	if req.Version != nil && int(*req.Version) != oldTodo.Version {
+		return nil, status.Errorf(codes.Aborted, "todo with id %v was changed (version %v)", req.Id, oldTodo.Version)
+	}
+
+	removedTodo, err := todoList.RemoveTodo(int(req.Id))
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	log.Printf("gRPC DeleteTodo %v (OK)", req.Id)
+	return todoMessage(removedTodo)
+}
+
+// moves a todo one position up or down
+func (server *Server) MoveTodo(ctx context.Context, req *MoveTodoRequest) (*Todo, error) {
+
+	movedTodo, err := todoListFromContext(ctx).MoveTodo(int(req.Id), req.Up)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	log.Printf("gRPC MoveTodo %v (OK)", req.Id)
+	return todoMessage(movedTodo)
+}
+
+/* Streams every change of the list until the client cancels the call
+ * the stream ends with UNAVAILABLE if the client can not keep up with the changes,
+ * the client can call ListTodos and watch again
+ */
+func (server *Server) WatchTodos(req *WatchTodosRequest, stream TodoService_WatchTodosServer) error {
+
+	todoList := todoListFromContext(stream.Context())
+
+	// the watchers of the list are changed while the list is locked
+	todoList.Lock()
+	changes, stop := todoList.Watch()
+	todoList.Unlock()
+
+	defer func() {
+		todoList.Lock()
+		stop()
+		todoList.Unlock()
+	}()
+
+	log.Println("gRPC WatchTodos (started)")
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			log.Println("gRPC WatchTodos (cancelled)")
+			return nil
+		case change, open := <-changes:
+			if !open {
+				return status.Error(codes.Unavailable, "watcher fell behind the changes of the list")
+			}
+			// the token may have been revoked since the stream was opened
+			if !streamAuthorized(stream.Context(), todoList) {
+				log.Println("gRPC WatchTodos (token revoked)")
+				return status.Error(codes.PermissionDenied, "the token was revoked")
+			}
+			message, err := todoMessage(change.Todo)
+			if err != nil {
+				return statusError(err)
+			}
+			event := &TodoEvent{Type: eventTypes[change.Type], Todo: message, ListVersion: int64(change.ListVersion)}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+/* Converts a todo of the stores into its message
+ * value:	todo or pointer to a todo of the stores
+ */
+func todoMessage(value interface{}) (*Todo, error) {
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &Todo{}
+	err = protojson.Unmarshal(encoded, message)
+	return message, err
+}
+
+// converts the input of a todo into the json object the stores decode
+func inputJson(input *TodoInput) []byte {
+	if input == nil {
+		input = &TodoInput{}
+	}
+	// unset fields are sent too, the todo is replaced like with PUT
+	encoded, _ := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(input)
+	return encoded
+}
+
+/* Converts an error of the stores into a gRPC status
+ * validation errors carry the violations of every field as BadRequest details
+ */
+func statusError(err error) error {
+
+	var code codes.Code
+	switch {
+	case errors.Is(err, stores.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, stores.ErrConflict):
+		code = codes.Aborted
+	case errors.Is(err, stores.ErrValidation):
+		code = codes.InvalidArgument
+	case errors.Is(err, stores.ErrQuota):
+		code = codes.ResourceExhausted
+	default:
+		// the message of internal errors is not sent to the client
+		log.Printf("gRPC internal error: %v", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	errorStatus := status.New(code, err.Error())
+
+	var validationError *stores.ValidationError
+	if errors.As(err, &validationError) {
+		badRequest := &errdetails.BadRequest{}
+		for _, field := range validationError.Fields {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field.Field,
+				Description: field.Code + ": " + field.Message,
+			})
+		}
+		if detailed, detailErr := errorStatus.WithDetails(badRequest); detailErr == nil {
+			errorStatus = detailed
+		}
+	}
+
+	return errorStatus.Err()
+}
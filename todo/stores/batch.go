@@ -0,0 +1,258 @@
+package stores
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// a single operation of a batch request
+type batchOperation struct {
+	Op       string          `json:"op"`
+	Id       *int            `json:"id"`
+	Ref      string          `json:"ref"`
+	Version  *int            `json:"version"`
+	Todo     json.RawMessage `json:"todo"`
+	UpOrDown int             `json:"upOrDown"`
+}
+
+// result of a single operation of a batch request
+type batchResult struct {
+	Op     string `json:"op"`
+	Ref    string `json:"ref,omitempty"`
+	Status string `json:"status"`
+	Todo   *todo  `json:"todo,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// type of the change the watchers of the list see for an operation of a batch
+var batchChangeTypes = map[string]string{
+	"create": ChangeCreated,
+	"update": ChangeUpdated,
+	"delete": ChangeDeleted,
+	"move":   ChangeMoved,
+}
+
+// structure of a batch request body
+type batchRequest struct {
+	Operations []batchOperation `json:"operations"`
+}
+
+/* Decodes the ordered operations of a batch request
+ * the todos of create and update operations are validated like single requests
+ * r:		request with json body
+ * returns: operations or error (ValidationError with every violation of every operation)
+ */
+func BatchFromJson(r *http.Request) ([]batchOperation, error) {
+
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := batchRequest{}
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, err
+	}
+
+	// validate the todos of all operations, before any operation is applied
+	validationError := &ValidationError{}
+	for index, operation := range batch.Operations {
+		if operation.Op != "create" && operation.Op != "update" {
+			continue
+		}
+		field := fmt.Sprintf("operations[%v].todo", index)
+		if len(operation.Todo) == 0 {
+			validationError.Add(field, "required", "must not be empty")
+			continue
+		}
+		if _, err := decodeTodo(operation.Todo, field+".", operation.Op == "create", validationError); err != nil {
+			validationError.Add(field, "invalid_type", "has to be an object")
+		}
+	}
+	if err := validationError.OrNil(); err != nil {
+		return nil, err
+	}
+
+	return batch.Operations, nil
+}
+
+// decodes the todo of a create or update operation (already validated by BatchFromJson)
+func (operation *batchOperation) decodeTodo() todoUpdate {
+	todoUpdate, _ := decodeTodo(operation.Todo, "", operation.Op == "create", &ValidationError{})
+	return todoUpdate
+}
+
+/* Applies the operations of a batch in order, all or nothing
+ * the operations run against a copy of the todo list, only if every operation succeeds
+ * the copy replaces the todos of the list
+ * todos created in the batch can be named with "ref" and referenced by later operations with the same "ref"
+ * returns the results of every operation and an error if the batch was not applied
+ */
+func (todoList *TodoList) ApplyBatch(operations []batchOperation) ([]batchResult, error) {
+
+	// work on a copy, so a failing operation leaves the list untouched
+	workingList := todoList.copy()
+
+	// ids of todos that were created in this batch, by ref
+	createdIds := map[string]int{}
+
+	results := make([]batchResult, len(operations))
+	for index, operation := range operations {
+		results[index] = batchResult{Op: operation.Op, Ref: operation.Ref, Status: "skipped"}
+	}
+
+	for index, operation := range operations {
+
+		changedTodo, err := workingList.applyBatchOperation(operation, createdIds)
+
+		if err != nil {
+			// mark the operation as failed, every earlier operation is rolled back
+			results[index].Status = "failed"
+			results[index].Error = err.Error()
+			for earlier := 0; earlier < index; earlier++ {
+				results[earlier].Status = "rolledBack"
+				results[earlier].Todo = nil
+			}
+			return results, fmt.Errorf("operation %v (%v) failed: %w", index, operation.Op, err)
+		}
+
+		// copy the todo, later operations of the batch may change it again
+		results[index].Status = "ok"
+		if changedTodo != nil {
+			todoCopy := *changedTodo
+			results[index].Todo = &todoCopy
+		}
+	}
+
+	// todos that were done before the batch, updates of the other todos are completions
+	doneBefore := map[int]bool{}
+	for currentTodo := todoList.Start; currentTodo != nil; currentTodo = currentTodo.Next {
+		doneBefore[currentTodo.Id] = currentTodo.Done
+	}
+
+	// every operation succeeded -> take over the todos of the copy
+	todoList.Start = workingList.Start
+	todoList.Version = workingList.Version
+	workingList.copyReplicaState(todoList)
+	for currentTodo := todoList.Start; currentTodo != nil; currentTodo = currentTodo.Next {
+		currentTodo.List = todoList
+	}
+
+	// the watchers of the list see the changes of the batch after it was applied
+	for _, result := range results {
+		if result.Todo != nil {
+			completed := result.Op == "update" && result.Todo.Done && !doneBefore[result.Todo.Id]
+			doneBefore[result.Todo.Id] = result.Todo.Done
+			todoList.publishChange(batchChangeTypes[result.Op], result.Todo, completed)
+		}
+	}
+
+	return results, nil
+}
+
+/* Applies a single operation of a batch to the todo list
+ * createdIds:	ids of the todos created earlier in the batch, new todos with a ref are added
+ * returns: 	the created, changed or deleted todo or error
+ */
+func (todoList *TodoList) applyBatchOperation(operation batchOperation, createdIds map[string]int) (*todo, error) {
+
+	// create needs no existing todo
+	if operation.Op == "create" {
+		if operation.Ref != "" {
+			if _, exists := createdIds[operation.Ref]; exists {
+				return nil, fmt.Errorf("%w: ref %q is already used", ErrValidation, operation.Ref)
+			}
+		}
+		newTodo, _ := todoFromUpdate(operation.decodeTodo())
+		newTodo.Id = nextTodoId()
+		newTodo.setCreated()
+		addedTodo, err := todoList.AddTodo(*newTodo)
+		if err != nil {
+			return nil, err
+		}
+		if operation.Ref != "" {
+			createdIds[operation.Ref] = addedTodo.Id
+		}
+		return addedTodo, nil
+	}
+
+	// every other operation targets an existing todo, by id or by ref
+	var todoId int
+	switch {
+	case operation.Id != nil:
+		todoId = *operation.Id
+	case operation.Ref != "":
+		createdId, exists := createdIds[operation.Ref]
+		if !exists {
+			return nil, fmt.Errorf("%w: ref %q does not name a todo created earlier in the batch", ErrValidation, operation.Ref)
+		}
+		todoId = createdId
+	default:
+		return nil, fmt.Errorf("%w: operation needs an id or a ref", ErrValidation)
+	}
+
+	existingTodo := todoList.GetTodoById(todoId)
+	if existingTodo == nil {
+		return nil, fmt.Errorf("%w: todo with id %v", ErrNotFound, todoId)
+	}
+
+	// optional version check, like the If-Match header of single requests
+	if operation.Version != nil && *operation.Version != existingTodo.Version {
+		return nil, fmt.Errorf("%w: todo with id %v was changed (version %v)", ErrConflict, todoId, existingTodo.Version)
+	}
+
+	switch operation.Op {
+	case "update":
+		todoUpdate := operation.decodeTodo()
+		todoUpdate.Id = todoId
+		updatedTodo, changeOrder := todoFromUpdate(todoUpdate)
+		if _, err := todoList.UpdateTodo(*updatedTodo); err != nil {
+			return nil, err
+		}
+		if changeOrder != nil {
+			return todoList.MoveTodo(todoId, changeOrder.MoveUp)
+		}
+		return todoList.GetTodoById(todoId), nil
+	case "delete":
+		return todoList.RemoveTodo(todoId)
+	case "move":
+		if operation.UpOrDown == 0 {
+			return nil, fmt.Errorf("%w: move needs upOrDown", ErrValidation)
+		}
+		return todoList.MoveTodo(todoId, operation.UpOrDown == 1)
+	default:
+		return nil, fmt.Errorf("%w: unknown operation %q", ErrValidation, operation.Op)
+	}
+}
+
+/* Creates a copy of the todo list with copies of all todos in the same order
+ * the copy can be changed without changing the original list
+ */
+func (todoList *TodoList) copy() *TodoList {
+
+	listCopy := &TodoList{
+		Id:      todoList.Id,
+		Version: todoList.Version,
+	}
+
+	// copy every todo and link the copies
+	var lastCopy *todo
+	for currentTodo := todoList.Start; currentTodo != nil; currentTodo = currentTodo.Next {
+		todoCopy := *currentTodo
+		todoCopy.List = listCopy
+		todoCopy.Prev = lastCopy
+		todoCopy.Next = nil
+		if lastCopy == nil {
+			listCopy.Start = &todoCopy
+		} else {
+			lastCopy.Next = &todoCopy
+		}
+		lastCopy = &todoCopy
+	}
+
+	// the CRDT state is changed by the operations too
+	todoList.copyReplicaState(listCopy)
+
+	return listCopy
+}
@@ -0,0 +1,236 @@
+package stores
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// creates a todo list that is not in the store with todos of the given names in the given order
+func newTestList(t *testing.T, names ...string) *TodoList {
+	t.Helper()
+	todoList := &TodoList{Id: "test"}
+	// new todos are added at the start of the list
+	for index := len(names) - 1; index >= 0; index-- {
+		name := names[index]
+		if _, err := todoList.AddTodo(todo{Id: nextTodoId(), Name: name}); err != nil {
+			t.Fatalf("todo %v could not be added: %v", name, err)
+		}
+	}
+	return todoList
+}
+
+// returns the names of the todos of the list in their order
+func todoNames(todoList *TodoList) []string {
+	names := []string{}
+	for _, listTodo := range todoList.GetTodos() {
+		names = append(names, listTodo.Name)
+	}
+	return names
+}
+
+// decodes the operations of a batch request body
+func decodeBatch(t *testing.T, body string) []batchOperation {
+	t.Helper()
+	operations, err := BatchFromJson(httptest.NewRequest("POST", "/todo/batch", strings.NewReader(body)))
+	if err != nil {
+		t.Fatalf("invalid batch %v: %v", body, err)
+	}
+	return operations
+}
+
+func TestApplyBatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations string
+		// names of the todos after the batch, the list starts with milk and bread
+		want     []string
+		statuses []string
+		// the batch has to fail with the error
+		err error
+	}{
+		{
+			"create, update and move by ref",
+			`{"operations":[
+				{"op":"create","ref":"a","todo":{"name":"eggs"}},
+				{"op":"update","ref":"a","todo":{"name":"butter"}},
+				{"op":"move","ref":"a","upOrDown":-1}]}`,
+			[]string{"milk", "butter", "bread"},
+			[]string{"ok", "ok", "ok"},
+			nil,
+		},
+		{
+			"delete by id",
+			`{"operations":[{"op":"delete","id":ID0}]}`,
+			[]string{"bread"},
+			[]string{"ok"},
+			nil,
+		},
+		{
+			"failed operation rolls back the earlier ones",
+			`{"operations":[
+				{"op":"create","ref":"a","todo":{"name":"eggs"}},
+				{"op":"delete","id":ID0},
+				{"op":"delete","id":-1},
+				{"op":"delete","id":ID1}]}`,
+			[]string{"milk", "bread"},
+			[]string{"rolledBack", "rolledBack", "failed", "skipped"},
+			ErrNotFound,
+		},
+		{
+			"ref of a later create",
+			`{"operations":[{"op":"delete","ref":"a"},{"op":"create","ref":"a","todo":{"name":"eggs"}}]}`,
+			[]string{"milk", "bread"},
+			[]string{"failed", "skipped"},
+			ErrValidation,
+		},
+		{
+			"ref used twice",
+			`{"operations":[{"op":"create","ref":"a","todo":{"name":"eggs"}},{"op":"create","ref":"a","todo":{"name":"ham"}}]}`,
+			[]string{"milk", "bread"},
+			[]string{"rolledBack", "failed"},
+			ErrValidation,
+		},
+		{
+			"stale version",
+			`{"operations":[{"op":"update","id":ID0,"version":5,"todo":{"name":"oat milk"}}]}`,
+			[]string{"milk", "bread"},
+			[]string{"failed"},
+			ErrConflict,
+		},
+		{
+			"move without direction",
+			`{"operations":[{"op":"move","id":ID1}]}`,
+			[]string{"milk", "bread"},
+			[]string{"failed"},
+			ErrValidation,
+		},
+		{
+			"operation without target",
+			`{"operations":[{"op":"delete"}]}`,
+			[]string{"milk", "bread"},
+			[]string{"failed"},
+			ErrValidation,
+		},
+		{
+			"unknown operation",
+			`{"operations":[{"op":"archive","id":ID0}]}`,
+			[]string{"milk", "bread"},
+			[]string{"failed"},
+			ErrValidation,
+		},
+	}
+
+	for _, test := range tests {
+		todoList := newTestList(t, "milk", "bread")
+		todos := todoList.GetTodos()
+		version := todoList.Version
+
+		// the ids of the todos are only known after they were created
+		body := strings.NewReplacer("ID0", strconv.Itoa(todos[0].Id), "ID1", strconv.Itoa(todos[1].Id)).Replace(test.operations)
+		results, err := todoList.ApplyBatch(decodeBatch(t, body))
+
+		if test.err == nil && err != nil {
+			t.Errorf("%v: unexpected error %v", test.name, err)
+		}
+		if test.err != nil && !errors.Is(err, test.err) {
+			t.Errorf("%v: got error %v, want %v", test.name, err, test.err)
+		}
+		if got := todoNames(todoList); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got todos %v, want %v", test.name, got, test.want)
+		}
+
+		statuses := []string{}
+		for _, result := range results {
+			statuses = append(statuses, result.Status)
+			if result.Status == "rolledBack" && result.Todo != nil {
+				t.Errorf("%v: rolled back operation returned todo %+v", test.name, *result.Todo)
+			}
+		}
+		if !reflect.DeepEqual(statuses, test.statuses) {
+			t.Errorf("%v: got statuses %v, want %v", test.name, statuses, test.statuses)
+		}
+
+		// a failed batch does not change the version of the list
+		if test.err != nil && todoList.Version != version {
+			t.Errorf("%v: version changed from %v to %v", test.name, version, todoList.Version)
+		}
+	}
+}
+
+// the todos of every operation are validated before the first operation is applied
+func TestBatchFromJsonValidatesEveryTodo(t *testing.T) {
+	body := `{"operations":[{"op":"create","todo":{"name":""}},{"op":"update","id":1},{"op":"create","todo":[1]}]}`
+	_, err := BatchFromJson(httptest.NewRequest("POST", "/todo/batch", strings.NewReader(body)))
+
+	var validationError *ValidationError
+	if !errors.As(err, &validationError) {
+		t.Fatalf("got error %v, want ValidationError", err)
+	}
+	fields := map[string]bool{}
+	for _, fieldError := range validationError.Fields {
+		fields[fieldError.Field] = true
+	}
+	for _, field := range []string{"operations[0].todo.name", "operations[1].todo", "operations[2].todo"} {
+		if !fields[field] {
+			t.Errorf("no error for %v in %v", field, validationError.Fields)
+		}
+	}
+}
+
+// todos of different lists are created at the same time by every api, their ids are unique
+func TestTodoIdsAreUnique(t *testing.T) {
+	lists := []*TodoList{newTestList(t), newTestList(t), newTestList(t)}
+	batches := [][]batchOperation{}
+	for index := 0; index < 50; index++ {
+		batches = append(batches, decodeBatch(t, `{"operations":[{"op":"create","todo":{"name":"eggs"}}]}`))
+	}
+
+	done := make(chan bool)
+	go func() {
+		for _, batch := range batches {
+			lists[0].ApplyBatch(batch)
+		}
+		done <- true
+	}()
+	go func() {
+		for index := 0; index < 50; index++ {
+			written := stamp{Time: time.Now().UnixMilli(), Replica: "phone"}
+			lists[1].MergeReplica(replicaRequest{Replica: "phone", Todos: []replicaTodo{{
+				Key:           "phone:" + strconv.Itoa(index),
+				Position:      position{{1 + index, "phone"}},
+				PositionStamp: written,
+				Fields:        map[string]register{"name": {json.RawMessage(`"eggs"`), written}},
+			}}})
+		}
+		done <- true
+	}()
+	go func() {
+		for index := 0; index < 50; index++ {
+			newTodo, _ := NewTodoFromBytes([]byte(`{"name":"eggs"}`))
+			lists[2].AddTodo(*newTodo)
+		}
+		done <- true
+	}()
+	<-done
+	<-done
+	<-done
+
+	ids := map[int]bool{}
+	for _, todoList := range lists {
+		for _, listTodo := range todoList.GetTodos() {
+			if ids[listTodo.Id] {
+				t.Errorf("id %v is used twice", listTodo.Id)
+			}
+			ids[listTodo.Id] = true
+		}
+	}
+	if len(ids) != 150 {
+		t.Errorf("got %v todos, want 150", len(ids))
+	}
+}
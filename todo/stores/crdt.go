@@ -0,0 +1,641 @@
+package stores
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * Replicas of a todo list (offline clients, other servers) merge their edits as CRDTs,
+ * so every replica ends up with the same list no matter in which order the edits arrive
+ * - order:		every todo has a position in a dense sequence (Logoot): a list of digits, each with the replica that
+ *				created it; new positions are created between the positions of the neighbors, so concurrent inserts
+ *				never collide; a move gives the todo a new position (last writer wins between concurrent moves)
+ * - fields:	name, text, done and category are last-writer-wins registers, every value carries the stamp of its write
+ * - deletes:	a deleted todo stays deleted (tombstone), later writes of other replicas are ignored;
+ *				only the last MaxTombstonesPerList tombstones are kept, replicas that were offline for more deletes
+ *				should load the state again, otherwise they bring back the todos of the removed tombstones
+ * stamps come from a hybrid logical clock (wall time in ms, counter, replica) and are totally ordered
+ * the server is the replica "server", it stamps every change that is made through the other apis
+ * replicas only write in their own name, writes of other replicas are only accepted if they are already known
+ */
+
+// replica id of the server
+const ServerReplica = "server"
+
+// digits of a position are between 0 and positionBase
+const positionBase = 1 << 16
+
+// stamps of replicas may be ahead of the clock of the server by at most this duration
+const maxClockSkew = 5 * time.Minute
+
+// number of tombstones that are kept per list, older tombstones are removed
+const MaxTombstonesPerList = 1000
+
+// timestamp of a write (hybrid logical clock), ordered by time, counter and replica
+type stamp struct {
+	Time    int64  `json:"time"`
+	Counter int    `json:"counter"`
+	Replica string `json:"replica"`
+}
+
+// single digit of a position
+type positionDigit struct {
+	Digit   int    `json:"digit"`
+	Replica string `json:"replica"`
+}
+
+// position of a todo in the sequence, positions are compared digit by digit
+type position []positionDigit
+
+// last-writer-wins register of a field
+type register struct {
+	Value json.RawMessage `json:"value"`
+	Stamp stamp           `json:"stamp"`
+}
+
+// CRDT state of a single todo
+type replicaTodo struct {
+	// unique key of the todo on every replica, replicas create their own keys (e.g. "phone:12")
+	Key string `json:"key"`
+	// id of the todo on the server, not set for deleted todos
+	Id            *int                `json:"id,omitempty"`
+	Position      position            `json:"position"`
+	PositionStamp stamp               `json:"positionStamp"`
+	Fields        map[string]register `json:"fields"`
+	Deleted       *stamp              `json:"deleted,omitempty"`
+}
+
+// structure of a merge request body, the CRDT state (or only the changed todos) of a replica
+type replicaRequest struct {
+	Replica string        `json:"replica"`
+	Todos   []replicaTodo `json:"todos"`
+}
+
+// CRDT state of a todo list, sent back after a merge
+type replicaState struct {
+	Clock stamp         `json:"clock"`
+	Todos []replicaTodo `json:"todos"`
+}
+
+// compares two stamps, returns true if the first stamp is later
+func (first stamp) after(second stamp) bool {
+	if first.Time != second.Time {
+		return first.Time > second.Time
+	}
+	if first.Counter != second.Counter {
+		return first.Counter > second.Counter
+	}
+	return first.Replica > second.Replica
+}
+
+/* Compares two positions digit by digit, a position is before every longer position with the same prefix
+ * returns:	negative if first is before second, 0 if equal, positive if first is after second
+ */
+func comparePositions(first position, second position) int {
+	for level := 0; level < len(first) && level < len(second); level++ {
+		if first[level].Digit != second[level].Digit {
+			return first[level].Digit - second[level].Digit
+		}
+		if first[level].Replica != second[level].Replica {
+			return strings.Compare(first[level].Replica, second[level].Replica)
+		}
+	}
+	return len(first) - len(second)
+}
+
+/* Creates a position between two positions
+ * prev:	position of the todo before, nil for the start of the list
+ * next:	position of the todo after, nil for the end of the list
+ * replica:	replica that creates the position, makes positions of concurrent inserts unique
+ * the last digit of a position is never 0, so there is always room before it (see ReplicaFromJson)
+ */
+func positionBetween(prev position, next position, replica string) position {
+
+	between := position{}
+	// as long as the new position has the same prefix as next, next limits the digits
+	nextBounded := next != nil
+
+	for level := 0; ; level++ {
+		low := positionDigit{0, replica}
+		if level < len(prev) {
+			low = prev[level]
+		}
+		high := positionBase
+		if nextBounded && level < len(next) {
+			high = next[level].Digit
+		}
+
+		// room between the digits -> the new position ends here
+		if high-low.Digit > 1 {
+			return append(between, positionDigit{(low.Digit + high) / 2, replica})
+		}
+
+		// no room -> take the digit of prev and look at the next level,
+		// after the end of prev a 0 of next is taken, the replica of the new digit could be after the one of next
+		if level >= len(prev) && low.Digit == high {
+			low = next[level]
+		}
+		between = append(between, low)
+		if nextBounded && level < len(next) && comparePositions(position{low}, position{next[level]}) < 0 {
+			nextBounded = false
+		}
+	}
+}
+
+// returns the next stamp of the server
+func (todoList *TodoList) tick() stamp {
+	now := time.Now().UnixMilli()
+	if now > todoList.clock.Time {
+		todoList.clock = stamp{Time: now}
+	} else {
+		todoList.clock.Counter++
+	}
+	todoList.clock.Replica = ServerReplica
+	return todoList.clock
+}
+
+// moves the clock of the server behind a stamp of a replica, so later writes of the server win
+func (todoList *TodoList) observe(remote stamp) {
+	if remote.Time > todoList.clock.Time || remote.Time == todoList.clock.Time && remote.Counter > todoList.clock.Counter {
+		todoList.clock.Time, todoList.clock.Counter = remote.Time, remote.Counter
+	}
+}
+
+// returns the CRDT state of a todo of the list, nil if the todo is not known
+func (todoList *TodoList) replicaTodoById(todoId int) *replicaTodo {
+	return todoList.replicaTodos[todoList.replicaKeys[todoId]]
+}
+
+// returns the position of a todo of the list, nil for no todo (start or end of the list)
+func (todoList *TodoList) positionOf(linkedTodo *todo) position {
+	if linkedTodo == nil {
+		return nil
+	}
+	if entry := todoList.replicaTodoById(linkedTodo.Id); entry != nil {
+		return entry.Position
+	}
+	return nil
+}
+
+/* Stamps the changes that are made on the server (see publishChange)
+ * created todos get a key and a position between their neighbors, updated fields and moves get new stamps,
+ * deleted todos become tombstones; changes that are already known (merges, batches) are not stamped again
+ */
+func (todoList *TodoList) trackReplicaState(changeType string, changedTodo *todo) {
+
+	// merges set the state on their own
+	if todoList.merging {
+		return
+	}
+	if todoList.replicaTodos == nil {
+		todoList.replicaTodos = map[string]*replicaTodo{}
+		todoList.replicaKeys = map[int]string{}
+	}
+
+	entry := todoList.replicaTodoById(changedTodo.Id)
+	linkedTodo := todoList.GetTodoById(changedTodo.Id)
+
+	// todos created on the server get a key of the server
+	if entry == nil {
+		if changeType != ChangeCreated || linkedTodo == nil {
+			return
+		}
+		id := changedTodo.Id
+		entry = &replicaTodo{Key: ServerReplica + ":" + strconv.Itoa(id), Id: &id, Fields: map[string]register{}}
+		todoList.replicaTodos[entry.Key] = entry
+		todoList.replicaKeys[id] = entry.Key
+	}
+
+	switch changeType {
+	case ChangeDeleted:
+		if entry.Deleted == nil {
+			deleted := todoList.tick()
+			entry.Deleted, entry.Id = &deleted, nil
+			delete(todoList.replicaKeys, changedTodo.Id)
+			todoList.removeOldTombstones()
+		}
+	case ChangeCreated, ChangeMoved, ChangeUpdated:
+		// fields that differ from their register
+		for name, value := range jsonFields(changedTodo) {
+			if !contains(todoSyncFields, name) {
+				continue
+			}
+			current, known := entry.Fields[name]
+			var currentValue interface{}
+			json.Unmarshal(current.Value, &currentValue)
+			if !known || !sameValue(currentValue, value) {
+				encoded, _ := json.Marshal(value)
+				entry.Fields[name] = register{encoded, todoList.tick()}
+			}
+		}
+
+		// a todo that is not between its neighbors anymore gets a new position
+		if linkedTodo == nil {
+			return
+		}
+		prev, next := todoList.positionOf(linkedTodo.Prev), todoList.positionOf(linkedTodo.Next)
+		if entry.Position == nil || prev != nil && comparePositions(prev, entry.Position) >= 0 || next != nil && comparePositions(entry.Position, next) >= 0 {
+			entry.Position = positionBetween(prev, next, ServerReplica)
+			entry.PositionStamp = todoList.tick()
+		}
+	}
+}
+
+/* Returns the CRDT state of the list, every todo (including tombstones) in the order of their positions
+ * the mutex of the list has to be held
+ */
+func (todoList *TodoList) ReplicaState() replicaState {
+
+	state := replicaState{Clock: todoList.clock, Todos: []replicaTodo{}}
+	for _, entry := range todoList.replicaTodos {
+		state.Todos = append(state.Todos, *entry)
+	}
+
+	sort.Slice(state.Todos, func(i, j int) bool {
+		return lessReplicaTodo(&state.Todos[i], &state.Todos[j])
+	})
+	return state
+}
+
+// order of the todos, todos with the same position are ordered by their key
+func lessReplicaTodo(first *replicaTodo, second *replicaTodo) bool {
+	if order := comparePositions(first.Position, second.Position); order != 0 {
+		return order < 0
+	}
+	return first.Key < second.Key
+}
+
+/* Decodes a merge request
+ * the structure of every todo is validated, the merged fields are validated when they are applied
+ * r:		request with json body
+ * returns: merge request or error (ValidationError with every violation)
+ */
+func ReplicaFromJson(r *http.Request) (replicaRequest, error) {
+
+	request := replicaRequest{}
+
+	body, err := readBody(r)
+	if err != nil {
+		return request, err
+	}
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return request, err
+	}
+
+	validationError := &ValidationError{}
+	if strings.TrimSpace(request.Replica) == "" {
+		validationError.Add("replica", "required", "must not be empty")
+	} else if request.Replica == ServerReplica {
+		validationError.Add("replica", "invalid_value", "is the replica of the server")
+	}
+
+	// stamps far in the future would win every later write
+	latest := time.Now().Add(maxClockSkew).UnixMilli()
+	checkStamp := func(field string, checked stamp) {
+		if checked.Replica == "" {
+			validationError.Add(field+".replica", "required", "must not be empty")
+		}
+		if checked.Time > latest {
+			validationError.Add(field+".time", "invalid_value", "is too far in the future")
+		}
+	}
+
+	keys := map[string]bool{}
+	for index, entry := range request.Todos {
+		prefix := fmt.Sprintf("todos[%v].", index)
+
+		if entry.Key == "" {
+			validationError.Add(prefix+"key", "required", "must not be empty")
+		} else if keys[entry.Key] {
+			validationError.Add(prefix+"key", "duplicate", "is a duplicate key")
+		}
+		keys[entry.Key] = true
+
+		if len(entry.Position) == 0 {
+			validationError.Add(prefix+"position", "required", "must not be empty")
+		}
+		for level, digit := range entry.Position {
+			digitPrefix := fmt.Sprintf("%vposition[%v].", prefix, level)
+			if digit.Digit < 0 || digit.Digit >= positionBase {
+				validationError.Add(digitPrefix+"digit", "invalid_value", fmt.Sprintf("must be between 0 and %v", positionBase-1))
+			} else if digit.Digit == 0 && level == len(entry.Position)-1 {
+				// no position could be created before the position
+				validationError.Add(digitPrefix+"digit", "invalid_value", "the last digit must not be 0")
+			}
+			if strings.TrimSpace(digit.Replica) == "" {
+				validationError.Add(digitPrefix+"replica", "required", "must not be empty")
+			}
+		}
+		checkStamp(prefix+"positionStamp", entry.PositionStamp)
+
+		for name, value := range entry.Fields {
+			if !contains(todoSyncFields, name) {
+				validationError.Add(prefix+"fields."+name, "unknown_field", "is not a known field")
+				continue
+			}
+			checkStamp(prefix+"fields."+name+".stamp", value.Stamp)
+		}
+		if entry.Deleted != nil {
+			checkStamp(prefix+"deleted", *entry.Deleted)
+		}
+	}
+	if err := validationError.OrNil(); err != nil {
+		return request, err
+	}
+
+	return request, nil
+}
+
+/* Merges the CRDT state of a replica into the list
+ * every field and position keeps the write with the latest stamp, deletes always win,
+ * then the todos of the list are created, updated, deleted and ordered like the merged state
+ * the mutex of the list has to be held
+ * returns:	the merged state of the list or error (ValidationError if a merged todo breaks the rules,
+ *			ErrQuota if the list would have too many todos), nothing is changed on an error
+ */
+func (todoList *TodoList) MergeReplica(request replicaRequest) (replicaState, error) {
+
+	if todoList.replicaTodos == nil {
+		todoList.replicaTodos = map[string]*replicaTodo{}
+		todoList.replicaKeys = map[int]string{}
+	}
+
+	// merge into copies first, so an invalid todo does not change the list
+	merged := map[string]*replicaTodo{}
+	created := 0
+	validationError := &ValidationError{}
+	for entryIndex, remote := range request.Todos {
+
+		// the id of the todo on the server is never taken from the replica
+		entry := &replicaTodo{Key: remote.Key, Fields: map[string]register{}}
+		local := todoList.replicaTodos[remote.Key]
+		todoList.checkReplicaWrites(request.Replica, remote, local, fmt.Sprintf("todos[%v].", entryIndex), validationError)
+		if local != nil {
+			*entry = *local
+			entry.Fields = map[string]register{}
+			for name, value := range local.Fields {
+				entry.Fields[name] = value
+			}
+		}
+
+		// last writer wins for the position and every field
+		if local == nil || remote.PositionStamp.after(entry.PositionStamp) {
+			entry.Position, entry.PositionStamp = remote.Position, remote.PositionStamp
+		}
+		for name, value := range remote.Fields {
+			current, known := entry.Fields[name]
+			if !known || value.Stamp.after(current.Stamp) {
+				entry.Fields[name] = value
+			}
+		}
+		// deletes win
+		if entry.Deleted == nil && remote.Deleted != nil {
+			entry.Deleted = remote.Deleted
+		}
+		merged[remote.Key] = entry
+
+		if entry.Deleted == nil {
+			if local == nil {
+				created++
+			}
+			todoList.validateReplicaTodo(entry, fmt.Sprintf("todos[%v].fields.", entryIndex), validationError)
+		}
+	}
+	if err := validationError.OrNil(); err != nil {
+		return replicaState{}, err
+	}
+	if todoList.countTodos()+created > MaxTodosPerList {
+		err := fmt.Errorf("%w: a list can hold at most %v todos", ErrQuota, MaxTodosPerList)
+		return replicaState{}, err
+	}
+
+	// the clock of the server continues after every stamp of the replica
+	for _, entry := range request.Todos {
+		todoList.observe(entry.PositionStamp)
+		for _, value := range entry.Fields {
+			todoList.observe(value.Stamp)
+		}
+		if entry.Deleted != nil {
+			todoList.observe(*entry.Deleted)
+		}
+	}
+
+	// apply the merged state to the todos of the list, the changes are published but not stamped again
+	todoList.merging = true
+	defer func() { todoList.merging = false }()
+
+	var moved []int
+	for _, remote := range request.Todos {
+		entry := merged[remote.Key]
+		local := todoList.replicaTodos[remote.Key]
+		positionChanged := local == nil || comparePositions(local.Position, entry.Position) != 0
+		todoList.replicaTodos[remote.Key] = entry
+
+		switch {
+		case entry.Deleted != nil && entry.Id != nil:
+			id := *entry.Id
+			entry.Id = nil
+			delete(todoList.replicaKeys, id)
+			todoList.RemoveTodo(id)
+		case entry.Deleted != nil:
+			// created and deleted on the replica, only the tombstone is kept
+		case entry.Id == nil:
+			newTodo := todoFromReplica(entry, &todo{})
+			newTodo.Id = nextTodoId()
+			newTodo.setCreated()
+			entry.Id = &newTodo.Id
+			todoList.replicaKeys[newTodo.Id] = entry.Key
+			todoList.AddTodo(*newTodo)
+			moved = append(moved, newTodo.Id)
+		default:
+			existingTodo := todoList.GetTodoById(*entry.Id)
+			updatedTodo := todoFromReplica(entry, existingTodo)
+			if !sameValue(jsonFields(existingTodo), jsonFields(updatedTodo)) {
+				todoList.UpdateTodo(*updatedTodo)
+			}
+			if positionChanged {
+				moved = append(moved, *entry.Id)
+			}
+		}
+	}
+
+	// order the todos by their merged positions, moved todos are published after the order is final
+	if todoList.orderByPosition() {
+		todoList.Version++
+		for _, id := range moved {
+			if movedTodo := todoList.GetTodoById(id); movedTodo != nil {
+				todoList.publish(ChangeMoved, movedTodo)
+			}
+		}
+	}
+	todoList.removeOldTombstones()
+
+	return todoList.ReplicaState(), nil
+}
+
+/* Checks that a replica only writes in its own name
+ * stamps of other replicas (including the server) have to be known already, sending them again changes nothing,
+ * new positions of the replica have to end with a digit of the replica
+ * remote:	todo sent by the replica
+ * local:	current state of the todo, nil if the todo is not known
+ */
+func (todoList *TodoList) checkReplicaWrites(replica string, remote replicaTodo, local *replicaTodo, prefix string, validationError *ValidationError) {
+
+	checkStamp := func(field string, written stamp, known *stamp) {
+		if written.Replica != replica && (known == nil || written != *known) {
+			validationError.Add(field+".replica", "invalid_value", fmt.Sprintf("has to be %v, writes of other replicas can only be sent again", replica))
+		}
+	}
+
+	var knownPosition *stamp
+	if local != nil {
+		knownPosition = &local.PositionStamp
+	}
+	checkStamp(prefix+"positionStamp", remote.PositionStamp, knownPosition)
+	if remote.PositionStamp.Replica == replica && len(remote.Position) > 0 && remote.Position[len(remote.Position)-1].Replica != replica {
+		if local == nil || comparePositions(local.Position, remote.Position) != 0 {
+			validationError.Add(prefix+"position", "invalid_value", fmt.Sprintf("the last digit of a new position has to be of the replica %v", replica))
+		}
+	}
+
+	for name, value := range remote.Fields {
+		var knownField *stamp
+		if local != nil {
+			if current, known := local.Fields[name]; known {
+				knownField = &current.Stamp
+			}
+		}
+		checkStamp(prefix+"fields."+name+".stamp", value.Stamp, knownField)
+	}
+
+	if remote.Deleted != nil {
+		var knownDelete *stamp
+		if local != nil {
+			knownDelete = local.Deleted
+		}
+		checkStamp(prefix+"deleted", *remote.Deleted, knownDelete)
+	}
+}
+
+// removes the oldest tombstones if the list has more than MaxTombstonesPerList
+func (todoList *TodoList) removeOldTombstones() {
+
+	tombstones := []*replicaTodo{}
+	for _, entry := range todoList.replicaTodos {
+		if entry.Deleted != nil {
+			tombstones = append(tombstones, entry)
+		}
+	}
+	if len(tombstones) <= MaxTombstonesPerList {
+		return
+	}
+
+	sort.Slice(tombstones, func(i, j int) bool {
+		return tombstones[j].Deleted.after(*tombstones[i].Deleted)
+	})
+	for _, entry := range tombstones[:len(tombstones)-MaxTombstonesPerList] {
+		delete(todoList.replicaTodos, entry.Key)
+	}
+}
+
+// checks the merged fields of a todo against the rules
+func (todoList *TodoList) validateReplicaTodo(entry *replicaTodo, prefix string, validationError *ValidationError) {
+
+	candidate := todo{}
+	if entry.Id != nil {
+		if existingTodo := todoList.GetTodoById(*entry.Id); existingTodo != nil {
+			candidate = *existingTodo
+		}
+	}
+	if err := decodeFields(replicaFieldsJson(entry), &candidate, prefix, todoSyncFields, validationError); err != nil {
+		validationError.Add(strings.TrimSuffix(prefix, "."), "invalid_type", "has to be an object")
+		return
+	}
+	Rules.validateTodo(&candidate, prefix, validationError)
+}
+
+// returns the values of the registers of a todo as json object
+func replicaFieldsJson(entry *replicaTodo) []byte {
+	fields := map[string]json.RawMessage{}
+	for name, value := range entry.Fields {
+		fields[name] = value.Value
+	}
+	encoded, _ := json.Marshal(fields)
+	return encoded
+}
+
+// returns a copy of a todo with the values of the registers (the fields were validated before)
+func todoFromReplica(entry *replicaTodo, base *todo) *todo {
+	result := *base
+	json.Unmarshal(replicaFieldsJson(entry), &result)
+	return &result
+}
+
+/* Orders the linked todos of the list by their positions
+ * returns:	true if the order changed
+ */
+func (todoList *TodoList) orderByPosition() bool {
+
+	todos := []*todo{}
+	for currentTodo := todoList.Start; currentTodo != nil; currentTodo = currentTodo.Next {
+		todos = append(todos, currentTodo)
+	}
+
+	sorted := append([]*todo{}, todos...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return lessReplicaTodo(todoList.replicaTodoById(sorted[i].Id), todoList.replicaTodoById(sorted[j].Id))
+	})
+
+	changed := false
+	for index := range todos {
+		if todos[index] != sorted[index] {
+			changed = true
+		}
+	}
+	if !changed {
+		return false
+	}
+
+	// link the todos in the new order
+	todoList.Start = nil
+	var lastTodo *todo
+	for _, currentTodo := range sorted {
+		currentTodo.Prev, currentTodo.Next = lastTodo, nil
+		if lastTodo == nil {
+			todoList.Start = currentTodo
+		} else {
+			lastTodo.Next = currentTodo
+		}
+		lastTodo = currentTodo
+	}
+	return true
+}
+
+// copies the CRDT state of the list into another list (see copy)
+func (todoList *TodoList) copyReplicaState(target *TodoList) {
+	target.clock = todoList.clock
+	target.replicaTodos = map[string]*replicaTodo{}
+	target.replicaKeys = map[int]string{}
+	for key, entry := range todoList.replicaTodos {
+		entryCopy := *entry
+		if entry.Id != nil {
+			id := *entry.Id
+			entryCopy.Id = &id
+		}
+		entryCopy.Fields = map[string]register{}
+		for name, value := range entry.Fields {
+			entryCopy.Fields[name] = value
+		}
+		target.replicaTodos[key] = &entryCopy
+	}
+	for id, key := range todoList.replicaKeys {
+		target.replicaKeys[id] = key
+	}
+}
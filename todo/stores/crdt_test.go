@@ -0,0 +1,219 @@
+package stores
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checks that a created position is strictly between its neighbors and can be sent by a replica
+func checkPositionBetween(t *testing.T, prev position, next position, replica string) position {
+	t.Helper()
+	between := positionBetween(prev, next, replica)
+	if prev != nil && comparePositions(prev, between) >= 0 || next != nil && comparePositions(between, next) >= 0 {
+		t.Fatalf("position %v is not between %v and %v", between, prev, next)
+	}
+	for _, digit := range between {
+		if digit.Replica == "" {
+			t.Fatalf("position %v between %v and %v has a digit without replica", between, prev, next)
+		}
+	}
+	if between[len(between)-1].Digit == 0 {
+		t.Fatalf("position %v between %v and %v ends with 0", between, prev, next)
+	}
+	return between
+}
+
+func TestPositionBetweenEdges(t *testing.T) {
+	tests := []struct {
+		name string
+		prev position
+		next position
+	}{
+		{"empty list", nil, nil},
+		{"before the first digit", nil, position{{1, "a"}}},
+		{"before a 0", nil, position{{0, "a"}, {1, "b"}}},
+		{"before a 0 of a smaller replica", nil, position{{0, "0"}, {1, "0"}}},
+		{"after the last digit", position{{positionBase - 1, "a"}}, nil},
+		{"adjacent digits", position{{5, "a"}}, position{{6, "a"}}},
+		{"same digit, other replica", position{{5, "a"}}, position{{5, "b"}}},
+		{"prev is a prefix of next", position{{5, "a"}}, position{{5, "a"}, {1, "b"}}},
+		{"prev is a prefix of next with a 0", position{{5, "a"}}, position{{5, "a"}, {0, "0"}, {0, "0"}, {1, "0"}}},
+		{"next is longer", position{{5, "a"}, {positionBase - 1, "z"}}, position{{6, "a"}}},
+	}
+
+	for _, test := range tests {
+		for _, replica := range []string{"0", "m", "server", "zz"} {
+			t.Run(test.name+"/"+replica, func(t *testing.T) {
+				checkPositionBetween(t, test.prev, test.next, replica)
+			})
+		}
+	}
+}
+
+// random inserts into a list of positions keep the positions ordered and unique
+func TestPositionBetweenProperty(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	replicas := []string{"0", "a", "b", ServerReplica, "zz"}
+
+	for round := 0; round < 50; round++ {
+		positions := []position{}
+		for insert := 0; insert < 200; insert++ {
+			index := random.Intn(len(positions) + 1)
+			var prev, next position
+			if index > 0 {
+				prev = positions[index-1]
+			}
+			if index < len(positions) {
+				next = positions[index]
+			}
+			between := checkPositionBetween(t, prev, next, replicas[random.Intn(len(replicas))])
+			positions = append(positions[:index], append([]position{between}, positions[index:]...)...)
+		}
+	}
+
+	// random valid positions with many 0 and maximal digits
+	digits := []int{0, 1, 2, positionBase - 2, positionBase - 1}
+	randomPosition := func() position {
+		result := position{}
+		for length := 1 + random.Intn(4); len(result) < length; {
+			result = append(result, positionDigit{digits[random.Intn(len(digits))], replicas[random.Intn(len(replicas))]})
+		}
+		if result[len(result)-1].Digit == 0 {
+			result[len(result)-1].Digit = 1
+		}
+		return result
+	}
+	for pair := 0; pair < 20000; pair++ {
+		candidates := []position{randomPosition(), randomPosition()}
+		sort.Slice(candidates, func(i, j int) bool { return comparePositions(candidates[i], candidates[j]) < 0 })
+		if comparePositions(candidates[0], candidates[1]) == 0 {
+			continue
+		}
+		checkPositionBetween(t, candidates[0], candidates[1], replicas[random.Intn(len(replicas))])
+	}
+}
+
+func TestReplicaFromJsonPositions(t *testing.T) {
+	tests := []struct {
+		position string
+		want     []string
+	}{
+		{`[{"digit":3,"replica":"phone"}]`, []string{}},
+		{`[{"digit":0,"replica":"phone"},{"digit":3,"replica":"phone"}]`, []string{}},
+		{`[]`, []string{"todos[0].position:required"}},
+		{`[{"digit":3,"replica":""}]`, []string{"todos[0].position[0].replica:required"}},
+		{`[{"digit":3}]`, []string{"todos[0].position[0].replica:required"}},
+		{`[{"digit":3,"replica":"phone"},{"digit":0,"replica":"phone"}]`, []string{"todos[0].position[1].digit:invalid_value"}},
+		{`[{"digit":65536,"replica":"phone"}]`, []string{"todos[0].position[0].digit:invalid_value"}},
+	}
+
+	for _, test := range tests {
+		body := `{"replica":"phone","todos":[{"key":"phone:1","position":` + test.position + `,"positionStamp":{"time":1,"replica":"phone"}}]}`
+		_, err := ReplicaFromJson(httptest.NewRequest("POST", "/replica", strings.NewReader(body)))
+		got := violations(err)
+		if err == nil {
+			got = []string{}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got violations %v (%v), want %v", test.position, got, err, test.want)
+		}
+	}
+}
+
+// replicas only write in their own name, known writes of other replicas can be sent again
+func TestMergeReplicaWrites(t *testing.T) {
+	now := time.Now().UnixMilli()
+	own := stamp{Time: now, Replica: "phone"}
+	// before the todo was created, so it can not be a stamp the server knows
+	forged := stamp{Time: now - 1000, Replica: ServerReplica}
+	name := func(value string, written stamp) map[string]register {
+		return map[string]register{"name": {json.RawMessage(`"` + value + `"`), written}}
+	}
+
+	tests := []struct {
+		name string
+		// changes the state of the server todo, or returns a new todo
+		todo func(server replicaTodo) replicaTodo
+		want []string
+	}{
+		{"new todo of the replica", func(server replicaTodo) replicaTodo {
+			return replicaTodo{Key: "phone:1", Position: position{{7, "phone"}}, PositionStamp: own, Fields: name("eggs", own)}
+		}, []string{}},
+		{"state of the server sent again", func(server replicaTodo) replicaTodo {
+			return server
+		}, []string{}},
+		{"field written by the replica", func(server replicaTodo) replicaTodo {
+			server.Fields = name("oat milk", own)
+			return server
+		}, []string{}},
+		{"field in the name of the server", func(server replicaTodo) replicaTodo {
+			server.Fields = name("oat milk", forged)
+			return server
+		}, []string{"todos[0].fields.name.stamp.replica:invalid_value"}},
+		{"new todo in the name of another replica", func(server replicaTodo) replicaTodo {
+			tablet := stamp{Time: now, Replica: "tablet"}
+			return replicaTodo{Key: "tablet:1", Position: position{{7, "tablet"}}, PositionStamp: tablet, Fields: name("eggs", tablet)}
+		}, []string{"todos[0].positionStamp.replica:invalid_value", "todos[0].fields.name.stamp.replica:invalid_value"}},
+		{"new position with a digit of the server", func(server replicaTodo) replicaTodo {
+			return replicaTodo{Key: "phone:1", Position: position{{7, ServerReplica}}, PositionStamp: own, Fields: name("eggs", own)}
+		}, []string{"todos[0].position:invalid_value"}},
+		{"delete in the name of the server", func(server replicaTodo) replicaTodo {
+			server.Deleted = &forged
+			return server
+		}, []string{"todos[0].deleted.replica:invalid_value"}},
+		{"delete of the replica", func(server replicaTodo) replicaTodo {
+			server.Deleted = &own
+			return server
+		}, []string{}},
+	}
+
+	for _, test := range tests {
+		todoList := newTestList(t, "milk")
+		server := todoList.ReplicaState().Todos[0]
+		_, err := todoList.MergeReplica(replicaRequest{Replica: "phone", Todos: []replicaTodo{test.todo(server)}})
+		got := violations(err)
+		if err == nil {
+			got = []string{}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got violations %v (%v), want %v", test.name, got, err, test.want)
+		}
+	}
+}
+
+// only the latest tombstones are kept
+func TestMergeReplicaRemovesOldTombstones(t *testing.T) {
+	todoList := newTestList(t)
+	start := time.Now().UnixMilli() - 10000
+
+	request := replicaRequest{Replica: "phone"}
+	for index := 0; index < MaxTombstonesPerList+5; index++ {
+		written := stamp{Time: start + int64(index), Replica: "phone"}
+		request.Todos = append(request.Todos, replicaTodo{
+			Key:           "phone:" + strconv.Itoa(index),
+			Position:      position{{1 + index, "phone"}},
+			PositionStamp: written,
+			Deleted:       &written,
+		})
+	}
+	state, err := todoList.MergeReplica(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(state.Todos) != MaxTombstonesPerList {
+		t.Errorf("got %v tombstones, want %v", len(state.Todos), MaxTombstonesPerList)
+	}
+	for _, entry := range state.Todos {
+		if entry.Deleted.Time < start+5 {
+			t.Errorf("old tombstone %v was kept", entry.Key)
+		}
+	}
+}
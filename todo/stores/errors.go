@@ -0,0 +1,66 @@
+package stores
+
+import (
+	"errors"
+	"strings"
+)
+
+/*
+ * errors returned by the stores, use errors.Is to check for them
+ * the stores wrap them with details, e.g. fmt.Errorf("%w: todo with id %v", ErrNotFound, id)
+ */
+var (
+	// the todo, list or saved search does not exist
+	ErrNotFound = errors.New("not found")
+	// the change does not fit the current state (e.g. outdated version, failed patch test)
+	ErrConflict = errors.New("conflict")
+	// the data sent by the client is invalid, see ValidationError for the fields
+	ErrValidation = errors.New("validation failed")
+	// a limit of the list was reached (e.g. number of todos)
+	ErrQuota = errors.New("quota exceeded")
+	// the format of the body is not supported (e.g. the Content-Type of a patch)
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	// the refresh token is unknown, expired, was already used or its credential was revoked
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+)
+
+// violation of a single rule by a single field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// error with all field violations of a request, matches ErrValidation
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// joins the messages of all field violations
+func (validationError *ValidationError) Error() string {
+	messages := []string{}
+	for _, field := range validationError.Fields {
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+	return ErrValidation.Error() + ": " + strings.Join(messages, ", ")
+}
+
+// makes errors.Is(err, ErrValidation) true for validation errors
+func (validationError *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// adds a field violation to the validation error
+func (validationError *ValidationError) Add(field string, code string, message string) {
+	validationError.Fields = append(validationError.Fields, FieldError{field, code, message})
+}
+
+/* returns the validation error if it has violations, otherwise nil
+ * allows: return validationError.OrNil()
+ */
+func (validationError *ValidationError) OrNil() error {
+	if len(validationError.Fields) == 0 {
+		return nil
+	}
+	return validationError
+}
@@ -0,0 +1,127 @@
+package stores
+
+// types of changes of a todo list
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+	ChangeMoved   = "moved"
+)
+
+// number of changes a watcher can fall behind before it is dropped
+const watcherBuffer = 64
+
+// number of changes that are kept per list, so clients can resume after a reconnect
+const ChangeLogSize = 500
+
+// structure of a change of a todo list, sent to every watcher of the list (exported for the streams of the backend)
+type Change struct {
+	// sequence number of the change in the list, starts with 1
+	Id          int    `json:"id"`
+	Type        string `json:"type"`
+	Todo        todo   `json:"todo"`
+	ListVersion int    `json:"listVersion"`
+}
+
+/* Registers a watcher that receives every change of the todo list
+ * the mutex of the list has to be held while calling Watch and the returned stop function
+ * returns:	channel with the changes and function that stops watching
+ *			the channel is closed when the watcher is stopped or can not keep up with the changes
+ */
+func (todoList *TodoList) Watch() (<-chan Change, func()) {
+
+	changes := make(chan Change, watcherBuffer)
+
+	if todoList.watchers == nil {
+		todoList.watchers = map[chan Change]bool{}
+	}
+	todoList.watchers[changes] = true
+
+	stop := func() {
+		if todoList.watchers[changes] {
+			delete(todoList.watchers, changes)
+			close(changes)
+		}
+	}
+	return changes, stop
+}
+
+/* Registers a watcher that continues after a change the client already received
+ * the mutex of the list has to be held, so no change is lost between the missed and the new changes
+ * sequence:	sequence number of the last change the client received
+ * returns:		missed changes (see ChangesSince), false if the client has to load the whole list again,
+ *				channel with the new changes and function that stops watching (see Watch)
+ */
+func (todoList *TodoList) WatchSince(sequence int) ([]Change, bool, <-chan Change, func()) {
+	missed, resumed := todoList.ChangesSince(sequence)
+	changes, stop := todoList.Watch()
+	return missed, resumed, changes, stop
+}
+
+// returns the sequence number of the last change of the list (0 if the list never changed)
+func (todoList *TodoList) LastChange() int {
+	return todoList.lastChange
+}
+
+/* Returns the changes after a sequence number from the change log of the list
+ * is used to resume watching after a reconnect, without missing a change
+ * sequence:	sequence number of the last change the client received
+ * returns:		the missed changes in order, false if the changes are not in the log anymore
+ *				(or the sequence number is unknown) and the client has to load the whole list again
+ */
+func (todoList *TodoList) ChangesSince(sequence int) ([]Change, bool) {
+
+	if sequence < 0 || sequence > todoList.lastChange {
+		return nil, false
+	}
+	if sequence == todoList.lastChange {
+		return []Change{}, true
+	}
+
+	// the log holds the changes from lastChange - len(changeLog) + 1 to lastChange
+	oldest := todoList.lastChange - len(todoList.changeLog) + 1
+	if sequence+1 < oldest {
+		return nil, false
+	}
+
+	missed := todoList.changeLog[sequence+1-oldest:]
+	return append([]Change{}, missed...), true
+}
+
+// records a change that did not mark a todo as done, see publishChange
+func (todoList *TodoList) publish(changeType string, changedTodo *todo) {
+	todoList.publishChange(changeType, changedTodo, false)
+}
+
+/* Records a change in the change log and sends it to every watcher and webhook of the todo list
+ * is called by the methods that change the list, while the mutex of the list is held
+ * watchers that do not read their changes are dropped, so a slow client never blocks the list
+ * completed:	true if an update marked the todo as done (completed event of the webhooks)
+ */
+func (todoList *TodoList) publishChange(changeType string, changedTodo *todo, completed bool) {
+
+	// every change of the list is stamped for the replicas
+	todoList.trackReplicaState(changeType, changedTodo)
+
+	// the log and the watchers get a copy without the links, the todo may change again
+	todoList.lastChange++
+	event := Change{Id: todoList.lastChange, Type: changeType, Todo: *changedTodo, ListVersion: todoList.Version}
+	event.Todo.List, event.Todo.Prev, event.Todo.Next = nil, nil, nil
+
+	// keep only the last changes
+	todoList.changeLog = append(todoList.changeLog, event)
+	if len(todoList.changeLog) > ChangeLogSize {
+		todoList.changeLog = append([]Change{}, todoList.changeLog[len(todoList.changeLog)-ChangeLogSize:]...)
+	}
+
+	for watcher := range todoList.watchers {
+		select {
+		case watcher <- event:
+		default:
+			delete(todoList.watchers, watcher)
+			close(watcher)
+		}
+	}
+
+	todoList.dispatchWebhooks(event, completed)
+}
@@ -0,0 +1,351 @@
+package stores
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// algorithms of the signatures of access tokens
+const (
+	// Ed25519 keys created by the server, the public keys are published in the JWKS
+	AlgEdDSA = "EdDSA"
+	// shared secrets of the server and the gateway (ConfigureJWT)
+	AlgHS256 = "HS256"
+)
+
+const (
+	// issuer (iss) and audience (aud) of the access tokens
+	JWTIssuer   = "klaemsch.io/todo"
+	JWTAudience = "todo-api"
+	// access tokens expire after this duration, they are renewed with refresh tokens
+	JWTLifetime = 15 * time.Minute
+	// a new EdDSA key is created after this duration, older keys stay in the JWKS until their tokens expired
+	JWTKeyRotation = 24 * time.Hour
+	// allowed difference of the clocks of issuer and verifier for exp, nbf and iat
+	jwtLeeway = 30 * time.Second
+	// HS256 secrets need at least 32 bytes
+	minSecretLength = 32
+)
+
+// claims of the access tokens, the list and the role on the list are custom claims
+type jwtClaims struct {
+	Issuer string `json:"iss"`
+	// id of the user, empty for tokens that were issued for a list token or an access token of the list
+	Subject   string      `json:"sub,omitempty"`
+	Audience  interface{} `json:"aud"`
+	ExpiresAt int64       `json:"exp"`
+	NotBefore int64       `json:"nbf"`
+	IssuedAt  int64       `json:"iat"`
+	Id        string      `json:"jti"`
+	List      string      `json:"list"`
+	Role      string      `json:"role"`
+}
+
+// header of a signed token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// key that signs and verifies access tokens
+type signingKey struct {
+	kid     string
+	alg     string
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+	secret  []byte
+	created time.Time
+	// time a newer key took over, nil for the current key
+	retired *time.Time
+}
+
+// algorithm of new tokens and the keys of the server, guarded by the mutex
+var (
+	jwtAlgorithm     = AlgEdDSA
+	signingKeys      []*signingKey
+	signingKeysMutex sync.Mutex
+)
+
+/* Configures the signatures of access tokens
+ * algorithm:	EdDSA (default) or HS256
+ * secrets:		HS256 secrets shared with the gateway, the first one signs, all of them verify (rotation)
+ * returns:		error if the algorithm is unknown or a secret is too short
+ */
+func ConfigureJWT(algorithm string, secrets []string) error {
+
+	if algorithm == "" {
+		algorithm = AlgEdDSA
+	}
+	if algorithm != AlgEdDSA && algorithm != AlgHS256 {
+		return fmt.Errorf("unknown jwt algorithm %q, use EdDSA or HS256", algorithm)
+	}
+	if algorithm == AlgHS256 && len(secrets) == 0 {
+		return errors.New("HS256 needs at least one secret")
+	}
+
+	keys := []*signingKey{}
+	for _, secret := range secrets {
+		if len(secret) < minSecretLength {
+			return fmt.Errorf("jwt secrets need at least %v bytes", minSecretLength)
+		}
+		// the id of a secret is derived from it, so gateway and server agree without configuration
+		sum := sha256.Sum256([]byte(secret))
+		keys = append(keys, &signingKey{kid: "hs256-" + hex.EncodeToString(sum[:4]), alg: AlgHS256, secret: []byte(secret), created: time.Now()})
+	}
+
+	signingKeysMutex.Lock()
+	defer signingKeysMutex.Unlock()
+	jwtAlgorithm = algorithm
+	signingKeys = keys
+	return nil
+}
+
+/* Returns the key that signs new tokens
+ * EdDSA keys are rotated after JWTKeyRotation, retired keys are dropped after their last token expired
+ * the mutex of the keys has to be held
+ */
+func currentSigningKey() (*signingKey, error) {
+
+	if jwtAlgorithm == AlgHS256 {
+		for _, key := range signingKeys {
+			if key.alg == AlgHS256 {
+				return key, nil
+			}
+		}
+		return nil, errors.New("no HS256 secret configured")
+	}
+
+	now := time.Now()
+
+	// drop the keys of tokens that can not be valid anymore
+	kept := []*signingKey{}
+	for _, key := range signingKeys {
+		if key.retired == nil || now.Sub(*key.retired) < JWTLifetime+jwtLeeway {
+			kept = append(kept, key)
+		}
+	}
+	signingKeys = kept
+
+	var current *signingKey
+	for _, key := range signingKeys {
+		if key.alg == AlgEdDSA && key.retired == nil {
+			current = key
+		}
+	}
+	if current != nil && now.Sub(current.created) < JWTKeyRotation {
+		return current, nil
+	}
+
+	// create the next key, the previous one only verifies from now on
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := newToken(16)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		current.retired = &now
+	}
+	next := &signingKey{kid: kid, alg: AlgEdDSA, private: private, public: public, created: now}
+	signingKeys = append(signingKeys, next)
+	return next, nil
+}
+
+/* Returns the public keys of the server as JSON Web Key Set (RFC 7517)
+ * HS256 secrets are not published, the gateway knows them
+ */
+func JWKS() map[string]interface{} {
+
+	signingKeysMutex.Lock()
+	defer signingKeysMutex.Unlock()
+
+	// rotates the keys, so the set contains the key of the next tokens
+	if jwtAlgorithm == AlgEdDSA {
+		currentSigningKey()
+	}
+
+	keys := []interface{}{}
+	for _, key := range signingKeys {
+		if key.alg == AlgEdDSA {
+			keys = append(keys, map[string]interface{}{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"x":   base64.RawURLEncoding.EncodeToString(key.public),
+				"kid": key.kid,
+				"alg": AlgEdDSA,
+				"use": "sig",
+			})
+		}
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+// signs the signing input (header.claims) with the key
+func (key *signingKey) sign(input string) []byte {
+	if key.alg == AlgHS256 {
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write([]byte(input))
+		return mac.Sum(nil)
+	}
+	return ed25519.Sign(key.private, []byte(input))
+}
+
+// checks the signature of the signing input (header.claims) with the key
+func (key *signingKey) verify(input string, signature []byte) bool {
+	if key.alg == AlgHS256 {
+		return hmac.Equal(key.sign(input), signature)
+	}
+	return ed25519.Verify(key.public, []byte(input), signature)
+}
+
+/* Issues a signed access token for a list
+ * listId:	id of the list (list claim)
+ * subject:	id of the user, "" for list tokens and access tokens
+ * role:	role on the list (role claim)
+ * returns:	the token and its expiry or error
+ */
+func IssueJWT(listId string, subject string, role string) (string, time.Time, error) {
+
+	signingKeysMutex.Lock()
+	key, err := currentSigningKey()
+	signingKeysMutex.Unlock()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	jti, err := newToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(JWTLifetime)
+	claims := jwtClaims{
+		Issuer:    JWTIssuer,
+		Subject:   subject,
+		Audience:  JWTAudience,
+		ExpiresAt: expiresAt.Unix(),
+		NotBefore: now.Unix(),
+		IssuedAt:  now.Unix(),
+		Id:        jti,
+		List:      listId,
+		Role:      role,
+	}
+
+	header, _ := json.Marshal(jwtHeader{Alg: key.alg, Kid: key.kid, Typ: "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(key.sign(input)), expiresAt, nil
+}
+
+// checks if a bearer token is a JWT (three base64url parts), all other tokens are hex strings
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+/* Validates an access token
+ * the signature has to match a key of the server with the algorithm of the header (no "none", no HS256 with a public key),
+ * issuer, audience, expiry, not-before and the list and role claims are checked
+ * returns:	the claims or error
+ */
+func VerifyJWT(token string) (*jwtClaims, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	headerJson, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	header := jwtHeader{}
+	if err := json.Unmarshal(headerJson, &header); err != nil {
+		return nil, errors.New("malformed token header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+
+	// the key is chosen by its id, the algorithm of the header has to be the algorithm of the key
+	signingKeysMutex.Lock()
+	var key *signingKey
+	for _, candidate := range signingKeys {
+		if candidate.kid == header.Kid && candidate.alg == header.Alg {
+			key = candidate
+		}
+	}
+	signingKeysMutex.Unlock()
+
+	if key == nil {
+		return nil, errors.New("unknown signing key")
+	}
+	if !key.verify(parts[0]+"."+parts[1], signature) {
+		return nil, errors.New("invalid signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+	claims := jwtClaims{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != JWTIssuer:
+		return nil, errors.New("unknown issuer")
+	case !hasAudience(claims.Audience, JWTAudience):
+		return nil, errors.New("token is not meant for this api")
+	case now.After(time.Unix(claims.ExpiresAt, 0).Add(jwtLeeway)):
+		return nil, errors.New("token expired")
+	case now.Add(jwtLeeway).Before(time.Unix(claims.NotBefore, 0)):
+		return nil, errors.New("token is not valid yet")
+	case claims.List == "":
+		return nil, errors.New("token has no list claim")
+	case roleRanks[claims.Role] == 0:
+		return nil, errors.New("token has no valid role claim")
+	}
+	return &claims, nil
+}
+
+// checks the aud claim, a single audience or a list of audiences
+func hasAudience(claim interface{}, audience string) bool {
+	switch value := claim.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, entry := range value {
+			if entry == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// returns the role with fewer rights
+func LowerRole(first string, second string) string {
+	if roleRanks[first] < roleRanks[second] {
+		return first
+	}
+	return second
+}
@@ -0,0 +1,204 @@
+package stores
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// uses the default EdDSA keys again after the test, keys of other tests are dropped
+func resetJWTKeys(t *testing.T) {
+	t.Helper()
+	ConfigureJWT("", nil)
+	t.Cleanup(func() { ConfigureJWT("", nil) })
+}
+
+// returns the key that signs new tokens
+func testSigningKey(t *testing.T) *signingKey {
+	t.Helper()
+	signingKeysMutex.Lock()
+	defer signingKeysMutex.Unlock()
+	key, err := currentSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// signs the claims with the header, signature is the signature of the signing input
+func signTestJWT(header jwtHeader, claims jwtClaims, signature func(input string) []byte) string {
+	encodedHeader, _ := json.Marshal(header)
+	encodedClaims, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(encodedHeader) + "." + base64.RawURLEncoding.EncodeToString(encodedClaims)
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature(input))
+}
+
+// returns valid claims of the list, the cases change them
+func testClaims() jwtClaims {
+	now := time.Now()
+	return jwtClaims{
+		Issuer:    JWTIssuer,
+		Audience:  JWTAudience,
+		ExpiresAt: now.Add(JWTLifetime).Unix(),
+		NotBefore: now.Unix(),
+		IssuedAt:  now.Unix(),
+		Id:        "jti",
+		List:      "list",
+		Role:      RoleEditor,
+	}
+}
+
+func TestVerifyJWTClaims(t *testing.T) {
+	resetJWTKeys(t)
+	key := testSigningKey(t)
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		change func(claims *jwtClaims)
+		want   string
+	}{
+		{"valid", func(claims *jwtClaims) {}, ""},
+		{"audience in a list", func(claims *jwtClaims) { claims.Audience = []string{"other-api", JWTAudience} }, ""},
+		{"other audience", func(claims *jwtClaims) { claims.Audience = "other-api" }, "token is not meant for this api"},
+		{"no audience", func(claims *jwtClaims) { claims.Audience = nil }, "token is not meant for this api"},
+		{"other issuer", func(claims *jwtClaims) { claims.Issuer = "evil.example.com" }, "unknown issuer"},
+		{"expired within the leeway", func(claims *jwtClaims) { claims.ExpiresAt = now.Add(-jwtLeeway / 2).Unix() }, ""},
+		{"expired", func(claims *jwtClaims) { claims.ExpiresAt = now.Add(-jwtLeeway - time.Minute).Unix() }, "token expired"},
+		{"not valid yet within the leeway", func(claims *jwtClaims) { claims.NotBefore = now.Add(jwtLeeway / 2).Unix() }, ""},
+		{"not valid yet", func(claims *jwtClaims) { claims.NotBefore = now.Add(jwtLeeway + time.Minute).Unix() }, "token is not valid yet"},
+		{"no list", func(claims *jwtClaims) { claims.List = "" }, "token has no list claim"},
+		{"unknown role", func(claims *jwtClaims) { claims.Role = "admin" }, "token has no valid role claim"},
+	}
+
+	for _, test := range tests {
+		claims := testClaims()
+		test.change(&claims)
+		token := signTestJWT(jwtHeader{Alg: key.alg, Kid: key.kid, Typ: "JWT"}, claims, key.sign)
+
+		verified, err := VerifyJWT(token)
+		switch {
+		case test.want == "" && (err != nil || verified.List != claims.List || verified.Role != claims.Role):
+			t.Errorf("%v: got %+v (%v)", test.name, verified, err)
+		case test.want != "" && (err == nil || err.Error() != test.want):
+			t.Errorf("%v: got error %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+// the signature has to be made by the key of the kid with the algorithm of the key
+func TestVerifyJWTHeader(t *testing.T) {
+	resetJWTKeys(t)
+	key := testSigningKey(t)
+	claims := testClaims()
+
+	// HS256 with the public key as secret, the server must not verify EdDSA keys as HMAC secrets
+	withPublicKey := func(input string) []byte {
+		mac := hmac.New(sha256.New, key.public)
+		mac.Write([]byte(input))
+		return mac.Sum(nil)
+	}
+	noSignature := func(input string) []byte { return nil }
+	tampered := signTestJWT(jwtHeader{Alg: key.alg, Kid: key.kid}, claims, key.sign)
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"HS256 with the kid of an EdDSA key", signTestJWT(jwtHeader{Alg: AlgHS256, Kid: key.kid}, claims, withPublicKey), "unknown signing key"},
+		{"alg none", signTestJWT(jwtHeader{Alg: "none", Kid: key.kid}, claims, noSignature), "unknown signing key"},
+		{"no kid", signTestJWT(jwtHeader{Alg: key.alg}, claims, key.sign), "unknown signing key"},
+		{"unknown kid", signTestJWT(jwtHeader{Alg: key.alg, Kid: "unknown"}, claims, key.sign), "unknown signing key"},
+		{"tampered signature", tampered, "invalid signature"},
+		{"two parts", "eyJhbGciOiJub25lIn0.e30", "malformed token"},
+	}
+
+	for _, test := range tests {
+		if _, err := VerifyJWT(test.token); err == nil || err.Error() != test.want {
+			t.Errorf("%v: got error %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+// tokens of a retired key stay valid until they expired, then the key is dropped
+func TestJWTKeyRotation(t *testing.T) {
+	resetJWTKeys(t)
+
+	oldToken, _, _ := IssueJWT("list", "", RoleOwner)
+	oldKey := testSigningKey(t)
+
+	// the key is older than the rotation interval
+	signingKeysMutex.Lock()
+	oldKey.created = time.Now().Add(-JWTKeyRotation - time.Minute)
+	signingKeysMutex.Unlock()
+
+	newToken, _, _ := IssueJWT("list", "", RoleOwner)
+	newKey := testSigningKey(t)
+	if newKey == oldKey || oldKey.retired == nil {
+		t.Fatalf("the key was not rotated")
+	}
+	if keys := JWKS()["keys"].([]interface{}); len(keys) != 2 {
+		t.Errorf("got %v keys in the JWKS, want the retired and the current key", len(keys))
+	}
+	if _, err := VerifyJWT(oldToken); err != nil {
+		t.Errorf("token of the retired key: %v", err)
+	}
+	if _, err := VerifyJWT(newToken); err != nil {
+		t.Errorf("token of the current key: %v", err)
+	}
+
+	// the last token of the retired key expired
+	signingKeysMutex.Lock()
+	retired := time.Now().Add(-JWTLifetime - jwtLeeway - time.Minute)
+	oldKey.retired = &retired
+	signingKeysMutex.Unlock()
+
+	if keys := JWKS()["keys"].([]interface{}); len(keys) != 1 {
+		t.Errorf("got %v keys in the JWKS, want the current key", len(keys))
+	}
+	if _, err := VerifyJWT(oldToken); err == nil || err.Error() != "unknown signing key" {
+		t.Errorf("token of the dropped key: got %v", err)
+	}
+	if _, err := VerifyJWT(newToken); err != nil {
+		t.Errorf("token of the current key: %v", err)
+	}
+}
+
+// the first secret signs, all of them verify, so gateway and server can rotate secrets
+func TestHS256SecretRotation(t *testing.T) {
+	resetJWTKeys(t)
+	first, second := strings.Repeat("a", minSecretLength), strings.Repeat("b", minSecretLength)
+
+	if err := ConfigureJWT(AlgHS256, []string{first}); err != nil {
+		t.Fatal(err)
+	}
+	token, _, _ := IssueJWT("list", "", RoleOwner)
+
+	ConfigureJWT(AlgHS256, []string{second, first})
+	if _, err := VerifyJWT(token); err != nil {
+		t.Errorf("token of the previous secret: %v", err)
+	}
+	if keys := JWKS()["keys"].([]interface{}); len(keys) != 0 {
+		t.Errorf("the JWKS publishes %v secrets", len(keys))
+	}
+
+	ConfigureJWT(AlgHS256, []string{second})
+	if _, err := VerifyJWT(token); err == nil {
+		t.Errorf("token of a removed secret is valid")
+	}
+
+	for _, secrets := range [][]string{nil, {"short"}} {
+		if err := ConfigureJWT(AlgHS256, secrets); err == nil {
+			t.Errorf("secrets %v were accepted", secrets)
+		}
+	}
+	if err := ConfigureJWT("RS256", nil); err == nil {
+		t.Errorf("unknown algorithm was accepted")
+	}
+}
@@ -0,0 +1,258 @@
+package stores
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maximum number of lists of a single user
+const MaxListsPerUser = 100
+
+// maximum length of the description of a list
+const maxDescriptionLength = 1000
+
+// colors of lists are hex colors like #1e90ff
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// json fields of a list a client can change
+var listFields = []string{"name", "description", "color", "archived"}
+
+// fields of a list that are set by its owner
+type listMetadata struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Color       string `json:"color"`
+	Archived    bool   `json:"archived"`
+}
+
+// structure of a list in the overview of the lists of a user
+type listSummary struct {
+	Id string `json:"id"`
+	listMetadata
+	// position of the list in the order of the lists of the user, starts with 0
+	Position  int       `json:"position"`
+	Created   time.Time `json:"created"`
+	Version   int       `json:"version"`
+	TodoCount int       `json:"todoCount"`
+	OpenCount int       `json:"openCount"`
+}
+
+// structure of a request body that orders the lists of a user
+type listOrder struct {
+	Lists []string `json:"lists"`
+}
+
+/* Decodes the metadata of a new list
+ * r:		request with json body
+ * returns:	metadata or error (ValidationError with every violation)
+ */
+func ListMetadataFromJson(r *http.Request) (listMetadata, error) {
+	return decodeListMetadata(r, listMetadata{})
+}
+
+/* Applies a merge patch (RFC 7396) to the metadata of a list
+ * only the sent fields are changed (rename, describe, color, archive)
+ * returns:	the patched metadata or error (ValidationError with every violation)
+ */
+func PatchListFromJson(r *http.Request, todoList *TodoList) (listMetadata, error) {
+	return decodeListMetadata(r, todoList.metadata())
+}
+
+// decodes the fields of the request body into the metadata and checks the rules
+func decodeListMetadata(r *http.Request, metadata listMetadata) (listMetadata, error) {
+
+	body, err := readBody(r)
+	if err != nil {
+		return metadata, err
+	}
+
+	validationError := &ValidationError{}
+	if err := decodeFields(body, &metadata, "", listFields, validationError); err != nil {
+		return metadata, err
+	}
+
+	metadata.Name = strings.TrimSpace(metadata.Name)
+	if metadata.Name == "" {
+		validationError.Add("name", "required", "must not be empty")
+	} else if utf8.RuneCountInString(metadata.Name) > Rules.MaxNameLength {
+		validationError.Add("name", "too_long", fmt.Sprintf("must not be longer than %v characters", Rules.MaxNameLength))
+	}
+	if utf8.RuneCountInString(metadata.Description) > maxDescriptionLength {
+		validationError.Add("description", "too_long", fmt.Sprintf("must not be longer than %v characters", maxDescriptionLength))
+	}
+	if metadata.Color != "" && !colorPattern.MatchString(metadata.Color) {
+		validationError.Add("color", "invalid_value", "has to be a hex color like #1e90ff")
+	}
+
+	if err := validationError.OrNil(); err != nil {
+		return metadata, err
+	}
+	return metadata, nil
+}
+
+// returns the metadata of the list
+func (todoList *TodoList) metadata() listMetadata {
+	return listMetadata{todoList.Name, todoList.Description, todoList.Color, todoList.Archived}
+}
+
+/* Changes the metadata of the list
+ * the mutex of the list has to be held
+ */
+func (todoList *TodoList) SetMetadata(metadata listMetadata) {
+	todoList.Name, todoList.Description, todoList.Color, todoList.Archived = metadata.Name, metadata.Description, metadata.Color, metadata.Archived
+	todoList.Version++
+}
+
+/* Returns the overview of the list with the number of todos and open todos
+ * the mutex of the list has to be held
+ */
+func (todoList *TodoList) Summary() listSummary {
+	summary := listSummary{
+		Id:           todoList.Id,
+		listMetadata: todoList.metadata(),
+		Created:      todoList.Created,
+		Version:      todoList.Version,
+	}
+	// the position is guarded by the mutex of the store, it is changed with the positions of the other lists
+	todoListStoreMutex.Lock()
+	summary.Position = todoList.Position
+	todoListStoreMutex.Unlock()
+
+	for currentTodo := todoList.Start; currentTodo != nil; currentTodo = currentTodo.Next {
+		summary.TodoCount++
+		if !currentTodo.Done {
+			summary.OpenCount++
+		}
+	}
+	return summary
+}
+
+/* Creates a named list of a user, the list is added at the end of the lists of the user
+ * returns:	the new list or ErrQuota if the user has too many lists
+ */
+func NewNamedTodoList(owner string, metadata listMetadata) (*TodoList, error) {
+
+	listId, _, err := NewTodoList(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	todoList := GetTodoListById(listId)
+	todoList.Lock()
+	todoList.SetMetadata(metadata)
+	todoList.Unlock()
+	return todoList, nil
+}
+
+/* Returns the lists of a user in the order of the user
+ * userId:	id of the user
+ */
+func GetTodoListsOfUser(userId string) []*TodoList {
+	todoListStoreMutex.Lock()
+	defer todoListStoreMutex.Unlock()
+
+	todoLists := []*TodoList{}
+	for _, todoList := range todoListStore {
+		if todoList.Owner == userId {
+			todoLists = append(todoLists, todoList)
+		}
+	}
+	sort.SliceStable(todoLists, func(i, j int) bool {
+		return todoLists[i].Position < todoLists[j].Position
+	})
+	return todoLists
+}
+
+/* Decodes the new order of the lists of a user
+ * r:		request with json body
+ * returns:	ids of the lists in the new order or error
+ */
+func ListOrderFromJson(r *http.Request) (listOrder, error) {
+
+	order := listOrder{}
+
+	body, err := readBody(r)
+	if err != nil {
+		return order, err
+	}
+	if err := json.Unmarshal(body, &order); err != nil {
+		return order, err
+	}
+	return order, nil
+}
+
+/* Orders the lists of a user
+ * the order has to contain every list of the user exactly once
+ * returns:	error (ValidationError) if the order does not match the lists of the user
+ */
+func ReorderTodoLists(userId string, order listOrder) error {
+
+	todoLists := map[string]*TodoList{}
+	for _, todoList := range GetTodoListsOfUser(userId) {
+		todoLists[todoList.Id] = todoList
+	}
+
+	validationError := &ValidationError{}
+	seen := map[string]bool{}
+	for index, listId := range order.Lists {
+		field := fmt.Sprintf("lists[%v]", index)
+		if todoLists[listId] == nil {
+			validationError.Add(field, "invalid_value", "is not a list of the user")
+		} else if seen[listId] {
+			validationError.Add(field, "duplicate", "is a duplicate list")
+		}
+		seen[listId] = true
+	}
+	if len(order.Lists) != len(todoLists) {
+		validationError.Add("lists", "invalid_value", fmt.Sprintf("has to contain every list of the user (%v lists)", len(todoLists)))
+	}
+	if err := validationError.OrNil(); err != nil {
+		return err
+	}
+
+	todoListStoreMutex.Lock()
+	for position, listId := range order.Lists {
+		todoLists[listId].Position = position
+	}
+	todoListStoreMutex.Unlock()
+	return nil
+}
+
+/* Removes a todo list with all of its todos from the todo list store
+ * the mutex of the list has to be held, clients that watch the list are disconnected
+ * returns:	error if the list was not found
+ */
+func RemoveTodoList(todoList *TodoList) error {
+
+	todoListStoreMutex.Lock()
+	defer todoListStoreMutex.Unlock()
+
+	for index, existing := range todoListStore {
+		if existing == todoList {
+			todoListStore = append(todoListStore[:index], todoListStore[index+1:]...)
+
+			// the following lists of the owner move up
+			for _, other := range todoListStore {
+				if todoList.Owner != "" && other.Owner == todoList.Owner && other.Position > todoList.Position {
+					other.Position--
+				}
+			}
+
+			for watcher := range todoList.watchers {
+				delete(todoList.watchers, watcher)
+				close(watcher)
+			}
+			todoList.webhooks = nil
+			todoList.removeShareTokens()
+			todoList.removeAccessTokens()
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: todo list %v", ErrNotFound, todoList.Id)
+}
@@ -0,0 +1,138 @@
+package stores
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// creates named lists of the owner and returns their ids
+func newTestLists(t *testing.T, owner string, names ...string) map[string]string {
+	t.Helper()
+	listIds := map[string]string{}
+	for _, name := range names {
+		todoList, err := NewNamedTodoList(owner, listMetadata{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		listIds[name] = todoList.Id
+	}
+	return listIds
+}
+
+// checks the names of the lists of the owner in their order and their positions
+func checkListOrder(t *testing.T, owner string, want []string) {
+	t.Helper()
+	names := []string{}
+	for position, todoList := range GetTodoListsOfUser(owner) {
+		todoList.Lock()
+		summary := todoList.Summary()
+		todoList.Unlock()
+		if summary.Position != position {
+			t.Errorf("list %v has the position %v, want %v", summary.Name, summary.Position, position)
+		}
+		names = append(names, summary.Name)
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got lists %v, want %v", names, want)
+	}
+}
+
+// new lists are added at the end, removed lists close the gap, the order contains every list once
+func TestReorderTodoLists(t *testing.T) {
+	// the store is shared by all tests, random owners start without lists
+	owner, _ := randomString()
+	other, _ := randomString()
+	listIds := newTestLists(t, owner, "work", "home", "shopping")
+	otherIds := newTestLists(t, other, "other")
+	checkListOrder(t, owner, []string{"work", "home", "shopping"})
+
+	if err := ReorderTodoLists(owner, listOrder{[]string{listIds["shopping"], listIds["work"], listIds["home"]}}); err != nil {
+		t.Fatal(err)
+	}
+	checkListOrder(t, owner, []string{"shopping", "work", "home"})
+
+	invalid := map[string][]string{
+		"missing list":         {listIds["shopping"], listIds["work"]},
+		"duplicate list":       {listIds["shopping"], listIds["work"], listIds["work"]},
+		"list of another user": {listIds["shopping"], listIds["work"], otherIds["other"]},
+	}
+	for name, lists := range invalid {
+		if err := ReorderTodoLists(owner, listOrder{lists}); !errors.Is(err, ErrValidation) {
+			t.Errorf("%v: got %v, want ErrValidation", name, err)
+		}
+	}
+	checkListOrder(t, owner, []string{"shopping", "work", "home"})
+
+	work := GetTodoListById(listIds["work"])
+	work.Lock()
+	RemoveTodoList(work)
+	work.Unlock()
+	checkListOrder(t, owner, []string{"shopping", "home"})
+
+	newTestLists(t, owner, "garden")
+	checkListOrder(t, owner, []string{"shopping", "home", "garden"})
+	checkListOrder(t, other, []string{"other"})
+}
+
+// archiving only changes the archived field of the metadata and the version of the list
+func TestArchiveTodoList(t *testing.T) {
+	listIds := newTestLists(t, "archive-owner", "work")
+	todoList := GetTodoListById(listIds["work"])
+
+	todoList.Lock()
+	defer todoList.Unlock()
+	todoList.SetMetadata(listMetadata{Name: "work", Description: "office", Color: "#1e90ff"})
+	version := todoList.Version
+
+	metadata, err := PatchListFromJson(httptest.NewRequest("PATCH", "/lists/x", strings.NewReader(`{"archived":true}`)), todoList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todoList.SetMetadata(metadata)
+
+	summary := todoList.Summary()
+	want := listMetadata{Name: "work", Description: "office", Color: "#1e90ff", Archived: true}
+	if summary.listMetadata != want || summary.Version != version+1 {
+		t.Errorf("got %+v with version %v, want %+v with version %v", summary.listMetadata, summary.Version, want, version+1)
+	}
+
+	metadata, _ = PatchListFromJson(httptest.NewRequest("PATCH", "/lists/x", strings.NewReader(`{"archived":false}`)), todoList)
+	if metadata.Archived || metadata.Name != "work" {
+		t.Errorf("got %+v after the list was restored", metadata)
+	}
+}
+
+// concurrent requests for new lists can not exceed the quota of the user
+func TestNewNamedTodoListQuota(t *testing.T) {
+	owner, _ := randomString()
+	for i := 0; i < MaxListsPerUser-1; i++ {
+		newTestLists(t, owner, "list")
+	}
+
+	// the last free list is requested by many requests at the same time
+	start := make(chan struct{})
+	results := make(chan error)
+	for i := 0; i < 50; i++ {
+		go func() {
+			<-start
+			_, err := NewNamedTodoList(owner, listMetadata{Name: "last"})
+			results <- err
+		}()
+	}
+	close(start)
+
+	created := 0
+	for i := 0; i < 50; i++ {
+		if err := <-results; err == nil {
+			created++
+		} else if !errors.Is(err, ErrQuota) {
+			t.Errorf("got %v, want ErrQuota", err)
+		}
+	}
+	if created != 1 || len(GetListIdsOfUser(owner)) != MaxListsPerUser {
+		t.Errorf("created %v lists, the user has %v lists, want %v", created, len(GetListIdsOfUser(owner)), MaxListsPerUser)
+	}
+}
@@ -0,0 +1,190 @@
+package stores
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// roles of users on a list, every role includes the rights of the roles before it
+const (
+	// reads the todos of the list
+	RoleViewer = "viewer"
+	// reads the todos and marks them as done or not done
+	RoleCompleter = "completer"
+	// changes, adds, moves and deletes todos
+	RoleEditor = "editor"
+	// changes the list itself (metadata, members, webhooks) and deletes it
+	RoleOwner = "owner"
+)
+
+// rank of every role, a role includes the rights of the roles with a lower rank
+var roleRanks = map[string]int{RoleViewer: 1, RoleCompleter: 2, RoleEditor: 3, RoleOwner: 4}
+
+// maximum number of users a list can be shared with
+const MaxMembersPerList = 50
+
+// json fields of an invitation
+var memberFields = []string{"role"}
+
+// structure of a user a list is shared with
+type member struct {
+	UserId   string    `json:"userId"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	Added    time.Time `json:"added"`
+}
+
+// role sent by the owner to invite a user or to change the role of a member
+type memberRequest struct {
+	Role string `json:"role"`
+}
+
+// structure of a list that was shared with a user, in the profile of the user
+type sharedList struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+/* Checks if a role includes the rights of the required role
+ * role:		role of the user ("" if the user has no access)
+ * required:	role the request needs
+ */
+func HasRole(role string, required string) bool {
+	return roleRanks[role] > 0 && roleRanks[role] >= roleRanks[required]
+}
+
+/* Returns the role of a user on the list
+ * the owner of the list (and every list token of a list without owner) has the owner role
+ * userId:	id of the user of the session, "" for requests with a list token
+ * returns:	the role or "" if the list is not shared with the user
+ */
+func (todoList *TodoList) RoleOf(userId string) string {
+	if todoList.Owner == userId {
+		return RoleOwner
+	}
+	for _, existing := range todoList.members {
+		if existing.UserId == userId {
+			return existing.Role
+		}
+	}
+	return ""
+}
+
+/* Decodes the role of an invitation
+ * r:		request with json body
+ * returns:	role or error (ValidationError if the role is unknown)
+ */
+func MemberFromJson(r *http.Request) (memberRequest, error) {
+
+	request := memberRequest{}
+
+	body, err := readBody(r)
+	if err != nil {
+		return request, err
+	}
+
+	validationError := &ValidationError{}
+	if err := decodeFields(body, &request, "", memberFields, validationError); err != nil {
+		return request, err
+	}
+
+	if roleRanks[request.Role] == 0 {
+		validationError.Add("role", "invalid_value", "has to be viewer, completer, editor or owner")
+	}
+
+	if err := validationError.OrNil(); err != nil {
+		return request, err
+	}
+	return request, nil
+}
+
+/* Returns every user with access to the list, the owner first
+ * the mutex of the list has to be held
+ */
+func (todoList *TodoList) GetMembers() []member {
+	members := []member{}
+	if owner := GetUserById(todoList.Owner); owner != nil {
+		members = append(members, member{owner.Id, owner.Username, RoleOwner, todoList.Created})
+	}
+	return append(members, todoList.members...)
+}
+
+/* Shares the list with a user or changes the role of a member
+ * the owner of the list keeps its role, lists without owner can not be shared
+ * returns:	the member, true if the user was invited, or error (ErrConflict, ErrQuota)
+ */
+func (todoList *TodoList) SetMember(user *User, role string) (member, bool, error) {
+
+	if todoList.Owner == "" {
+		return member{}, false, fmt.Errorf("%w: only lists of users can be shared", ErrConflict)
+	}
+	if user.Id == todoList.Owner {
+		return member{}, false, fmt.Errorf("%w: the role of the owner of the list can not be changed", ErrConflict)
+	}
+
+	// change the role of a member
+	for index, existing := range todoList.members {
+		if existing.UserId == user.Id {
+			todoList.members[index].Role = role
+			return todoList.members[index], false, nil
+		}
+	}
+
+	if len(todoList.members) >= MaxMembersPerList {
+		err := fmt.Errorf("%w: a list can be shared with at most %v users", ErrQuota, MaxMembersPerList)
+		return member{}, false, err
+	}
+
+	newMember := member{user.Id, user.Username, role, time.Now()}
+	todoList.members = append(todoList.members, newMember)
+	return newMember, true, nil
+}
+
+/* Revokes the access of a member to the list
+ * returns:	the removed member or ErrNotFound
+ */
+func (todoList *TodoList) RemoveMember(userId string) (member, error) {
+	for index, existing := range todoList.members {
+		if existing.UserId == userId {
+			todoList.members = append(todoList.members[:index], todoList.members[index+1:]...)
+			return existing, nil
+		}
+	}
+	return member{}, fmt.Errorf("%w: member of the list", ErrNotFound)
+}
+
+/* Returns the lists of other users that were shared with a user
+ * userId:	id of the user
+ */
+func GetSharedListsOfUser(userId string) []sharedList {
+
+	// the lists are locked one after another, not while the store is locked
+	todoListStoreMutex.Lock()
+	todoLists := append([]*TodoList{}, todoListStore...)
+	todoListStoreMutex.Unlock()
+
+	shared := []sharedList{}
+	for _, todoList := range todoLists {
+		todoList.Lock()
+		if role := todoList.RoleOf(userId); role != "" && todoList.Owner != userId {
+			shared = append(shared, sharedList{todoList.Id, todoList.Name, role})
+		}
+		todoList.Unlock()
+	}
+	return shared
+}
+
+/* Checks if an update of a todo only marks it as done or not done
+ * users with the completer role can not change anything else
+ */
+func OnlyDoneChanged(oldTodo *todo, updatedTodo *todo) bool {
+	oldFields, updatedFields := jsonFields(oldTodo), jsonFields(updatedTodo)
+	for _, field := range todoSyncFields {
+		if field != "done" && !sameValue(oldFields[field], updatedFields[field]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,363 @@
+package stores
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// content types of the supported patch formats
+const (
+	MergePatchContentType = "application/merge-patch+json" // RFC 7396
+	JsonPatchContentType  = "application/json-patch+json"  // RFC 6902
+)
+
+// returned if a well-formed patch can not be applied to the todo (e.g. failed test operation), matches ErrConflict
+var ErrPatchNotApplicable = fmt.Errorf("patch could not be applied: %w", ErrConflict)
+
+// a single operation of a json patch document (RFC 6902)
+type patchOperation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From string `json:"from"`
+	// null is a valid value, so a missing value is only recognized by an empty message
+	Value json.RawMessage `json:"value"`
+}
+
+/* Applies the patch in the request body to a copy of a todo, the todo itself is not changed
+ * r:			request with a merge patch or json patch body (selected by the Content-Type header)
+ * oldTodo:		todo the patch is applied to
+ * returns:		pointer to the temporary, patched todo, a possible moving order or error
+ */
+func PatchTodoFromJson(r *http.Request, oldTodo *todo) (*todo, *changeOrder, error) {
+
+	// read the whole patch document
+	body, err := readBody(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return PatchTodoFromBytes(body, r.Header.Get("Content-Type"), oldTodo)
+}
+
+/* Applies a patch to a copy of a todo, the todo itself is not changed
+ * body:		merge patch or json patch document
+ * contentType:	format of the patch (MergePatchContentType or JsonPatchContentType)
+ * oldTodo:		todo the patch is applied to
+ * returns:		pointer to the temporary, patched todo, a possible moving order or error (ErrUnsupportedMediaType for other formats)
+ */
+func PatchTodoFromBytes(body []byte, contentType string, oldTodo *todo) (*todo, *changeOrder, error) {
+
+	// convert the current todo into a generic json document
+	encodedTodo, err := json.Marshal(oldTodo)
+	if err != nil {
+		return nil, nil, err
+	}
+	var document interface{}
+	json.Unmarshal(encodedTodo, &document)
+
+	// apply the patch depending on its format
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case JsonPatchContentType:
+		var operations []patchOperation
+		if err := json.Unmarshal(body, &operations); err != nil {
+			return nil, nil, err
+		}
+		document, err = applyJsonPatch(document, operations)
+	case MergePatchContentType:
+		var patch interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return nil, nil, err
+		}
+		document = mergePatch(document, patch)
+	default:
+		return nil, nil, fmt.Errorf("%w: send the patch as %v or %v", ErrUnsupportedMediaType, MergePatchContentType, JsonPatchContentType)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// convert the patched document back into a todoUpdate and validate it like a PUT body
+	encodedTodo, _ = json.Marshal(document)
+	validationError := &ValidationError{}
+	todoUpdate, err := decodeTodo(encodedTodo, "", false, validationError)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: patched todo is not an object", ErrValidation)
+	}
+	if err := validationError.OrNil(); err != nil {
+		return nil, nil, err
+	}
+
+	// the id of a todo can not be patched
+	todoUpdate.Id = oldTodo.Id
+
+	patchedTodo, changeOrder := todoFromUpdate(todoUpdate)
+	return patchedTodo, changeOrder, nil
+}
+
+/* Applies a json merge patch to a json document (RFC 7396, section 2)
+ * objects are merged recursively, null removes a member, every other value replaces the target
+ */
+func mergePatch(target interface{}, patch interface{}) interface{} {
+
+	// patch is not an object -> replaces the whole target
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	// target is not an object -> start with an empty one
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+/* Applies the operations of a json patch to a json document (RFC 6902)
+ * the operations are applied in order, if one fails the whole patch fails
+ */
+func applyJsonPatch(document interface{}, operations []patchOperation) (interface{}, error) {
+
+	for _, operation := range operations {
+
+		// decode the value of the operation (only used by add, replace and test)
+		var value interface{}
+		if len(operation.Value) > 0 {
+			json.Unmarshal(operation.Value, &value)
+		} else if operation.Op == "add" || operation.Op == "replace" || operation.Op == "test" {
+			return nil, fmt.Errorf("%w: operation %v needs a value", ErrPatchNotApplicable, operation.Op)
+		}
+
+		var err error
+		switch operation.Op {
+		case "add":
+			document, err = pointerAdd(document, operation.Path, value)
+		case "remove":
+			document, _, err = pointerRemove(document, operation.Path)
+		case "replace":
+			// the empty pointer replaces the whole document, which can not be removed first
+			if operation.Path == "" {
+				document = value
+				break
+			}
+			document, _, err = pointerRemove(document, operation.Path)
+			if err == nil {
+				document, err = pointerAdd(document, operation.Path, value)
+			}
+		case "move":
+			var moved interface{}
+			document, moved, err = pointerRemove(document, operation.From)
+			if err == nil {
+				document, err = pointerAdd(document, operation.Path, moved)
+			}
+		case "copy":
+			var copied interface{}
+			copied, err = pointerGet(document, operation.From)
+			if err == nil {
+				document, err = pointerAdd(document, operation.Path, deepCopy(copied))
+			}
+		case "test":
+			var current interface{}
+			current, err = pointerGet(document, operation.Path)
+			if err == nil && !reflect.DeepEqual(current, value) {
+				err = fmt.Errorf("%w: test of %v failed", ErrPatchNotApplicable, operation.Path)
+			}
+		default:
+			err = fmt.Errorf("%w: unknown operation %q", ErrPatchNotApplicable, operation.Op)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return document, nil
+}
+
+/* Splits a json pointer (RFC 6901) into its unescaped reference tokens
+ * the empty pointer "" references the whole document and has no tokens
+ */
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: invalid pointer %q", ErrPatchNotApplicable, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for index, token := range tokens {
+		tokens[index] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+/* Converts a reference token into an array index
+ * length:		length of the array
+ * allowEnd:	if true, "-" and length reference the position after the last element
+ */
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > length || (index == length && !allowEnd) {
+		return -1, fmt.Errorf("%w: invalid array index %q", ErrPatchNotApplicable, token)
+	}
+	return index, nil
+}
+
+// returns the value the pointer references in the document
+func pointerGet(document interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	current := document
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: path %v does not exist", ErrPatchNotApplicable, pointer)
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("%w: path %v does not exist", ErrPatchNotApplicable, pointer)
+		}
+	}
+	return current, nil
+}
+
+/* Adds the value at the position the pointer references
+ * objects: adds or replaces the member, arrays: inserts the value before the index
+ * returns the changed document
+ */
+func pointerAdd(document interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	// empty pointer -> the value replaces the whole document
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	// find the parent of the target location
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, err := pointerGet(document, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+	lastToken := tokens[len(tokens)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[lastToken] = value
+		return document, nil
+	case []interface{}:
+		index, err := arrayIndex(lastToken, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node[:index], append([]interface{}{value}, node[index:]...)...)
+		return pointerReplaceArray(document, parentPointer, node)
+	default:
+		return nil, fmt.Errorf("%w: path %v does not exist", ErrPatchNotApplicable, pointer)
+	}
+}
+
+/* Removes the value the pointer references
+ * returns the changed document and the removed value
+ */
+func pointerRemove(document interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("%w: the whole document can not be removed", ErrPatchNotApplicable)
+	}
+
+	// find the parent of the target location
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, err := pointerGet(document, parentPointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	lastToken := tokens[len(tokens)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		removed, ok := node[lastToken]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: path %v does not exist", ErrPatchNotApplicable, pointer)
+		}
+		delete(node, lastToken)
+		return document, removed, nil
+	case []interface{}:
+		index, err := arrayIndex(lastToken, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		removed := node[index]
+		node = append(node[:index:index], node[index+1:]...)
+		document, err = pointerReplaceArray(document, parentPointer, node)
+		return document, removed, err
+	default:
+		return nil, nil, fmt.Errorf("%w: path %v does not exist", ErrPatchNotApplicable, pointer)
+	}
+}
+
+/* Stores a changed array at the position the pointer references
+ * needed because appending to a slice can return a new slice
+ */
+func pointerReplaceArray(document interface{}, pointer string, array []interface{}) (interface{}, error) {
+	tokens, _ := parsePointer(pointer)
+	if len(tokens) == 0 {
+		return array, nil
+	}
+	parent, err := pointerGet(document, pointer[:strings.LastIndex(pointer, "/")])
+	if err != nil {
+		return nil, err
+	}
+	lastToken := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[lastToken] = array
+	case []interface{}:
+		index, err := arrayIndex(lastToken, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = array
+	}
+	return document, nil
+}
+
+// copies a generic json value, so copied values do not share maps or slices
+func deepCopy(value interface{}) interface{} {
+	encoded, _ := json.Marshal(value)
+	var copied interface{}
+	json.Unmarshal(encoded, &copied)
+	return copied
+}
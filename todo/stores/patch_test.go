@@ -0,0 +1,161 @@
+package stores
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// decodes a json value for the table of a test
+func decodeJson(t *testing.T, value string) interface{} {
+	t.Helper()
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		t.Fatalf("invalid json %v: %v", value, err)
+	}
+	return decoded
+}
+
+// examples of RFC 7396, appendix A
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target string
+		patch  string
+		want   string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, test := range tests {
+		got := mergePatch(decodeJson(t, test.target), decodeJson(t, test.patch))
+		if want := decodeJson(t, test.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("merge %v into %v: got %v, want %v", test.patch, test.target, got, want)
+		}
+	}
+}
+
+// examples of RFC 6902, appendix A, and the errors of invalid pointers
+func TestApplyJsonPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		document   string
+		operations string
+		want       string
+		// the patch has to fail with ErrPatchNotApplicable
+		fails bool
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, false},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, false},
+		{"add to the end", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`, false},
+		{"add nested member", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`, false},
+		{"add replaces the document", `{"foo":"bar"}`, `[{"op":"add","path":"","value":{"baz":1}}]`, `{"baz":1}`, false},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, false},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, false},
+		{"replace value", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, false},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, false},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, false},
+		{"copy is independent", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, false},
+		{"test succeeds", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`, false},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`, false},
+		{"test null", `{"a":null}`, `[{"op":"test","path":"/a","value":null}]`, `{"a":null}`, false},
+		{"test fails", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ``, true},
+		{"test of a number is not a string", `{"/":9}`, `[{"op":"test","path":"/~1","value":"9"}]`, ``, true},
+		{"add to a missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ``, true},
+		{"add out of bounds", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"qux"}]`, ``, true},
+		{"leading zero is no index", `{"foo":["bar","baz"]}`, `[{"op":"remove","path":"/foo/-1"}]`, ``, true},
+		{"remove missing member", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, ``, true},
+		{"remove end of array", `{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/-"}]`, ``, true},
+		{"remove the document", `{"foo":"bar"}`, `[{"op":"remove","path":""}]`, ``, true},
+		{"replace missing member", `{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":1}]`, ``, true},
+		{"pointer without slash", `{"foo":"bar"}`, `[{"op":"replace","path":"foo","value":1}]`, ``, true},
+		{"missing value", `{"foo":"bar"}`, `[{"op":"add","path":"/baz"}]`, ``, true},
+		{"unknown operation", `{"foo":"bar"}`, `[{"op":"merge","path":"/foo","value":1}]`, ``, true},
+		{"failing operation after a change", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":1},{"op":"test","path":"/foo","value":"x"}]`, ``, true},
+	}
+
+	for _, test := range tests {
+		var operations []patchOperation
+		if err := json.Unmarshal([]byte(test.operations), &operations); err != nil {
+			t.Fatalf("%v: invalid operations: %v", test.name, err)
+		}
+
+		got, err := applyJsonPatch(decodeJson(t, test.document), operations)
+
+		if test.fails {
+			if !errors.Is(err, ErrPatchNotApplicable) {
+				t.Errorf("%v: got error %v, want ErrPatchNotApplicable", test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.name, err)
+			continue
+		}
+		if want := decodeJson(t, test.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %v, want %v", test.name, got, want)
+		}
+	}
+}
+
+// patches of a todo keep the id and the todo itself, and are validated like a PUT body
+func TestPatchTodoFromBytes(t *testing.T) {
+	oldTodo := &todo{Id: 7, Name: "milk", Category: []string{"shop"}}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        todo
+		// the patch has to fail with the error
+		err error
+	}{
+		{"merge patch", MergePatchContentType, `{"done":true,"category":null}`, todo{Id: 7, Name: "milk", Done: true}, nil},
+		{"merge patch with charset", MergePatchContentType + "; charset=utf-8", `{"name":"bread"}`, todo{Id: 7, Name: "bread", Category: []string{"shop"}}, nil},
+		{"json patch", JsonPatchContentType, `[{"op":"add","path":"/category/-","value":"food"}]`, todo{Id: 7, Name: "milk", Category: []string{"shop", "food"}}, nil},
+		{"id is kept", MergePatchContentType, `{"id":99}`, todo{Id: 7, Name: "milk", Category: []string{"shop"}}, nil},
+		{"failed test", JsonPatchContentType, `[{"op":"test","path":"/name","value":"bread"}]`, todo{}, ErrConflict},
+		{"empty name", MergePatchContentType, `{"name":""}`, todo{}, ErrValidation},
+		{"unknown field", MergePatchContentType, `{"color":"red"}`, todo{}, ErrValidation},
+		{"document replaced by a string", JsonPatchContentType, `[{"op":"replace","path":"","value":"x"}]`, todo{}, ErrValidation},
+		{"plain json", "application/json", `{"done":true}`, todo{}, ErrUnsupportedMediaType},
+		{"plain text", "text/plain", `{"done":true}`, todo{}, ErrUnsupportedMediaType},
+		{"no content type", "", `{"done":true}`, todo{}, ErrUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		got, _, err := PatchTodoFromBytes([]byte(test.body), test.contentType, oldTodo)
+
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%v: got error %v, want %v", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.name, err)
+			continue
+		}
+		if got.Id != test.want.Id || got.Name != test.want.Name || got.Done != test.want.Done || !reflect.DeepEqual(got.Category, test.want.Category) {
+			t.Errorf("%v: got %+v, want %+v", test.name, *got, test.want)
+		}
+	}
+
+	if oldTodo.Name != "milk" || len(oldTodo.Category) != 1 {
+		t.Errorf("the patched todo was changed: %+v", *oldTodo)
+	}
+}
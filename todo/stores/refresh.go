@@ -0,0 +1,225 @@
+package stores
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// refresh tokens can be used for this duration
+	RefreshTokenLifetime = 30 * 24 * time.Hour
+	// length of a refresh token in characters
+	refreshTokenLength = 64
+)
+
+// credentials that can be exchanged for access tokens, the refresh is only possible while the credential is valid
+const (
+	// the id of a list without owner
+	CredentialList = "list"
+	// an access token of the list, followed by its id (access:3)
+	CredentialAccessToken = "access"
+	// the session of a user, followed by the id of the user (user:<id>)
+	CredentialUser = "user"
+)
+
+// json fields of a refresh or revocation request
+var refreshFields = []string{"refresh_token"}
+
+// structure of a refresh token, only the hash of the token is stored
+type refreshToken struct {
+	// every refresh creates a new token of the same family, a reused token revokes the whole family
+	family     string
+	listId     string
+	subject    string
+	role       string
+	credential string
+	expiresAt  time.Time
+	used       bool
+}
+
+// response of the token endpoints (RFC 6749)
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	List         string `json:"list"`
+	Role         string `json:"role"`
+}
+
+// request body of a refresh or a revocation
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refresh tokens by hash, guarded by the mutex
+var (
+	refreshTokens      = map[string]*refreshToken{}
+	refreshTokensMutex sync.Mutex
+)
+
+/* Decodes the refresh token of a refresh or revocation request
+ * r:		request with json body
+ * returns:	the request or error (ValidationError if the token is missing)
+ */
+func RefreshRequestFromJson(r *http.Request) (refreshRequest, error) {
+
+	request := refreshRequest{}
+
+	body, err := readBody(r)
+	if err != nil {
+		return request, err
+	}
+
+	validationError := &ValidationError{}
+	if err := decodeFields(body, &request, "", refreshFields, validationError); err != nil {
+		return request, err
+	}
+	if request.RefreshToken == "" {
+		validationError.Add("refresh_token", "required", "must not be empty")
+	}
+
+	if err := validationError.OrNil(); err != nil {
+		return request, err
+	}
+	return request, nil
+}
+
+/* Returns the current role of a credential on the list
+ * the mutex of the list has to be held
+ * returns:	the role or "" if the credential was revoked
+ */
+func (todoList *TodoList) credentialRole(credential string) string {
+
+	kind, id, _ := strings.Cut(credential, ":")
+	switch kind {
+	case CredentialList:
+		if todoList.Owner == "" && !todoList.idAccessDisabled {
+			return RoleOwner
+		}
+	case CredentialAccessToken:
+		if accessTokenId, err := strconv.Atoi(id); err == nil && todoList.getAccessToken(accessTokenId) != nil {
+			return RoleOwner
+		}
+	case CredentialUser:
+		return todoList.RoleOf(id)
+	}
+	return ""
+}
+
+/* Issues an access token and a refresh token for the list
+ * the mutex of the list has to be held
+ * credential:	the credential of the request (CredentialList, access:<id>, user:<id>)
+ * role:		the role of the credential on the list
+ * returns:		both tokens or error
+ */
+func (todoList *TodoList) IssueTokens(credential string, role string) (*tokenResponse, error) {
+	family, err := newToken(32)
+	if err != nil {
+		return nil, err
+	}
+	return todoList.issueTokens(family, credential, role)
+}
+
+// issues an access token and a refresh token of the family
+func (todoList *TodoList) issueTokens(family string, credential string, role string) (*tokenResponse, error) {
+
+	subject := ""
+	if kind, id, _ := strings.Cut(credential, ":"); kind == CredentialUser {
+		subject = id
+	}
+
+	accessToken, expiresAt, err := IssueJWT(todoList.Id, subject, role)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := newToken(refreshTokenLength)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	refreshTokensMutex.Lock()
+	// remove the expired refresh tokens while the store is locked anyway
+	for hash, existing := range refreshTokens {
+		if now.After(existing.expiresAt) {
+			delete(refreshTokens, hash)
+		}
+	}
+	refreshTokens[hashToken(token)] = &refreshToken{family, todoList.Id, subject, role, credential, now.Add(RefreshTokenLifetime), false}
+	refreshTokensMutex.Unlock()
+
+	return &tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(expiresAt).Seconds()),
+		RefreshToken: token,
+		List:         todoList.Id,
+		Role:         role,
+	}, nil
+}
+
+/* Exchanges a refresh token for a new access token and a new refresh token
+ * every refresh token can be used once, a reused token revokes all tokens of its family (it was probably stolen);
+ * the role of the new access token is checked against the current role of the credential
+ * returns:	both tokens or error if the refresh token is invalid or its credential was revoked
+ */
+func RefreshTokens(request refreshRequest) (*tokenResponse, error) {
+
+	hash := hashToken(request.RefreshToken)
+
+	refreshTokensMutex.Lock()
+	existing := refreshTokens[hash]
+	switch {
+	case existing == nil || time.Now().After(existing.expiresAt):
+		refreshTokensMutex.Unlock()
+		return nil, ErrInvalidRefreshToken
+	case existing.used:
+		revokeFamily(existing.family)
+		refreshTokensMutex.Unlock()
+		return nil, fmt.Errorf("%w: the refresh token was already used, all tokens of the login were revoked", ErrInvalidRefreshToken)
+	}
+	existing.used = true
+	refreshTokensMutex.Unlock()
+
+	todoList := GetTodoListById(existing.listId)
+	if todoList == nil {
+		return nil, fmt.Errorf("%w: the list does not exist anymore", ErrInvalidRefreshToken)
+	}
+
+	todoList.Lock()
+	defer todoList.Unlock()
+
+	current := todoList.credentialRole(existing.credential)
+	if current == "" {
+		return nil, fmt.Errorf("%w: the credential of the login was revoked", ErrInvalidRefreshToken)
+	}
+	return todoList.issueTokens(existing.family, existing.credential, LowerRole(existing.role, current))
+}
+
+/* Revokes a refresh token and every token of its family (RFC 7009)
+ * unknown tokens are ignored, the client can not find out which tokens exist
+ */
+func RevokeRefreshToken(request refreshRequest) {
+	refreshTokensMutex.Lock()
+	defer refreshTokensMutex.Unlock()
+	if existing := refreshTokens[hashToken(request.RefreshToken)]; existing != nil {
+		revokeFamily(existing.family)
+	}
+}
+
+/* Removes all refresh tokens of a family
+ * the mutex of the refresh tokens has to be held
+ */
+func revokeFamily(family string) {
+	for hash, existing := range refreshTokens {
+		if existing.family == family {
+			delete(refreshTokens, hash)
+		}
+	}
+}
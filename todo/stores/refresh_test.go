@@ -0,0 +1,101 @@
+package stores
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+/* Creates a list without owner and issues tokens for a new access token of the list
+ * returns:	the list, the id of the access token and the issued tokens
+ */
+func newTestLogin(t *testing.T) (*TodoList, int, *tokenResponse) {
+	t.Helper()
+	// the initial access token keeps the list open when the access token of the login is revoked
+	listId, _, err := NewTodoList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	todoList := GetTodoListById(listId)
+
+	todoList.Lock()
+	defer todoList.Unlock()
+	device, _ := todoList.AddAccessToken(accessToken{Name: "phone"})
+	tokens, err := todoList.IssueTokens(fmt.Sprintf("%v:%v", CredentialAccessToken, device.Id), RoleOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return todoList, device.Id, tokens
+}
+
+// every refresh token can be used once, a reused token revokes the tokens that were issued after it
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	_, _, first := newTestLogin(t)
+
+	second, err := RefreshTokens(refreshRequest{first.RefreshToken})
+	if err != nil || second.RefreshToken == first.RefreshToken || second.AccessToken == "" {
+		t.Fatalf("refresh: got %+v (%v)", second, err)
+	}
+	if claims, err := VerifyJWT(second.AccessToken); err != nil || claims.List != first.List || claims.Role != RoleOwner {
+		t.Errorf("refreshed access token: got %+v (%v)", claims, err)
+	}
+
+	// the first token was stolen and is used again
+	if _, err := RefreshTokens(refreshRequest{first.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("reuse: got %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := RefreshTokens(refreshRequest{second.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh after the reuse: got %v, want ErrInvalidRefreshToken", err)
+	}
+
+	// other logins of the list are not revoked
+	_, _, other := newTestLogin(t)
+	if _, err := RefreshTokens(refreshRequest{other.RefreshToken}); err != nil {
+		t.Errorf("refresh of another login: %v", err)
+	}
+}
+
+// revoked logins and revoked credentials can not be refreshed anymore
+func TestRefreshTokenRevocation(t *testing.T) {
+	_, _, revoked := newTestLogin(t)
+	next, _ := RefreshTokens(refreshRequest{revoked.RefreshToken})
+	RevokeRefreshToken(refreshRequest{revoked.RefreshToken})
+	if _, err := RefreshTokens(refreshRequest{next.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh of a revoked login: got %v, want ErrInvalidRefreshToken", err)
+	}
+
+	todoList, deviceId, tokens := newTestLogin(t)
+	todoList.Lock()
+	todoList.RemoveAccessToken(deviceId)
+	todoList.Unlock()
+	if _, err := RefreshTokens(refreshRequest{tokens.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh after the access token was revoked: got %v, want ErrInvalidRefreshToken", err)
+	}
+
+	_, _, expired := newTestLogin(t)
+	refreshTokensMutex.Lock()
+	refreshTokens[hashToken(expired.RefreshToken)].expiresAt = time.Now().Add(-time.Minute)
+	refreshTokensMutex.Unlock()
+	if _, err := RefreshTokens(refreshRequest{expired.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expired refresh token: got %v, want ErrInvalidRefreshToken", err)
+	}
+
+	if _, err := RefreshTokens(refreshRequest{"unknown"}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown refresh token: got %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+// the role of a refreshed token is never higher than the role of the login or the current role of the credential
+func TestRefreshKeepsLowerRole(t *testing.T) {
+	todoList, deviceId, _ := newTestLogin(t)
+
+	todoList.Lock()
+	viewer, _ := todoList.IssueTokens(fmt.Sprintf("%v:%v", CredentialAccessToken, deviceId), RoleViewer)
+	todoList.Unlock()
+
+	refreshed, err := RefreshTokens(refreshRequest{viewer.RefreshToken})
+	if err != nil || refreshed.Role != RoleViewer {
+		t.Errorf("got %+v (%v), want the viewer role", refreshed, err)
+	}
+}
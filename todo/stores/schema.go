@@ -0,0 +1,71 @@
+package stores
+
+import "reflect"
+
+/* returns the types of the json structures of the stores by their schema name
+ * the structures are not public, the backend uses the types to describe the api (OpenAPI)
+ */
+func SchemaTypes() map[string]reflect.Type {
+	return map[string]reflect.Type{
+		"Todo":            reflect.TypeOf(todo{}),
+		"TodoUpdate":      reflect.TypeOf(todoUpdate{}),
+		"TodoFilter":      reflect.TypeOf(todoFilter{}),
+		"SavedSearch":     reflect.TypeOf(savedSearch{}),
+		"ListStats":       reflect.TypeOf(listStats{}),
+		"CategoryStats":   reflect.TypeOf(categoryStats{}),
+		"WindowStats":     reflect.TypeOf(windowStats{}),
+		"PatchOperation":  reflect.TypeOf(patchOperation{}),
+		"BatchRequest":    reflect.TypeOf(batchRequest{}),
+		"BatchOperation":  reflect.TypeOf(batchOperation{}),
+		"BatchResult":     reflect.TypeOf(batchResult{}),
+		"FieldError":      reflect.TypeOf(FieldError{}),
+		"Change":          reflect.TypeOf(Change{}),
+		"SyncRequest":     reflect.TypeOf(syncRequest{}),
+		"SyncChange":      reflect.TypeOf(syncChange{}),
+		"SyncResponse":    reflect.TypeOf(syncResponse{}),
+		"SyncResult":      reflect.TypeOf(syncResult{}),
+		"FieldConflict":   reflect.TypeOf(fieldConflict{}),
+		"Webhook":         reflect.TypeOf(webhook{}),
+		"Delivery":        reflect.TypeOf(delivery{}),
+		"DeliveryAttempt": reflect.TypeOf(deliveryAttempt{}),
+		"WebhookPayload":  reflect.TypeOf(webhookPayload{}),
+		"ReplicaRequest":  reflect.TypeOf(replicaRequest{}),
+		"ReplicaState":    reflect.TypeOf(replicaState{}),
+		"ReplicaTodo":     reflect.TypeOf(replicaTodo{}),
+		"Stamp":           reflect.TypeOf(stamp{}),
+		"PositionDigit":   reflect.TypeOf(positionDigit{}),
+		"Register":        reflect.TypeOf(register{}),
+		"User":            reflect.TypeOf(User{}),
+		"UserProfile":     reflect.TypeOf(userProfile{}),
+		"Credentials":     reflect.TypeOf(credentials{}),
+		"Session":         reflect.TypeOf(session{}),
+		"List":            reflect.TypeOf(listSummary{}),
+		"ListMetadata":    reflect.TypeOf(listMetadata{}),
+		"ListOrder":       reflect.TypeOf(listOrder{}),
+		"Member":          reflect.TypeOf(member{}),
+		"MemberRequest":   reflect.TypeOf(memberRequest{}),
+		"SharedList":      reflect.TypeOf(sharedList{}),
+		"ShareLink":       reflect.TypeOf(shareLink{}),
+		"AccessToken":     reflect.TypeOf(accessToken{}),
+		"TokenResponse":   reflect.TypeOf(tokenResponse{}),
+		"RefreshRequest":  reflect.TypeOf(refreshRequest{}),
+	}
+}
+
+/* returns the json fields the decoders accept in the request structures by their schema name
+ * the other fields of the structures are set by the server, sending them is a violation
+ */
+func RequestFields() map[string][]string {
+	return map[string][]string{
+		"Todo":           todoCreateFields,
+		"TodoUpdate":     todoUpdateFields,
+		"SavedSearch":    searchFields,
+		"ListMetadata":   listFields,
+		"MemberRequest":  memberFields,
+		"Credentials":    credentialFields,
+		"ShareLink":      shareLinkFields,
+		"AccessToken":    accessTokenFields,
+		"RefreshRequest": refreshFields,
+		"Webhook":        webhookFields,
+	}
+}
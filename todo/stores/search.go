@@ -0,0 +1,221 @@
+package stores
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// current id of last saved search, guarded by the mutex, because searches of different lists are created at the same time
+var (
+	searchIndex      int = 0
+	searchIndexMutex sync.Mutex
+)
+
+// maximum number of saved searches in a single todo list
+const MaxSearchesPerList = 50
+
+// filter criteria for todos, empty fields match every todo
+type todoFilter struct {
+	Category []string `json:"category"`
+	Done     *bool    `json:"done"`
+	Query    string   `json:"query"`
+}
+
+// structure of a saved search (smart list)
+// not public, use constructor functions below
+type savedSearch struct {
+	Id     int        `json:"id"`
+	Name   string     `json:"name"`
+	Filter todoFilter `json:"filter"`
+}
+
+/* Create a new saved search
+ * r:		request with json body
+ * returns: pointer to the temporary saved search or error (ValidationError with every violation of the Rules)
+ */
+func NewSearchFromJson(r *http.Request) (*savedSearch, error) {
+
+	// create empty saved search and fill it with data from request body
+	newSearch, err := decodeSearch(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// insert id and update index
+	searchIndexMutex.Lock()
+	newSearch.Id = searchIndex
+	searchIndex++
+	searchIndexMutex.Unlock()
+
+	return newSearch, nil
+}
+
+/* Convert request body to a temporary saved search, that does not get inserted to db
+ * r:		request with json body
+ * returns: pointer to the temporary saved search or error (ValidationError with every violation of the Rules)
+ */
+func UpdateSearchFromJson(r *http.Request) (*savedSearch, error) {
+	return decodeSearch(r)
+}
+
+/* Decodes and validates the saved search in the request body
+ * r:		request with json body
+ * returns: pointer to the temporary saved search or error
+ */
+func decodeSearch(r *http.Request) (*savedSearch, error) {
+
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// create empty saved search and fill it with data from body
+	search := savedSearch{}
+	validationError := &ValidationError{}
+	if err := decodeFields(body, &search, "", searchFields, validationError); err != nil {
+		return nil, err
+	}
+
+	Rules.validateSearch(&search, validationError)
+	if err := validationError.OrNil(); err != nil {
+		return nil, err
+	}
+
+	return &search, nil
+}
+
+/* Create a filter that is not part of a saved search (e.g. arguments of a GraphQL query)
+ * empty criteria match every todo
+ */
+func NewFilter(category []string, done *bool, query string) todoFilter {
+	return todoFilter{Category: category, Done: done, Query: query}
+}
+
+/* checks if a todo matches all criteria of the filter
+ * categories:	todo needs to have every category of the filter
+ * done:		todo needs to have the same done state (if set)
+ * query:		name or text of the todo need to contain the query (case insensitive)
+ */
+func (filter *todoFilter) Matches(todo *todo) bool {
+
+	// check the done state
+	if filter.Done != nil && *filter.Done != todo.Done {
+		return false
+	}
+
+	// check that every category of the filter is present on the todo
+	for _, filterCategory := range filter.Category {
+		found := false
+		for _, todoCategory := range todo.Category {
+			if strings.EqualFold(filterCategory, todoCategory) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	// check the search query
+	if filter.Query != "" {
+		query := strings.ToLower(filter.Query)
+		inName := strings.Contains(strings.ToLower(todo.Name), query)
+		inText := strings.Contains(strings.ToLower(todo.Text), query)
+		if !inName && !inText {
+			return false
+		}
+	}
+
+	return true
+}
+
+// uses the todo list links to create a slice of all todos that match the filter
+func (todoList *TodoList) FilterTodos(filter todoFilter) []todo {
+
+	// create todo array that will be returned
+	var matchingTodos []todo
+
+	// iterate over the links and add every matching todo
+	currentTodo := todoList.Start
+	for currentTodo != nil {
+		if filter.Matches(currentTodo) {
+			matchingTodos = append(matchingTodos, *currentTodo)
+		}
+		currentTodo = currentTodo.Next
+	}
+	return matchingTodos
+}
+
+// returns all saved searches of the todo list
+func (todoList *TodoList) GetSearches() []savedSearch {
+	return todoList.Searches
+}
+
+/* searches the saved searches of the todo list for the given id
+ * if found -> returns a pointer to the saved search with given id
+ * if not found -> returns nil
+ */
+func (todoList *TodoList) GetSearchById(searchId int) *savedSearch {
+	for index, search := range todoList.Searches {
+		if search.Id == searchId {
+			return &todoList.Searches[index]
+		}
+	}
+	// saved search with given id was not found -> return nil
+	return nil
+}
+
+/* appends a saved search to a todo list
+ * newSearch:	data of saved search that will be added
+ * returns: copy of the saved search that was added or ErrQuota if the list has too many saved searches
+ */
+func (todoList *TodoList) AddSearch(newSearch savedSearch) (*savedSearch, error) {
+	if len(todoList.Searches) >= MaxSearchesPerList {
+		err := fmt.Errorf("%w: a list can hold at most %v saved searches", ErrQuota, MaxSearchesPerList)
+		return nil, err
+	}
+	todoList.Searches = append(todoList.Searches, newSearch)
+	// the next append can move the slice, so no pointer into it is returned
+	return &newSearch, nil
+}
+
+/* Updates a saved search in the todo list, replaces the old saved search
+ * updatedSearch:	the new saved search that should be stored
+ * if successfully updated -> returns update and nil-error
+ * if the updated failed -> returns nil and error
+ */
+func (todoList *TodoList) UpdateSearch(updatedSearch savedSearch) (*savedSearch, error) {
+
+	// try to find the old saved search
+	oldSearch := todoList.GetSearchById(updatedSearch.Id)
+
+	if oldSearch == nil {
+		err := fmt.Errorf("%w: saved search with id %v", ErrNotFound, updatedSearch.Id)
+		return nil, err
+	}
+
+	// update reference
+	*oldSearch = updatedSearch
+
+	return oldSearch, nil
+}
+
+/* find a saved search by id and remove it from the todo list
+ * searchId:	id of the saved search that will be deleted
+ * returns the deleted saved search
+ */
+func (todoList *TodoList) RemoveSearch(searchId int) (*savedSearch, error) {
+	for index, search := range todoList.Searches {
+		if search.Id == searchId {
+			// cut the saved search out of the slice
+			todoList.Searches = append(todoList.Searches[:index], todoList.Searches[index+1:]...)
+			return &search, nil
+		}
+	}
+	err := fmt.Errorf("%w: saved search with id %v", ErrNotFound, searchId)
+	return nil, err
+}
@@ -0,0 +1,114 @@
+package stores
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterMatches(t *testing.T) {
+	done, open := true, false
+	milk := &todo{Name: "Oat milk", Text: "2 liters, the cheap one", Done: true, Category: []string{"Shop", "food"}}
+
+	tests := []struct {
+		name   string
+		filter todoFilter
+		want   bool
+	}{
+		{"empty filter", todoFilter{}, true},
+		{"done", todoFilter{Done: &done}, true},
+		{"not done", todoFilter{Done: &open}, false},
+		{"category in another case", todoFilter{Category: []string{"shop"}}, true},
+		{"every category", todoFilter{Category: []string{"shop", "FOOD"}}, true},
+		{"one category missing", todoFilter{Category: []string{"shop", "work"}}, false},
+		{"query in the name", todoFilter{Query: "MILK"}, true},
+		{"query in the text", todoFilter{Query: "cheap"}, true},
+		{"query nowhere", todoFilter{Query: "eggs"}, false},
+		{"every criterion", todoFilter{Category: []string{"food"}, Done: &done, Query: "oat"}, true},
+		{"one criterion fails", todoFilter{Category: []string{"food"}, Done: &open, Query: "oat"}, false},
+	}
+
+	for _, test := range tests {
+		if got := test.filter.Matches(milk); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// the matching todos keep the order of the list
+func TestFilterTodos(t *testing.T) {
+	todoList := newTestList(t, "milk", "eggs", "oat milk", "bread")
+
+	matching := []string{}
+	for _, matchingTodo := range todoList.FilterTodos(NewFilter(nil, nil, "milk")) {
+		matching = append(matching, matchingTodo.Name)
+	}
+	if want := []string{"milk", "oat milk"}; !reflect.DeepEqual(matching, want) {
+		t.Errorf("got %v, want %v", matching, want)
+	}
+}
+
+// decodes the body of a new saved search
+func newTestSearch(t *testing.T, body string) *savedSearch {
+	t.Helper()
+	search, err := NewSearchFromJson(httptest.NewRequest("POST", "/search", strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return search
+}
+
+// saved searches are created, changed and removed by their id, other searches stay untouched
+func TestSavedSearches(t *testing.T) {
+	todoList := newTestList(t)
+
+	work := newTestSearch(t, `{"name":"work","filter":{"category":["work"],"done":false}}`)
+	shopping := newTestSearch(t, `{"name":"shopping","filter":{"query":"buy"}}`)
+	if work.Id == shopping.Id {
+		t.Fatalf("both searches have the id %v", work.Id)
+	}
+	todoList.AddSearch(*work)
+	todoList.AddSearch(*shopping)
+
+	updated, _ := UpdateSearchFromJson(httptest.NewRequest("PUT", "/search", strings.NewReader(`{"name":"work done","filter":{"done":true}}`)))
+	updated.Id = work.Id
+	if _, err := todoList.UpdateSearch(*updated); err != nil {
+		t.Fatal(err)
+	}
+	if search := todoList.GetSearchById(work.Id); search.Name != "work done" || *search.Filter.Done != true || len(search.Filter.Category) != 0 {
+		t.Errorf("got updated search %+v", search)
+	}
+	if search := todoList.GetSearchById(shopping.Id); search.Name != "shopping" {
+		t.Errorf("got other search %+v", search)
+	}
+
+	if removed, err := todoList.RemoveSearch(work.Id); err != nil || removed.Name != "work done" {
+		t.Errorf("remove: got %+v (%v)", removed, err)
+	}
+	if searches := todoList.GetSearches(); len(searches) != 1 || searches[0].Id != shopping.Id {
+		t.Errorf("got searches %+v after the remove", searches)
+	}
+
+	unknown := savedSearch{Id: work.Id, Name: "gone"}
+	if _, err := todoList.UpdateSearch(unknown); !errors.Is(err, ErrNotFound) {
+		t.Errorf("update of a removed search: got %v, want ErrNotFound", err)
+	}
+	if _, err := todoList.RemoveSearch(work.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("remove of a removed search: got %v, want ErrNotFound", err)
+	}
+}
+
+// a list holds at most MaxSearchesPerList saved searches
+func TestSavedSearchQuota(t *testing.T) {
+	todoList := newTestList(t)
+	for count := 0; count < MaxSearchesPerList; count++ {
+		if _, err := todoList.AddSearch(*newTestSearch(t, `{"name":"search"}`)); err != nil {
+			t.Fatalf("search %v: %v", count, err)
+		}
+	}
+	if _, err := todoList.AddSearch(*newTestSearch(t, `{"name":"one too many"}`)); !errors.Is(err, ErrQuota) {
+		t.Errorf("got %v, want ErrQuota", err)
+	}
+}
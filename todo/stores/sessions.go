@@ -0,0 +1,175 @@
+package stores
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// a session ends if it was not used for this duration
+	SessionIdleTimeout = 24 * time.Hour
+	// a session ends after this duration, even if it is used
+	SessionLifetime = 30 * 24 * time.Hour
+	// length of a session token in characters (list tokens have 32 characters)
+	SessionTokenLength = 64
+)
+
+// structure of a server side session of a logged in user
+type session struct {
+	// the token is only sent back when the session starts, the store only knows its hash
+	Token     string    `json:"token"`
+	UserId    string    `json:"userId"`
+	Created   time.Time `json:"created"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// sessions by the hash of their token (see hashToken), guarded by the mutex
+var (
+	sessionStore      = map[string]*session{}
+	sessionStoreMutex sync.Mutex
+)
+
+/* Starts a session of a user
+ * the token is a cryptographic random string of 32 bytes (64 chars)
+ * returns:	the session or error
+ */
+func NewSession(user *User) (*session, error) {
+
+	b := make([]byte, SessionTokenLength/2)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	newSession := &session{Token: hex.EncodeToString(b), UserId: user.Id, Created: now, ExpiresAt: now.Add(SessionIdleTimeout)}
+
+	sessionStoreMutex.Lock()
+	defer sessionStoreMutex.Unlock()
+
+	// remove the expired sessions while the store is locked anyway
+	for hash, existing := range sessionStore {
+		if now.After(existing.ExpiresAt) {
+			delete(sessionStore, hash)
+		}
+	}
+
+	sessionCopy := *newSession
+	newSession.Token = ""
+	sessionStore[hashToken(sessionCopy.Token)] = newSession
+	return &sessionCopy, nil
+}
+
+/* Returns the user of a session and extends the session (sliding expiration up to SessionLifetime)
+ * token:	token of the session
+ * returns:	the user or nil if the session is unknown or expired
+ */
+func GetUserOfSession(token string) *User {
+
+	hash := hashToken(token)
+	sessionStoreMutex.Lock()
+	existing := sessionStore[hash]
+	now := time.Now()
+	if existing == nil || now.After(existing.ExpiresAt) {
+		delete(sessionStore, hash)
+		sessionStoreMutex.Unlock()
+		return nil
+	}
+
+	existing.ExpiresAt = now.Add(SessionIdleTimeout)
+	if latest := existing.Created.Add(SessionLifetime); existing.ExpiresAt.After(latest) {
+		existing.ExpiresAt = latest
+	}
+	userId := existing.UserId
+	sessionStoreMutex.Unlock()
+
+	return GetUserById(userId)
+}
+
+/* Ends a session (logout)
+ * returns:	false if the session was not known
+ */
+func RemoveSession(token string) bool {
+	sessionStoreMutex.Lock()
+	defer sessionStoreMutex.Unlock()
+
+	hash := hashToken(token)
+	_, found := sessionStore[hash]
+	delete(sessionStore, hash)
+	return found
+}
+
+// delays of logins after failed logins of a username (guessing of passwords)
+const (
+	// failed logins of a username before its logins are delayed
+	LoginFreeAttempts = 5
+	// delay after the first failed login over the free attempts, doubled for every further failure
+	LoginBackoff = time.Second
+	// longest delay, failures older than this are forgotten
+	MaxLoginBackoff = 15 * time.Minute
+)
+
+// failed logins of a username
+type loginFailures struct {
+	count        int
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// failed logins by username, guarded by the mutex
+var (
+	loginFailureStore      = map[string]*loginFailures{}
+	loginFailureStoreMutex sync.Mutex
+)
+
+/* Returns how long the logins of a username are delayed
+ * username:	normalized username of the login (see CredentialsFromJson)
+ * returns:		the remaining delay, 0 if the username can log in
+ */
+func LoginDelay(username string) time.Duration {
+	loginFailureStoreMutex.Lock()
+	defer loginFailureStoreMutex.Unlock()
+
+	failures := loginFailureStore[username]
+	if failures == nil {
+		return 0
+	}
+	return max(time.Until(failures.blockedUntil), 0)
+}
+
+/* Records the result of a login, a successful login forgets the failures of the username
+ * after LoginFreeAttempts failures every failure delays the next login (exponential backoff up to MaxLoginBackoff)
+ */
+func RecordLogin(username string, succeeded bool) {
+	loginFailureStoreMutex.Lock()
+	defer loginFailureStoreMutex.Unlock()
+
+	if succeeded {
+		delete(loginFailureStore, username)
+		return
+	}
+
+	// forget old failures while the store is locked anyway, unknown usernames are recorded too
+	now := time.Now()
+	for name, failures := range loginFailureStore {
+		if now.Sub(failures.last) > MaxLoginBackoff && now.After(failures.blockedUntil) {
+			delete(loginFailureStore, name)
+		}
+	}
+
+	failures := loginFailureStore[username]
+	if failures == nil {
+		failures = &loginFailures{}
+		loginFailureStore[username] = failures
+	}
+	failures.count++
+	failures.last = now
+	if failures.count > LoginFreeAttempts {
+		delay := MaxLoginBackoff
+		if shift := failures.count - LoginFreeAttempts - 1; shift < 20 {
+			delay = min(LoginBackoff<<shift, MaxLoginBackoff)
+		}
+		failures.blockedUntil = now.Add(delay)
+	}
+}
@@ -0,0 +1,68 @@
+package stores
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// the store only knows the hashes of the tokens, the token itself is only sent back once
+func TestSessionsAreStoredByHash(t *testing.T) {
+	user := &User{Id: "session-test", Username: "session-test"}
+	userStoreMutex.Lock()
+	userStore[user.Id] = user
+	userStoreMutex.Unlock()
+
+	newSession, err := NewSession(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessionStoreMutex.Lock()
+	_, byToken := sessionStore[newSession.Token]
+	stored := sessionStore[hashToken(newSession.Token)]
+	sessionStoreMutex.Unlock()
+	if byToken || stored == nil || stored.Token != "" {
+		t.Errorf("session is stored by its token or with its token: %+v", stored)
+	}
+
+	if GetUserOfSession(newSession.Token) != user {
+		t.Errorf("the token does not open the session")
+	}
+	if GetUserOfSession(hashToken(newSession.Token)) != nil {
+		t.Errorf("the hash of the token opens the session")
+	}
+	if !RemoveSession(newSession.Token) || GetUserOfSession(newSession.Token) != nil {
+		t.Errorf("the session was not removed")
+	}
+}
+
+// every failed login over the free attempts doubles the delay of the username, a successful login forgets the failures
+func TestLoginBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{LoginFreeAttempts, 0},
+		{LoginFreeAttempts + 1, LoginBackoff},
+		{LoginFreeAttempts + 3, 4 * LoginBackoff},
+		{LoginFreeAttempts + 40, MaxLoginBackoff},
+	}
+
+	for _, test := range tests {
+		username := "backoff-" + strconv.Itoa(test.failures)
+		for failure := 0; failure < test.failures; failure++ {
+			RecordLogin(username, false)
+		}
+		if got := LoginDelay(username); got > test.want || got < test.want-time.Second {
+			t.Errorf("%v failures: got delay %v, want %v", test.failures, got, test.want)
+		}
+		if LoginDelay("other-"+username) != 0 {
+			t.Errorf("%v failures: other usernames are delayed", test.failures)
+		}
+		RecordLogin(username, true)
+		if got := LoginDelay(username); got != 0 {
+			t.Errorf("%v failures: got delay %v after a successful login", test.failures, got)
+		}
+	}
+}
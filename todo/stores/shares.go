@@ -0,0 +1,227 @@
+package stores
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// scopes of share links
+const (
+	// the todos of the list can be read
+	ShareScopeRead = "read"
+	// the todos can be read and marked as done or not done
+	ShareScopeComplete = "complete"
+)
+
+// role of the holder of a share link with the scope
+var shareScopeRoles = map[string]string{ShareScopeRead: RoleViewer, ShareScopeComplete: RoleCompleter}
+
+// share tokens have 48 chars, list ids 32, access tokens 40 and session tokens 64
+const ShareTokenLength = 48
+
+// maximum number of share links of a single list
+const MaxShareLinksPerList = 20
+
+// json fields of a share link sent by the owner
+var shareLinkFields = []string{"scope", "expiresAt", "maxUses"}
+
+// structure of a share link, a token that opens the list with a limited role
+// not public, use constructor functions below
+type shareLink struct {
+	Id    int    `json:"id"`
+	Scope string `json:"scope"`
+	// the token is only sent back when the link is created
+	Token string `json:"token,omitempty"`
+	// the link can not be used after this time, nil if it does not expire
+	ExpiresAt *time.Time `json:"expiresAt"`
+	// number of requests the link can be used for (not the number of clients), nil if it is not limited
+	MaxUses *int `json:"maxUses"`
+	// number of requests that were made with the token
+	Uses    int       `json:"uses"`
+	Created time.Time `json:"created"`
+	// only the hash of the token is stored (see tokens.go)
+	hash string
+}
+
+// lists of the hashes of the share tokens and the current id of the last share link, guarded by the mutex
+var (
+	shareTokens      = map[string]*TodoList{}
+	shareLinkIndex   = 0
+	shareTokensMutex sync.Mutex
+)
+
+/* Decodes a share link sent by the owner of a list
+ * r:		request with json body
+ * returns:	share link (without id and token) or error (ValidationError with every violation)
+ */
+func ShareLinkFromJson(r *http.Request) (*shareLink, error) {
+
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	newShareLink := shareLink{}
+	validationError := &ValidationError{}
+	if err := decodeFields(body, &newShareLink, "", shareLinkFields, validationError); err != nil {
+		return nil, err
+	}
+
+	if newShareLink.Scope == "" {
+		validationError.Add("scope", "required", "must not be empty")
+	} else if shareScopeRoles[newShareLink.Scope] == "" {
+		validationError.Add("scope", "invalid_value", "has to be read or complete")
+	}
+	if newShareLink.ExpiresAt != nil && !newShareLink.ExpiresAt.After(time.Now()) {
+		validationError.Add("expiresAt", "invalid_value", "has to be in the future")
+	}
+	if newShareLink.MaxUses != nil && *newShareLink.MaxUses < 1 {
+		validationError.Add("maxUses", "invalid_value", "has to be at least 1")
+	}
+
+	if err := validationError.OrNil(); err != nil {
+		return nil, err
+	}
+	return &newShareLink, nil
+}
+
+// checks if the share link expired or was used as often as allowed
+func (link *shareLink) usable() bool {
+	if link.ExpiresAt != nil && !time.Now().Before(*link.ExpiresAt) {
+		return false
+	}
+	return link.MaxUses == nil || link.Uses < *link.MaxUses
+}
+
+/* Adds a share link to the list and mints its token
+ * the mutex of the list has to be held
+ * returns:	the share link with its token (the only time the token is sent) or ErrQuota
+ */
+func (todoList *TodoList) AddShareLink(newShareLink shareLink) (*shareLink, error) {
+
+	if len(todoList.shareLinks) >= MaxShareLinksPerList {
+		err := fmt.Errorf("%w: a list can have at most %v share links", ErrQuota, MaxShareLinksPerList)
+		return nil, err
+	}
+
+	token, err := newToken(ShareTokenLength)
+	if err != nil {
+		return nil, err
+	}
+	newShareLink.hash = hashToken(token)
+	newShareLink.Created = time.Now()
+	newShareLink.Uses = 0
+
+	shareTokensMutex.Lock()
+	newShareLink.Id = shareLinkIndex
+	shareLinkIndex++
+	shareTokens[newShareLink.hash] = todoList
+	shareTokensMutex.Unlock()
+
+	todoList.shareLinks = append(todoList.shareLinks, &newShareLink)
+	created := newShareLink
+	created.Token = token
+	return &created, nil
+}
+
+// returns all share links of the list (without their tokens)
+func (todoList *TodoList) GetShareLinks() []shareLink {
+	links := []shareLink{}
+	for _, link := range todoList.shareLinks {
+		links = append(links, *link)
+	}
+	return links
+}
+
+/* Revokes a share link, its token can not be used anymore
+ * returns:	the revoked share link (without token) or ErrNotFound
+ */
+func (todoList *TodoList) RemoveShareLink(shareLinkId int) (*shareLink, error) {
+	for index, link := range todoList.shareLinks {
+		if link.Id == shareLinkId {
+			todoList.shareLinks = append(todoList.shareLinks[:index], todoList.shareLinks[index+1:]...)
+
+			shareTokensMutex.Lock()
+			delete(shareTokens, link.hash)
+			shareTokensMutex.Unlock()
+
+			revoked := *link
+			return &revoked, nil
+		}
+	}
+	err := fmt.Errorf("%w: share link with id %v", ErrNotFound, shareLinkId)
+	return nil, err
+}
+
+/* Checks that a share token still opens its list, without counting a use
+ * open event streams check their link with every change, the use was counted when the stream was opened
+ * the mutex of the list must not be held
+ * returns:	the list and the role of the link, or nil if the link was revoked or expired
+ */
+func ActiveShareLink(token string) (*TodoList, string) {
+
+	hash := hashToken(token)
+
+	shareTokensMutex.Lock()
+	todoList := shareTokens[hash]
+	shareTokensMutex.Unlock()
+
+	if todoList == nil {
+		return nil, ""
+	}
+
+	todoList.Lock()
+	defer todoList.Unlock()
+
+	for _, link := range todoList.shareLinks {
+		if link.hash == hash {
+			if link.ExpiresAt != nil && !time.Now().Before(*link.ExpiresAt) {
+				return nil, ""
+			}
+			return todoList, shareScopeRoles[link.Scope]
+		}
+	}
+	return nil, ""
+}
+
+// removes the tokens of all share links of the list, is called when the list is deleted
+func (todoList *TodoList) removeShareTokens() {
+	shareTokensMutex.Lock()
+	defer shareTokensMutex.Unlock()
+	for _, link := range todoList.shareLinks {
+		delete(shareTokens, link.hash)
+	}
+}
+
+/* Opens a list with a share token, every request counts as one use of the link
+ * token:	the share token of the request
+ * returns:	the list and the role of the link, or nil if the token is unknown, expired or used up
+ */
+func UseShareLink(token string) (*TodoList, string) {
+
+	hash := hashToken(token)
+
+	shareTokensMutex.Lock()
+	todoList := shareTokens[hash]
+	shareTokensMutex.Unlock()
+
+	if todoList == nil {
+		return nil, ""
+	}
+
+	todoList.Lock()
+	defer todoList.Unlock()
+
+	for _, link := range todoList.shareLinks {
+		if link.hash == hash {
+			if !link.usable() {
+				return nil, ""
+			}
+			link.Uses++
+			return todoList, shareScopeRoles[link.Scope]
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,141 @@
+package stores
+
+import "time"
+
+// number of open todos that are reported as the oldest open todos
+const oldestOpenLimit = 5
+
+// time windows the completion rate is calculated for
+var statsWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+// open and done counts of a single category
+type categoryStats struct {
+	Total int `json:"total"`
+	Open  int `json:"open"`
+	Done  int `json:"done"`
+}
+
+// todos created and todos completed inside a time window
+// the rate is completed per created, above 1 more todos were finished than added
+type windowStats struct {
+	Created   int     `json:"created"`
+	Completed int     `json:"completed"`
+	Rate      float64 `json:"rate"`
+}
+
+// structure of the statistics of a todo list
+type listStats struct {
+	Total          int                      `json:"total"`
+	Open           int                      `json:"open"`
+	Done           int                      `json:"done"`
+	Categories     map[string]categoryStats `json:"categories"`
+	CompletionRate map[string]windowStats   `json:"completionRate"`
+	OldestOpen     []todo                   `json:"oldestOpen"`
+}
+
+/* calculates the statistics of the todo list
+ * walks the todo list links once and only keeps pointers to the oldest open todos,
+ * so the todos are not copied like in GetTodos
+ * returns the statistics of the todo list
+ */
+func (todoList *TodoList) GetStats() listStats {
+
+	now := time.Now()
+
+	stats := listStats{
+		Categories:     map[string]categoryStats{},
+		CompletionRate: map[string]windowStats{},
+		OldestOpen:     []todo{},
+	}
+
+	// oldest open todos, sorted from oldest to newest
+	var oldestOpen []*todo
+
+	// iterate over the links and count every todo
+	currentTodo := todoList.Start
+	for currentTodo != nil {
+
+		// total and open / done counts
+		stats.Total++
+		if currentTodo.Done {
+			stats.Done++
+		} else {
+			stats.Open++
+			oldestOpen = insertOldest(oldestOpen, currentTodo)
+		}
+
+		// per category counts
+		for _, category := range currentTodo.Category {
+			categoryStats := stats.Categories[category]
+			categoryStats.Total++
+			if currentTodo.Done {
+				categoryStats.Done++
+			} else {
+				categoryStats.Open++
+			}
+			stats.Categories[category] = categoryStats
+		}
+
+		// completion per time window, counts todos created and todos completed inside the window
+		for name, window := range statsWindows {
+			windowStats := stats.CompletionRate[name]
+			if now.Sub(currentTodo.Created) <= window {
+				windowStats.Created++
+			}
+			if currentTodo.Done && currentTodo.Completed != nil && now.Sub(*currentTodo.Completed) <= window {
+				windowStats.Completed++
+			}
+			stats.CompletionRate[name] = windowStats
+		}
+
+		// go to the next link
+		currentTodo = currentTodo.Next
+	}
+
+	// calculate the rates of the time windows
+	for name := range statsWindows {
+		windowStats := stats.CompletionRate[name]
+		if windowStats.Created > 0 {
+			windowStats.Rate = float64(windowStats.Completed) / float64(windowStats.Created)
+		}
+		stats.CompletionRate[name] = windowStats
+	}
+
+	// only the few oldest open todos are copied into the response
+	for _, openTodo := range oldestOpen {
+		stats.OldestOpen = append(stats.OldestOpen, *openTodo)
+	}
+
+	return stats
+}
+
+/* inserts a todo into the sorted slice of oldest open todos
+ * the slice never grows larger than oldestOpenLimit
+ */
+func insertOldest(oldestOpen []*todo, openTodo *todo) []*todo {
+
+	// find the position of the todo in the slice (sorted by creation time)
+	position := len(oldestOpen)
+	for index, otherTodo := range oldestOpen {
+		if openTodo.Created.Before(otherTodo.Created) {
+			position = index
+			break
+		}
+	}
+
+	// todo is newer than every todo in a full slice -> nothing to do
+	if position >= oldestOpenLimit {
+		return oldestOpen
+	}
+
+	// insert the todo and cut the slice to the limit
+	oldestOpen = append(oldestOpen[:position], append([]*todo{openTodo}, oldestOpen[position:]...)...)
+	if len(oldestOpen) > oldestOpenLimit {
+		oldestOpen = oldestOpen[:oldestOpenLimit]
+	}
+	return oldestOpen
+}
@@ -0,0 +1,92 @@
+package stores
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// times of a todo of the stats test, completed is zero for open todos
+type testTimes struct {
+	created   time.Duration
+	completed time.Duration
+}
+
+// the windows count the todos created and the todos completed inside them, at their own times
+func TestGetStats(t *testing.T) {
+	day := 24 * time.Hour
+	times := map[string]testTimes{
+		"today":          {2 * time.Hour, time.Hour},
+		"this week":      {3 * day, 2 * day},
+		"finished today": {40 * day, time.Hour},
+		"open 5":         {5 * day, 0},
+		"open 10":        {10 * day, 0},
+		"open 15":        {15 * day, 0},
+		"open 20":        {20 * day, 0},
+		"open 25":        {25 * day, 0},
+		"open 35":        {35 * day, 0},
+		"open 45":        {45 * day, 0},
+	}
+	categories := map[string][]string{
+		"today":     {"shop"},
+		"this week": {"shop", "food"},
+		"open 5":    {"food"},
+	}
+
+	todoList := newTestList(t, "today", "this week", "finished today", "open 5", "open 10", "open 15", "open 20", "open 25", "open 35", "open 45")
+	now := time.Now()
+	for current := todoList.Start; current != nil; current = current.Next {
+		current.Created = now.Add(-times[current.Name].created)
+		current.Category = categories[current.Name]
+		if times[current.Name].completed != 0 {
+			completed := now.Add(-times[current.Name].completed)
+			current.Done = true
+			current.Completed = &completed
+		}
+	}
+
+	stats := todoList.GetStats()
+
+	if stats.Total != 10 || stats.Open != 7 || stats.Done != 3 {
+		t.Errorf("got %v todos, %v open and %v done", stats.Total, stats.Open, stats.Done)
+	}
+
+	wantCategories := map[string]categoryStats{
+		"shop": {Total: 2, Open: 0, Done: 2},
+		"food": {Total: 2, Open: 1, Done: 1},
+	}
+	if !reflect.DeepEqual(stats.Categories, wantCategories) {
+		t.Errorf("got categories %+v, want %+v", stats.Categories, wantCategories)
+	}
+
+	// todos that were created before a window and completed inside it raise its rate above 1
+	wantWindows := map[string]windowStats{
+		"day":   {Created: 1, Completed: 2, Rate: 2},
+		"week":  {Created: 3, Completed: 3, Rate: 1},
+		"month": {Created: 7, Completed: 3, Rate: 3.0 / 7.0},
+	}
+	if !reflect.DeepEqual(stats.CompletionRate, wantWindows) {
+		t.Errorf("got windows %+v, want %+v", stats.CompletionRate, wantWindows)
+	}
+
+	oldest := []string{}
+	for _, openTodo := range stats.OldestOpen {
+		oldest = append(oldest, openTodo.Name)
+	}
+	if want := []string{"open 45", "open 35", "open 25", "open 20", "open 15"}; !reflect.DeepEqual(oldest, want) {
+		t.Errorf("got oldest open todos %v, want %v", oldest, want)
+	}
+}
+
+// a list without todos has no rates and no oldest todos
+func TestGetStatsOfEmptyList(t *testing.T) {
+	stats := newTestList(t).GetStats()
+	if stats.Total != 0 || len(stats.OldestOpen) != 0 || stats.OldestOpen == nil {
+		t.Errorf("got %+v", stats)
+	}
+	for name, window := range stats.CompletionRate {
+		if window != (windowStats{}) {
+			t.Errorf("window %v: got %+v", name, window)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package stores
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+/*
+ * Delta sync of offline clients
+ * the client sends the sync token of its last sync and the changes it made offline,
+ * the server applies the changes one by one and returns every change of the list since the sync token
+ * (from the change log, see events.go) together with a result for every change of the client
+ *
+ * conflict rules for changes of a todo that was changed on the server since the base version of the client:
+ * - update:	the fields are merged with the version the client based its change on (from the change log),
+ *				fields that only the client changed are applied, fields that both changed keep the server value
+ *				if the base version is not in the change log anymore, every differing field keeps the server value
+ * - delete:	a todo that was changed on the server is not deleted (changes win over deletes)
+ * - update or move of a deleted todo:	the todo stays deleted (deletes win over older changes)
+ * - delete of a deleted todo:			applied, the todo is gone either way
+ * - create:	always applied, the clientId of the todo is returned with its server id
+ */
+
+// fields of a todo a client can change with a sync
+var todoSyncFields = []string{"name", "text", "done", "category"}
+
+// a change a client made offline
+type syncChange struct {
+	// create, update, delete or move
+	Op string `json:"op"`
+	// id of a created todo on the client, returned with the server id
+	ClientId string `json:"clientId"`
+	// id of the changed todo (update, delete, move)
+	Id *int `json:"id"`
+	// version of the todo the client changed (update, delete)
+	BaseVersion *int `json:"baseVersion"`
+	// create: the new todo, update: only the changed fields
+	Todo     json.RawMessage `json:"todo"`
+	UpOrDown int             `json:"upOrDown"`
+}
+
+// structure of a sync request body
+type syncRequest struct {
+	SyncToken string       `json:"syncToken"`
+	Changes   []syncChange `json:"changes"`
+}
+
+// field that was changed on the client and on the server
+type fieldConflict struct {
+	Field       string      `json:"field"`
+	ClientValue interface{} `json:"clientValue"`
+	ServerValue interface{} `json:"serverValue"`
+}
+
+// result of a single change of the client
+type syncResult struct {
+	Op       string `json:"op"`
+	ClientId string `json:"clientId,omitempty"`
+	// applied, conflict or rejected
+	Status string `json:"status"`
+	// reason of a conflict: changed (the todo was changed on the server) or deleted
+	Reason    string          `json:"reason,omitempty"`
+	Todo      *todo           `json:"todo,omitempty"`
+	Conflicts []fieldConflict `json:"conflicts,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Errors    []FieldError    `json:"errors,omitempty"`
+}
+
+// structure of a sync response
+type syncResponse struct {
+	// token of this sync, sent with the next sync
+	SyncToken string `json:"syncToken"`
+	// true if the changes since the sync token are not known anymore, todos contains the whole list
+	Reset   bool         `json:"reset"`
+	Todos   []todo       `json:"todos,omitempty"`
+	Changes []Change     `json:"changes"`
+	Results []syncResult `json:"results"`
+}
+
+/* Decodes a sync request
+ * the structure of every change is validated, the todos are validated when they are applied
+ * r:		request with json body
+ * returns: sync request or error (ValidationError with every violation of every change)
+ */
+func SyncFromJson(r *http.Request) (syncRequest, error) {
+
+	request := syncRequest{}
+
+	body, err := readBody(r)
+	if err != nil {
+		return request, err
+	}
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return request, err
+	}
+
+	validationError := &ValidationError{}
+	for index, change := range request.Changes {
+		prefix := fmt.Sprintf("changes[%v].", index)
+
+		switch change.Op {
+		case "create", "update":
+			if len(change.Todo) == 0 {
+				validationError.Add(prefix+"todo", "required", "must not be empty")
+				break
+			}
+			// created todos are complete, updates contain only the changed fields
+			var err error
+			if change.Op == "create" {
+				_, err = decodeTodo(change.Todo, prefix+"todo.", true, validationError)
+			} else {
+				err = decodeFields(change.Todo, &todo{}, prefix+"todo.", todoSyncFields, validationError)
+			}
+			if err != nil {
+				validationError.Add(prefix+"todo", "invalid_type", "has to be an object")
+			}
+		case "delete", "move":
+		default:
+			validationError.Add(prefix+"op", "invalid_value", "must be create, update, delete or move")
+		}
+
+		if change.Op != "create" && change.Id == nil {
+			validationError.Add(prefix+"id", "required", "must not be empty")
+		}
+		if change.Op == "move" && change.UpOrDown != 1 && change.UpOrDown != -1 {
+			validationError.Add(prefix+"upOrDown", "invalid_value", "must be 1 or -1")
+		}
+	}
+	if err := validationError.OrNil(); err != nil {
+		return request, err
+	}
+
+	return request, nil
+}
+
+/* Syncs the list with the changes of a client
+ * the mutex of the list has to be held
+ * request:	sync token and changes of the client
+ * returns:	changes of the list since the sync token, results of the changes of the client and the new sync token
+ */
+func (todoList *TodoList) Sync(request syncRequest) syncResponse {
+
+	response := syncResponse{Changes: []Change{}, Results: []syncResult{}}
+
+	// the changes since the last sync, before the changes of the client are applied
+	// (the client gets the state of its own changes in the results)
+	sequence, err := strconv.Atoi(request.SyncToken)
+	missed, ok := todoList.ChangesSince(sequence)
+	if request.SyncToken == "" || err != nil || !ok {
+		response.Reset = true
+	} else {
+		response.Changes = missed
+	}
+
+	for _, change := range request.Changes {
+		response.Results = append(response.Results, todoList.applySyncChange(change))
+	}
+
+	// a client without known changes gets the whole list, after its changes were applied
+	if response.Reset {
+		response.Todos = todoList.GetTodos()
+		if response.Todos == nil {
+			response.Todos = []todo{}
+		}
+	}
+
+	response.SyncToken = strconv.Itoa(todoList.LastChange())
+	return response
+}
+
+// applies a single change of a client with the conflict rules of the sync
+func (todoList *TodoList) applySyncChange(change syncChange) syncResult {
+
+	result := syncResult{Op: change.Op, ClientId: change.ClientId, Status: "applied"}
+
+	if change.Op == "create" {
+		newTodo, err := NewTodoFromBytes(change.Todo)
+		if err == nil {
+			newTodo, err = todoList.AddTodo(*newTodo)
+		}
+		return result.withTodo(newTodo, err)
+	}
+
+	existingTodo := todoList.GetTodoById(*change.Id)
+
+	// deleted todos stay deleted, deleting them again changes nothing
+	if existingTodo == nil {
+		if change.Op != "delete" {
+			result.Status, result.Reason = "conflict", "deleted"
+		}
+		return result
+	}
+
+	changedOnServer := change.BaseVersion != nil && *change.BaseVersion != existingTodo.Version
+
+	switch change.Op {
+	case "update":
+		patch, conflicts := todoList.mergeSyncUpdate(existingTodo, change)
+		updatedTodo, _, err := PatchTodoFromBytes(patch, MergePatchContentType, existingTodo)
+		// the todo only changes if at least one field of the client is applied
+		if err == nil && string(patch) != "{}" {
+			updatedTodo, err = todoList.UpdateTodo(*updatedTodo)
+		} else if err == nil {
+			updatedTodo = existingTodo
+		}
+		result = result.withTodo(updatedTodo, err)
+		if err == nil && len(conflicts) > 0 {
+			result.Status, result.Reason, result.Conflicts = "conflict", "changed", conflicts
+		}
+		return result
+	case "delete":
+		if changedOnServer {
+			result.Status, result.Reason = "conflict", "changed"
+			return result.withTodo(existingTodo, nil)
+		}
+		removedTodo, err := todoList.RemoveTodo(*change.Id)
+		return result.withTodo(removedTodo, err)
+	default:
+		movedTodo, err := todoList.MoveTodo(*change.Id, change.UpOrDown == 1)
+		return result.withTodo(movedTodo, err)
+	}
+}
+
+/* Merges the fields of an update of a client with the changes on the server
+ * existingTodo:	current todo on the server
+ * change:			update with the changed fields and the base version of the client
+ * returns:			merge patch with the fields that are applied and the fields that keep the server value
+ */
+func (todoList *TodoList) mergeSyncUpdate(existingTodo *todo, change syncChange) ([]byte, []fieldConflict) {
+
+	clientFields := map[string]interface{}{}
+	json.Unmarshal(change.Todo, &clientFields)
+	serverFields := jsonFields(existingTodo)
+
+	// without base version the client claims to know the current todo
+	var baseFields map[string]interface{}
+	if change.BaseVersion == nil || *change.BaseVersion == existingTodo.Version {
+		baseFields = serverFields
+	} else if baseTodo := todoList.todoAtVersion(existingTodo.Id, *change.BaseVersion); baseTodo != nil {
+		baseFields = jsonFields(baseTodo)
+	}
+
+	patch := map[string]interface{}{}
+	var conflicts []fieldConflict
+	for _, field := range todoSyncFields {
+		clientValue, sent := clientFields[field]
+		if !sent {
+			continue
+		}
+		serverValue := serverFields[field]
+
+		// the field was not changed on the server since the base version -> the client wins
+		// (without base version in the log, only fields with the same value are known to be unchanged)
+		if baseFields != nil && sameValue(baseFields[field], serverValue) || sameValue(clientValue, serverValue) {
+			patch[field] = clientValue
+			continue
+		}
+
+		// both changed the field -> the server wins
+		conflicts = append(conflicts, fieldConflict{field, clientValue, serverValue})
+	}
+
+	encodedPatch, _ := json.Marshal(patch)
+	return encodedPatch, conflicts
+}
+
+/* Searches the change log for a version of a todo
+ * returns:	copy of the todo in this version or nil if the version is not in the log anymore
+ */
+func (todoList *TodoList) todoAtVersion(todoId int, version int) *todo {
+	for index := len(todoList.changeLog) - 1; index >= 0; index-- {
+		loggedTodo := todoList.changeLog[index].Todo
+		if loggedTodo.Id == todoId && loggedTodo.Version == version {
+			return &loggedTodo
+		}
+	}
+	return nil
+}
+
+// returns the fields of a todo as generic json values
+func jsonFields(fieldsOf *todo) map[string]interface{} {
+	encoded, _ := json.Marshal(fieldsOf)
+	fields := map[string]interface{}{}
+	json.Unmarshal(encoded, &fields)
+	return fields
+}
+
+// compares two json values, a missing list of categories is the same as an empty list
+func sameValue(first interface{}, second interface{}) bool {
+	if first == nil {
+		first = []interface{}{}
+	}
+	if second == nil {
+		second = []interface{}{}
+	}
+	return reflect.DeepEqual(first, second)
+}
+
+// sets the todo of a result or marks the result as rejected
+func (result syncResult) withTodo(changedTodo *todo, err error) syncResult {
+
+	if err != nil {
+		result.Status = "rejected"
+		result.Error = err.Error()
+		var validationError *ValidationError
+		if errors.As(err, &validationError) {
+			result.Errors = validationError.Fields
+		}
+		return result
+	}
+
+	// the result gets a copy, later changes of the sync may change the todo again
+	todoCopy := *changedTodo
+	todoCopy.List, todoCopy.Prev, todoCopy.Next = nil, nil, nil
+	result.Todo = &todoCopy
+	return result
+}
@@ -0,0 +1,137 @@
+package stores
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// decodes a sync request body, ID is replaced with the id of the todo
+func decodeSync(t *testing.T, body string, todoId int) syncRequest {
+	t.Helper()
+	body = strings.ReplaceAll(body, "ID", strconv.Itoa(todoId))
+	request, err := SyncFromJson(httptest.NewRequest("POST", "/sync", strings.NewReader(body)))
+	if err != nil {
+		t.Fatalf("invalid sync request %v: %v", body, err)
+	}
+	return request
+}
+
+/* every case starts with the todo "milk" (version 1) that was renamed to "oat milk" on the server (version 2),
+ * the client based its changes on version 1 unless the case says otherwise
+ */
+func TestSyncConflictRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes string
+		// the todo is deleted on the server before the sync
+		deletedOnServer bool
+		status          string
+		reason          string
+		conflicts       []string
+		// name and text of the todo after the sync, "" if it does not exist anymore
+		wantName string
+		wantText string
+	}{
+		{"field only the client changed", `[{"op":"update","id":ID,"baseVersion":1,"todo":{"text":"2 liters"}}]`, false, "applied", "", nil, "oat milk", "2 liters"},
+		{"field both changed keeps the server value", `[{"op":"update","id":ID,"baseVersion":1,"todo":{"name":"soy milk","text":"2 liters"}}]`, false, "conflict", "changed", []string{"name"}, "oat milk", "2 liters"},
+		{"same value on both sides", `[{"op":"update","id":ID,"baseVersion":1,"todo":{"name":"oat milk"}}]`, false, "applied", "", nil, "oat milk", ""},
+		{"current base version", `[{"op":"update","id":ID,"baseVersion":2,"todo":{"name":"soy milk"}}]`, false, "applied", "", nil, "soy milk", ""},
+		{"no base version", `[{"op":"update","id":ID,"todo":{"name":"soy milk"}}]`, false, "applied", "", nil, "soy milk", ""},
+		{"base version not in the log", `[{"op":"update","id":ID,"baseVersion":99,"todo":{"name":"soy milk","text":""}}]`, false, "conflict", "changed", []string{"name"}, "oat milk", ""},
+		{"changes win over deletes", `[{"op":"delete","id":ID,"baseVersion":1}]`, false, "conflict", "changed", nil, "oat milk", ""},
+		{"delete of the current version", `[{"op":"delete","id":ID,"baseVersion":2}]`, false, "applied", "", nil, "", ""},
+		{"deletes win over older updates", `[{"op":"update","id":ID,"baseVersion":1,"todo":{"text":"2 liters"}}]`, true, "conflict", "deleted", nil, "", ""},
+		{"deletes win over moves", `[{"op":"move","id":ID,"upOrDown":1}]`, true, "conflict", "deleted", nil, "", ""},
+		{"delete of a deleted todo", `[{"op":"delete","id":ID,"baseVersion":1}]`, true, "applied", "", nil, "", ""},
+		{"invalid update is rejected", `[{"op":"update","id":ID,"baseVersion":2,"todo":{"name":""}}]`, false, "rejected", "", nil, "oat milk", ""},
+	}
+
+	for _, test := range tests {
+		todoList := newTestList(t, "milk")
+		todoId := todoList.Start.Id
+		if _, err := todoList.UpdateTodo(todo{Id: todoId, Name: "oat milk"}); err != nil {
+			t.Fatalf("%v: server update failed: %v", test.name, err)
+		}
+		if test.deletedOnServer {
+			todoList.RemoveTodo(todoId)
+		}
+
+		response := todoList.Sync(decodeSync(t, `{"changes":`+test.changes+`}`, todoId))
+		result := response.Results[0]
+
+		if result.Status != test.status || result.Reason != test.reason {
+			t.Errorf("%v: got %v (%v), want %v (%v): %v", test.name, result.Status, result.Reason, test.status, test.reason, result.Error)
+		}
+		conflicts := []string{}
+		for _, conflict := range result.Conflicts {
+			conflicts = append(conflicts, conflict.Field)
+		}
+		if strings.Join(conflicts, ",") != strings.Join(test.conflicts, ",") {
+			t.Errorf("%v: got conflicts %v, want %v", test.name, conflicts, test.conflicts)
+		}
+
+		existingTodo := todoList.GetTodoById(todoId)
+		switch {
+		case test.wantName == "" && existingTodo != nil:
+			t.Errorf("%v: todo still exists: %+v", test.name, *existingTodo)
+		case test.wantName != "" && existingTodo == nil:
+			t.Errorf("%v: todo was deleted", test.name)
+		case existingTodo != nil && (existingTodo.Name != test.wantName || existingTodo.Text != test.wantText):
+			t.Errorf("%v: got %q / %q, want %q / %q", test.name, existingTodo.Name, existingTodo.Text, test.wantName, test.wantText)
+		}
+	}
+}
+
+// created todos get a server id, the client finds them by its clientId
+func TestSyncCreate(t *testing.T) {
+	todoList := newTestList(t)
+	response := todoList.Sync(decodeSync(t, `{"changes":[{"op":"create","clientId":"c1","todo":{"name":"eggs"}}]}`, 0))
+
+	created := response.Results[0]
+	if created.Status != "applied" || created.ClientId != "c1" || created.Todo == nil || todoList.GetTodoById(created.Todo.Id) == nil {
+		t.Errorf("create: got %+v", created)
+	}
+}
+
+// the sync token names the last change the client knows, unknown tokens get the whole list
+func TestSyncToken(t *testing.T) {
+	todoList := newTestList(t, "milk", "bread")
+
+	first := todoList.Sync(syncRequest{})
+	if !first.Reset || len(first.Todos) != 2 {
+		t.Fatalf("first sync: got reset %v with %v todos, want the whole list", first.Reset, len(first.Todos))
+	}
+
+	todoList.UpdateTodo(todo{Id: todoList.Start.Id, Name: "oat milk"})
+	second := todoList.Sync(syncRequest{SyncToken: first.SyncToken})
+	if second.Reset || len(second.Changes) != 1 || second.Changes[0].Type != ChangeUpdated {
+		t.Errorf("second sync: got reset %v with changes %+v, want the update", second.Reset, second.Changes)
+	}
+
+	third := todoList.Sync(syncRequest{SyncToken: second.SyncToken})
+	if third.Reset || len(third.Changes) != 0 {
+		t.Errorf("third sync: got reset %v with changes %+v, want no changes", third.Reset, third.Changes)
+	}
+
+	if unknown := todoList.Sync(syncRequest{SyncToken: "next"}); !unknown.Reset {
+		t.Errorf("unknown sync token: got no reset")
+	}
+}
+
+func TestSyncFromJsonValidation(t *testing.T) {
+	body := `{"changes":[
+		{"op":"rename","id":1},
+		{"op":"update","todo":{"color":"red"}},
+		{"op":"move","id":1,"upOrDown":2},
+		{"op":"create"},
+		{"op":"create","todo":{"name":" "}}]}`
+	_, err := SyncFromJson(httptest.NewRequest("POST", "/sync", strings.NewReader(body)))
+
+	want := []string{"changes[0].op:invalid_value", "changes[1].todo.color:unknown_field", "changes[1].id:required", "changes[2].upOrDown:invalid_value", "changes[3].todo:required", "changes[4].todo.name:required"}
+	if !errors.Is(err, ErrValidation) || strings.Join(violations(err), ",") != strings.Join(want, ",") {
+		t.Errorf("got violations %v (%v), want %v", violations(err), err, want)
+	}
+}
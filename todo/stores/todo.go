@@ -1,24 +1,40 @@
 package stores
 
 import (
-	"encoding/json"
 	"net/http"
+	"sync"
+	"time"
 )
 
-// current id of last todo
-var index int = 0
+// current id of last todo, guarded by the mutex, because todos of different lists are created at the same time
+var (
+	index      int = 0
+	indexMutex sync.Mutex
+)
+
+// returns the next unused todo id, every api that creates todos gets its ids here
+func nextTodoId() int {
+	indexMutex.Lock()
+	defer indexMutex.Unlock()
+	id := index
+	index++
+	return id
+}
 
 // structure of a todo
 // not public, use constructor functions below
 type todo struct {
-	Id       int       `json:"id"`
-	Name     string    `json:"name"`
-	Text     string    `json:"text"`
-	Done     bool      `json:"done"`
-	Category []string  `json:"category"`
-	List     *TodoList `json:"-"`
-	Prev     *todo     `json:"-"`
-	Next     *todo     `json:"-"`
+	Id        int        `json:"id"`
+	Name      string     `json:"name"`
+	Text      string     `json:"text"`
+	Done      bool       `json:"done"`
+	Category  []string   `json:"category"`
+	Created   time.Time  `json:"created"`
+	Completed *time.Time `json:"completed"`
+	Version   int        `json:"version"`
+	List      *TodoList  `json:"-"`
+	Prev      *todo      `json:"-"`
+	Next      *todo      `json:"-"`
 }
 
 type todoUpdate struct {
@@ -33,34 +49,86 @@ type changeOrder struct {
 
 /* Create a new Todo
  * r:		request with json body
- * returns: pointer to the temporary todo or error
+ * returns: pointer to the temporary todo or error (ValidationError with every violation of the Rules)
  */
 func NewTodoFromJson(r *http.Request) (*todo, error) {
 
-	// create empty todo and fill it with data from request body
-	newTodo := todo{}
-	err := json.NewDecoder(r.Body).Decode(&newTodo)
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTodoFromBytes(body)
+}
+
+/* Create a new Todo from a json object (used by apis that do not send the todo as request body)
+ * body:	json object of the todo
+ * returns: pointer to the temporary todo or error (ValidationError with every violation of the Rules)
+ */
+func NewTodoFromBytes(body []byte) (*todo, error) {
+
+	// decode and validate the todo, id and timestamps must not be sent by the client
+	validationError := &ValidationError{}
+	todoUpdate, err := decodeTodo(body, "", true, validationError)
 
 	if err != nil {
 		return nil, err
 	}
+	if err := validationError.OrNil(); err != nil {
+		return nil, err
+	}
+
+	newTodo := todoUpdate.todo
 
 	// insert id and update index
-	newTodo.Id = index
-	index++
+	newTodo.Id = nextTodoId()
+
+	// timestamps are set by the server, not by the client
+	newTodo.setCreated()
 
-	return &newTodo, err
+	return &newTodo, nil
+}
+
+// sets the server side timestamps of a new todo
+func (newTodo *todo) setCreated() {
+	newTodo.Created = time.Now()
+	newTodo.Completed = nil
+	if newTodo.Done {
+		newTodo.Completed = &newTodo.Created
+	}
 }
 
 /* Convert request body to a new, temporary Todo, that does not get inserted to db
  * r:		request with json body
- * returns: pointer to the temporary todo or error
+ * returns: pointer to the temporary todo or error (ValidationError with every violation of the Rules)
  */
 func UpdateTodoFromJson(r *http.Request) (*todo, *changeOrder, error) {
 
-	// create empty todoUpdate and fill it with data from body
-	todoUpdate := todoUpdate{}
-	err := json.NewDecoder(r.Body).Decode(&todoUpdate)
+	body, err := readBody(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// decode and validate the update, id and timestamps are ignored
+	validationError := &ValidationError{}
+	todoUpdate, err := decodeTodo(body, "", false, validationError)
+
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validationError.OrNil(); err != nil {
+		return nil, nil, err
+	}
+
+	todo, changeOrder := todoFromUpdate(todoUpdate)
+	return todo, changeOrder, nil
+}
+
+/* Splits a todoUpdate into the todo and a possible moving order
+ * todoUpdate:	decoded update (from a PUT body or a patched todo)
+ * returns: 	pointer to the temporary todo and moving order (nil if the todo is not moved)
+ */
+func todoFromUpdate(todoUpdate todoUpdate) (*todo, *changeOrder) {
 
 	// create todo and fill it with data from todoUpdate
 	todo := todo{
@@ -69,24 +137,23 @@ func UpdateTodoFromJson(r *http.Request) (*todo, *changeOrder, error) {
 		todoUpdate.Text,
 		todoUpdate.Done,
 		todoUpdate.Category,
+		time.Time{},
+		nil,
+		0,
 		nil,
 		nil,
 		nil,
-	}
-
-	if err != nil {
-		return nil, nil, err
 	}
 
 	// check if the update includes a moving order
 	if todoUpdate.UpOrDown == 0 {
 		// return the update, no moving order
-		return &todo, nil, nil
+		return &todo, nil
 	}
 
 	// the update includes a moving order
 
 	moveUp := todoUpdate.UpOrDown == 1
 	changeOrder := changeOrder{&todo, moveUp}
-	return &todo, &changeOrder, nil
+	return &todo, &changeOrder
 }
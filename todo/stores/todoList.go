@@ -1,10 +1,56 @@
 package stores
 
-import "errors"
-
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maximum number of todos in a single todo list
+const MaxTodosPerList = 1000
+
+/* structure of a todo list
+ * the mutex has to be held while reading or changing the list (see AUTH middleware)
+ * the version is increased on every change of the list or its todos
+ */
 type TodoList struct {
-	Id    string
-	Start *todo
+	sync.Mutex
+	Id string
+	// id of the user that owns the list, "" for lists that are opened by their access tokens (legacy lists by their id)
+	Owner   string
+	Version int
+	// metadata of the list, set by its owner (see lists.go)
+	Name        string
+	Description string
+	Color       string
+	Archived    bool
+	// position of the list in the order of the lists of its owner, guarded by the mutex of the store
+	Position int
+	Created  time.Time
+	// users the list is shared with and their roles (see members.go)
+	members  []member
+	Start    *todo
+	Searches []savedSearch
+	// channels of the clients that watch the changes of the list (see Watch)
+	watchers map[chan Change]bool
+	// sequence number of the last change and the last changes of the list (see ChangesSince)
+	lastChange int
+	changeLog  []Change
+	// webhooks that receive the changes of the list and their last deliveries (see webhooks.go)
+	webhooks   []webhook
+	deliveries []*delivery
+	// share links that open the list with a limited role (see shares.go)
+	shareLinks []*shareLink
+	// access tokens of the list, after the first one the id of the list is not a token anymore (see tokens.go)
+	accessTokens     []*accessToken
+	idAccessDisabled bool
+	// CRDT state of the todos by key, keys of the todos by id and the clock of the server (see crdt.go)
+	replicaTodos map[string]*replicaTodo
+	replicaKeys  map[int]string
+	clock        stamp
+	// true while the state of a replica is merged, the changes are not stamped again
+	merging bool
 }
 
 // uses the todo list links to create a slice of all todos
@@ -23,6 +69,27 @@ func (todoList *TodoList) GetTodos() []todo {
 	return todosInTodoList
 }
 
+// returns every category that is used by a todo of the list, sorted and without duplicates
+func (todoList *TodoList) GetCategories() []string {
+
+	seen := map[string]bool{}
+	categories := []string{}
+
+	currentTodo := todoList.Start
+	for currentTodo != nil {
+		for _, category := range currentTodo.Category {
+			if !seen[category] {
+				seen[category] = true
+				categories = append(categories, category)
+			}
+		}
+		currentTodo = currentTodo.Next
+	}
+
+	sort.Strings(categories)
+	return categories
+}
+
 /* searches the todo list for todo with the given id
  * if found -> returns a pointer to the todo with given id
  * if not found -> returns nil
@@ -49,13 +116,23 @@ func (todoList *TodoList) GetTodoById(todoId int) *todo {
 /* appends a todo to a todo list
  * newTodo:	data of todo that will be added
  * returns: pointer to todo that was added
- * error: 	returns nil
+ * error: 	returns ErrQuota if the list is full
  */
-func (todoList *TodoList) AddTodo(newTodo todo) *todo {
+func (todoList *TodoList) AddTodo(newTodo todo) (*todo, error) {
+
+	// check the size of the list before adding another todo
+	if todoList.countTodos() >= MaxTodosPerList {
+		err := fmt.Errorf("%w: a list can hold at most %v todos", ErrQuota, MaxTodosPerList)
+		return nil, err
+	}
 
 	// add todo list reference to the todo
 	newTodo.List = todoList
 
+	// first version of the todo, the list changes too
+	newTodo.Version = 1
+	todoList.Version++
+
 	if todoList.Start == nil {
 		// if the todo list has no todos yet (length = 0):
 		// add new todo to the start field of the list
@@ -76,8 +153,19 @@ func (todoList *TodoList) AddTodo(newTodo todo) *todo {
 		todoList.Start = &newTodo
 	}
 
+	todoList.publish(ChangeCreated, &newTodo)
+
 	// return a pointer to the new todo
-	return &newTodo
+	return &newTodo, nil
+}
+
+// counts the todos of the list by walking the links
+func (todoList *TodoList) countTodos() int {
+	count := 0
+	for currentTodo := todoList.Start; currentTodo != nil; currentTodo = currentTodo.Next {
+		count++
+	}
+	return count
 }
 
 /* Updates a todo in the todo list, replaces the old todo object
@@ -92,20 +180,39 @@ func (todoList *TodoList) UpdateTodo(updatedTodo todo) (*todo, error) {
 
 	if oldTodo == nil {
 		// old todo was not found -> return nil and error
-		err := errors.New("todo with given id was not found")
+		err := fmt.Errorf("%w: todo with id %v", ErrNotFound, updatedTodo.Id)
 		return nil, err
 	}
 
 	// copy list reference (client does not send the listId field)
 	updatedTodo.List = oldTodo.List
 
+	// updates that mark the todo as done are sent as completions to the webhooks
+	completed := updatedTodo.Done && !oldTodo.Done
+
+	// keep the server side timestamps, set completion time if the todo was just marked as done
+	updatedTodo.Created = oldTodo.Created
+	updatedTodo.Completed = oldTodo.Completed
+	if updatedTodo.Done && !oldTodo.Done {
+		now := time.Now()
+		updatedTodo.Completed = &now
+	} else if !updatedTodo.Done {
+		updatedTodo.Completed = nil
+	}
+
 	// copy prev and next pointers
 	updatedTodo.Prev = oldTodo.Prev
 	updatedTodo.Next = oldTodo.Next
 
+	// increase the versions of the todo and the list
+	updatedTodo.Version = oldTodo.Version + 1
+	todoList.Version++
+
 	// update reference
 	*oldTodo = updatedTodo
 
+	todoList.publishChange(ChangeUpdated, &updatedTodo, completed)
+
 	return &updatedTodo, nil
 }
 
@@ -121,7 +228,7 @@ func (todoList *TodoList) RemoveTodo(todoId int) (*todo, error) {
 
 	if todoToBeDeleted == nil {
 		// todo was not found -> return nil and error
-		err := errors.New("todo with given id was not found")
+		err := fmt.Errorf("%w: todo with id %v", ErrNotFound, todoId)
 		return nil, err
 	}
 
@@ -142,10 +249,15 @@ func (todoList *TodoList) RemoveTodo(todoId int) (*todo, error) {
 		todoToBeDeleted.List.Start = todoToBeDeleted.Next
 	}
 
+	// the list changed
+	todoList.Version++
+
 	// the garbage collector should not care about this but just to be sure
 	todoToBeDeleted.Prev = nil
 	todoToBeDeleted.Next = nil
 
+	todoList.publish(ChangeDeleted, todoToBeDeleted)
+
 	// return pointer
 	return todoToBeDeleted, nil
 }
@@ -163,7 +275,7 @@ func (todoList *TodoList) MoveTodo(todoId int, moveUp bool) (*todo, error) {
 
 	if todoToBeMoved == nil {
 		// todo was not found -> return nil and error
-		err := errors.New("todo with given id was not found")
+		err := fmt.Errorf("%w: todo with id %v", ErrNotFound, todoId)
 		return nil, err
 	}
 
@@ -198,10 +310,19 @@ func (todoList *TodoList) MoveTodoUp(todoToBeMoved *todo) (*todo, error) {
 		prevTodo.Prev.Next = todoToBeMoved
 	}
 
+	// the todo after todoToBeMoved follows prevTodo now
+	if todoToBeMoved.Next != nil {
+		todoToBeMoved.Next.Prev = prevTodo
+	}
+
 	// swap todoToBeMoved with its previous todo
 	prevTodo.Next, todoToBeMoved.Next = todoToBeMoved.Next, prevTodo
 	todoToBeMoved.Prev, prevTodo.Prev = prevTodo.Prev, todoToBeMoved
 
+	// the order of the list changed
+	todoList.Version++
+	todoList.publish(ChangeMoved, todoToBeMoved)
+
 	// return pointer
 	return todoToBeMoved, nil
 }
@@ -230,10 +351,19 @@ func (todoList *TodoList) MoveTodoDown(todoToBeMoved *todo) (*todo, error) {
 		todoToBeMoved.Prev.Next = nextTodo
 	}
 
+	// the todo after nextTodo follows todoToBeMoved now
+	if nextTodo.Next != nil {
+		nextTodo.Next.Prev = todoToBeMoved
+	}
+
 	// swap todoToBeMoved with its next todo
 	todoToBeMoved.Next, nextTodo.Next = nextTodo.Next, todoToBeMoved
 	todoToBeMoved.Prev, nextTodo.Prev = nextTodo, todoToBeMoved.Prev
 
+	// the order of the list changed
+	todoList.Version++
+	todoList.publish(ChangeMoved, todoToBeMoved)
+
 	// return pointer
 	return todoToBeMoved, nil
 }
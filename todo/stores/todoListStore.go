@@ -3,10 +3,20 @@ package stores
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
 	"log"
+	"sync"
+	"time"
 )
 
-var todoListStore []TodoList
+// name of lists that were created without a name
+const defaultListName = "Todos"
+
+// lists are stored as pointers, todos keep a reference to their list
+var todoListStore []*TodoList
+
+// guards the todo list store, requests for different lists run concurrently
+var todoListStoreMutex sync.Mutex
 
 /* creates a cryptographic safe random string of 16 bytes (32 chars)
  * is used as the identifier for todo lists
@@ -31,30 +41,62 @@ func randomString() (string, error) {
 }
 
 /* creates a new todo list and adds it to the todo list db
- * is used as the identifier for todo lists
- * returns id of todo list or error
+ * the id only names the list, lists without owner are opened with their initial access token
+ * (or by their id if LegacyIdAccess is set)
+ * owner:	id of the user that owns the list, "" for a list that is opened by its access tokens
+ * returns id of todo list, the initial access token with its token (nil for lists of users and legacy lists)
+ * or error (ErrQuota if the owner already has MaxListsPerUser lists)
  */
-func NewTodoList() (string, error) {
+func NewTodoList(owner string) (string, *accessToken, error) {
 
 	// create new todo list identifier
 	todoListId, err := randomString()
 
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	// create new todo list struct with generated id and empty start field
 	// (will be added when the first todo is added to th list)
-	todoList := TodoList{
-		Id:    todoListId,
-		Start: nil,
+	todoList := &TodoList{
+		Id:      todoListId,
+		Owner:   owner,
+		Name:    defaultListName,
+		Created: time.Now(),
+		Start:   nil,
 	}
 
-	// append new todo list to todo list db
+	// the id is no credential of new lists, lists without owner get a token instead
+	todoList.idAccessDisabled = !LegacyIdAccess
+	var initialToken *accessToken
+	if owner == "" && !LegacyIdAccess {
+		initialToken, err = todoList.AddAccessToken(accessToken{Name: "initial"})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	// append new todo list to todo list db, after the other lists of the owner
+	// the quota is checked under the same lock, concurrent requests can not exceed it
+	todoListStoreMutex.Lock()
+	ownedLists := 0
+	for _, existing := range todoListStore {
+		if owner != "" && existing.Owner == owner {
+			ownedLists++
+			if existing.Position >= todoList.Position {
+				todoList.Position = existing.Position + 1
+			}
+		}
+	}
+	if owner != "" && ownedLists >= MaxListsPerUser {
+		todoListStoreMutex.Unlock()
+		return "", nil, fmt.Errorf("%w: a user can have at most %v lists", ErrQuota, MaxListsPerUser)
+	}
 	todoListStore = append(todoListStore, todoList)
+	todoListStoreMutex.Unlock()
 
-	// return id of new todo list
-	return todoListId, nil
+	// return id and token of new todo list
+	return todoListId, initialToken, nil
 }
 
 /* searches the todo list store for todo list with the given id
@@ -62,10 +104,13 @@ func NewTodoList() (string, error) {
  * if not found -> returns nil
  */
 func GetTodoListById(listId string) *TodoList {
-	for index, todoList := range todoListStore {
+	todoListStoreMutex.Lock()
+	defer todoListStoreMutex.Unlock()
+
+	for _, todoList := range todoListStore {
 		// search for the given id
 		if todoList.Id == listId {
-			return &todoListStore[index]
+			return todoList
 		}
 	}
 	// todo list with given id was not found -> return nil
@@ -0,0 +1,115 @@
+package stores
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+/* Checks the links of the list in both directions and the positions of the replica state
+ * want:	names of the todos in their order
+ */
+func checkOrder(t *testing.T, todoList *TodoList, want []string) {
+	t.Helper()
+
+	forward := todoNames(todoList)
+	if !reflect.DeepEqual(forward, want) {
+		t.Fatalf("got order %v, want %v", forward, want)
+	}
+
+	// the prev links lead back from the last todo to the start
+	backward := []string{}
+	last := todoList.Start
+	for last != nil && last.Next != nil {
+		last = last.Next
+	}
+	for current := last; current != nil; current = current.Prev {
+		backward = append([]string{current.Name}, backward...)
+		if current.Prev == nil && current != todoList.Start {
+			t.Fatalf("todo %v has no prev, but is not the start of the list", current.Name)
+		}
+		if current.Prev != nil && current.Prev.Next != current {
+			t.Fatalf("the next of the prev of %v is %v", current.Name, current.Prev.Next.Name)
+		}
+	}
+	if !reflect.DeepEqual(backward, want) {
+		t.Fatalf("got order %v following the prev links, want %v", backward, want)
+	}
+
+	// replicas order the todos by their positions
+	positions := []string{}
+	for _, entry := range todoList.ReplicaState().Todos {
+		if entry.Deleted == nil {
+			positions = append(positions, todoList.GetTodoById(*entry.Id).Name)
+		}
+	}
+	if !reflect.DeepEqual(positions, want) {
+		t.Fatalf("got order %v of the replica positions, want %v", positions, want)
+	}
+}
+
+// moves the todo at the index of the order in the list and in the order, returns the new order
+func moveInBoth(t *testing.T, todoList *TodoList, order []string, index int, up bool) []string {
+	t.Helper()
+	var moved *todo
+	for current := todoList.Start; current != nil; current = current.Next {
+		if current.Name == order[index] {
+			moved = current
+		}
+	}
+	if _, err := todoList.MoveTodo(moved.Id, up); err != nil {
+		t.Fatal(err)
+	}
+
+	order = append([]string{}, order...)
+	if up && index > 0 {
+		order[index-1], order[index] = order[index], order[index-1]
+	}
+	if !up && index < len(order)-1 {
+		order[index], order[index+1] = order[index+1], order[index]
+	}
+	return order
+}
+
+// move of the todo at the index of the order
+type testMove struct {
+	index int
+	up    bool
+}
+
+func TestMoveTodo(t *testing.T) {
+	tests := []struct {
+		name  string
+		moves []testMove
+		want  []string
+	}{
+		{"up twice", []testMove{{1, true}, {2, true}}, []string{"b", "c", "a"}},
+		{"down twice", []testMove{{0, false}, {1, false}}, []string{"b", "c", "a"}},
+		{"up and down again", []testMove{{2, true}, {1, false}}, []string{"a", "b", "c"}},
+		{"first up and last down", []testMove{{0, true}, {2, false}}, []string{"a", "b", "c"}},
+	}
+
+	for _, test := range tests {
+		todoList := newTestList(t, "a", "b", "c")
+		order := []string{"a", "b", "c"}
+		for _, move := range test.moves {
+			order = moveInBoth(t, todoList, order, move.index, move.up)
+		}
+		if !reflect.DeepEqual(order, test.want) {
+			t.Fatalf("%v: the model of the test got %v, want %v", test.name, order, test.want)
+		}
+		checkOrder(t, todoList, test.want)
+	}
+}
+
+// random moves keep the links and the replica positions in the order of the moves
+func TestMoveTodoSequence(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	order := []string{"a", "b", "c", "d", "e", "f"}
+	todoList := newTestList(t, order...)
+
+	for move := 0; move < 500; move++ {
+		order = moveInBoth(t, todoList, order, random.Intn(len(order)), random.Intn(2) == 0)
+		checkOrder(t, todoList, order)
+	}
+}
@@ -0,0 +1,297 @@
+package stores
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// access tokens have 40 chars, list ids 32, share tokens 48 and session tokens 64
+const AccessTokenLength = 40
+
+// maximum number of access tokens of a single list
+const MaxAccessTokensPerList = 20
+
+// lists without owner that are created while this is set are opened by their id, like in the first releases
+// (opt-in for old clients that only know the id)
+var LegacyIdAccess = false
+
+// json fields of an access token sent by the owner
+var accessTokenFields = []string{"name"}
+
+// structure of an access token, a credential of the list that can be rotated and revoked (e.g. one per device)
+// only the hash of the token is stored, the token itself is sent back once
+type accessToken struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	// the token is only sent back when it is issued or rotated
+	Token    string     `json:"token,omitempty"`
+	Created  time.Time  `json:"created"`
+	Rotated  *time.Time `json:"rotated"`
+	LastUsed *time.Time `json:"lastUsed"`
+	hash     string
+}
+
+// lists of the hashes of the access tokens and the current id of the last access token, guarded by the mutex
+var (
+	accessTokenHashes = map[string]*TodoList{}
+	accessTokenIndex  = 0
+	accessTokensMutex sync.Mutex
+)
+
+/* Hashes a token with SHA-256, tokens are only stored and looked up by their hash
+ * the tokens are random, so a hash without salt is enough
+ */
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// creates a random token of the given length (hex chars)
+func newToken(length int) (string, error) {
+	b := make([]byte, length/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+/* Decodes the name of a new access token
+ * r:		request with json body
+ * returns:	access token (without id and token) or error (ValidationError with every violation)
+ */
+func AccessTokenFromJson(r *http.Request) (*accessToken, error) {
+
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	newAccessToken := accessToken{}
+	validationError := &ValidationError{}
+	if err := decodeFields(body, &newAccessToken, "", accessTokenFields, validationError); err != nil {
+		return nil, err
+	}
+
+	newAccessToken.Name = strings.TrimSpace(newAccessToken.Name)
+	if newAccessToken.Name == "" {
+		validationError.Add("name", "required", "must not be empty")
+	} else if utf8.RuneCountInString(newAccessToken.Name) > Rules.MaxNameLength {
+		validationError.Add("name", "too_long", fmt.Sprintf("must not be longer than %v characters", Rules.MaxNameLength))
+	}
+
+	if err := validationError.OrNil(); err != nil {
+		return nil, err
+	}
+	return &newAccessToken, nil
+}
+
+// returns a copy of the access token without the token
+func (credential accessToken) withoutToken() accessToken {
+	credential.Token = ""
+	return credential
+}
+
+/* Mints a new token for the access token and replaces the hash of the old one
+ * returns:	a copy of the access token with the new token
+ */
+func (todoList *TodoList) mintAccessToken(credential *accessToken) (*accessToken, error) {
+
+	token, err := newToken(AccessTokenLength)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTokensMutex.Lock()
+	delete(accessTokenHashes, credential.hash)
+	credential.hash = hashToken(token)
+	accessTokenHashes[credential.hash] = todoList
+	accessTokensMutex.Unlock()
+
+	minted := *credential
+	minted.Token = token
+	return &minted, nil
+}
+
+/* Issues a new access token of the list
+ * after the first access token the id of the list can not be used as token anymore
+ * the mutex of the list has to be held
+ * returns:	the access token with its token (the only time the token is sent) or ErrQuota
+ */
+func (todoList *TodoList) AddAccessToken(newAccessToken accessToken) (*accessToken, error) {
+
+	if len(todoList.accessTokens) >= MaxAccessTokensPerList {
+		err := fmt.Errorf("%w: a list can have at most %v access tokens", ErrQuota, MaxAccessTokensPerList)
+		return nil, err
+	}
+
+	accessTokensMutex.Lock()
+	newAccessToken.Id = accessTokenIndex
+	accessTokenIndex++
+	accessTokensMutex.Unlock()
+	newAccessToken.Created = time.Now()
+	newAccessToken.Rotated = nil
+	newAccessToken.LastUsed = nil
+
+	minted, err := todoList.mintAccessToken(&newAccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	todoList.accessTokens = append(todoList.accessTokens, &newAccessToken)
+	todoList.idAccessDisabled = true
+	return minted, nil
+}
+
+// returns all access tokens of the list (without the tokens)
+func (todoList *TodoList) GetAccessTokens() []accessToken {
+	credentials := []accessToken{}
+	for _, credential := range todoList.accessTokens {
+		credentials = append(credentials, credential.withoutToken())
+	}
+	return credentials
+}
+
+// searches the access tokens of the list for the given id, returns nil if not found
+func (todoList *TodoList) getAccessToken(accessTokenId int) *accessToken {
+	for _, credential := range todoList.accessTokens {
+		if credential.Id == accessTokenId {
+			return credential
+		}
+	}
+	return nil
+}
+
+/* Replaces the token of an access token, the old token can not be used anymore
+ * returns:	the access token with its new token or ErrNotFound
+ */
+func (todoList *TodoList) RotateAccessToken(accessTokenId int) (*accessToken, error) {
+
+	credential := todoList.getAccessToken(accessTokenId)
+	if credential == nil {
+		return nil, fmt.Errorf("%w: access token with id %v", ErrNotFound, accessTokenId)
+	}
+
+	now := time.Now()
+	credential.Rotated = &now
+	return todoList.mintAccessToken(credential)
+}
+
+/* Revokes an access token, its token can not be used anymore
+ * the last access token of a list without owner can not be revoked, nobody could open the list anymore
+ * returns:	the revoked access token (without token), ErrNotFound or ErrConflict
+ */
+func (todoList *TodoList) RemoveAccessToken(accessTokenId int) (*accessToken, error) {
+
+	credential := todoList.getAccessToken(accessTokenId)
+	if credential == nil {
+		return nil, fmt.Errorf("%w: access token with id %v", ErrNotFound, accessTokenId)
+	}
+	if todoList.Owner == "" && len(todoList.accessTokens) == 1 {
+		return nil, fmt.Errorf("%w: the last access token of the list can not be revoked, rotate it instead", ErrConflict)
+	}
+
+	for index, existing := range todoList.accessTokens {
+		if existing == credential {
+			todoList.accessTokens = append(todoList.accessTokens[:index], todoList.accessTokens[index+1:]...)
+		}
+	}
+
+	accessTokensMutex.Lock()
+	delete(accessTokenHashes, credential.hash)
+	accessTokensMutex.Unlock()
+
+	revoked := credential.withoutToken()
+	return &revoked, nil
+}
+
+// removes the hashes of all access tokens of the list, is called when the list is deleted
+func (todoList *TodoList) removeAccessTokens() {
+	accessTokensMutex.Lock()
+	defer accessTokensMutex.Unlock()
+	for _, credential := range todoList.accessTokens {
+		delete(accessTokenHashes, credential.hash)
+	}
+}
+
+/* Opens a list with an access token and records the time of the use
+ * token:	the access token of the request
+ * returns:	the list and the id of the access token, or nil if the token is unknown, rotated or revoked
+ */
+func UseAccessToken(token string) (*TodoList, int) {
+
+	hash := hashToken(token)
+
+	accessTokensMutex.Lock()
+	todoList := accessTokenHashes[hash]
+	accessTokensMutex.Unlock()
+
+	if todoList == nil {
+		return nil, 0
+	}
+
+	todoList.Lock()
+	defer todoList.Unlock()
+
+	for _, credential := range todoList.accessTokens {
+		if credential.hash == hash {
+			now := time.Now()
+			credential.LastUsed = &now
+			return todoList, credential.Id
+		}
+	}
+	return nil, 0
+}
+
+/* Checks that an access token still opens its list, without recording a use (see ActiveShareLink)
+ * the mutex of the list must not be held
+ * returns:	the list or nil if the token was rotated or revoked
+ */
+func ActiveAccessToken(token string) *TodoList {
+
+	hash := hashToken(token)
+
+	accessTokensMutex.Lock()
+	todoList := accessTokenHashes[hash]
+	accessTokensMutex.Unlock()
+
+	if todoList == nil {
+		return nil
+	}
+
+	todoList.Lock()
+	defer todoList.Unlock()
+
+	for _, credential := range todoList.accessTokens {
+		if credential.hash == hash {
+			return todoList
+		}
+	}
+	return nil
+}
+
+/* Opens a list with its id as token, like the first releases did
+ * only lists that were created with LegacyIdAccess and have no access tokens are opened by their id
+ * returns:	the list or nil if the id is unknown or can not be used as token
+ */
+func GetTodoListByIdToken(listId string) *TodoList {
+
+	todoList := GetTodoListById(listId)
+	if todoList == nil {
+		return nil
+	}
+
+	todoList.Lock()
+	defer todoList.Unlock()
+
+	if todoList.idAccessDisabled {
+		return nil
+	}
+	return todoList
+}
@@ -0,0 +1,156 @@
+package stores
+
+import (
+	"errors"
+	"testing"
+)
+
+// new lists without owner are opened with their initial access token, not with their id
+func TestNewTodoListIssuesAccessToken(t *testing.T) {
+	listId, initialToken, err := NewTodoList("")
+	if err != nil || initialToken == nil || len(initialToken.Token) != AccessTokenLength {
+		t.Fatalf("got token %+v (%v)", initialToken, err)
+	}
+
+	if todoList, accessTokenId := UseAccessToken(initialToken.Token); todoList == nil || todoList.Id != listId || accessTokenId != initialToken.Id {
+		t.Errorf("the initial token does not open the list")
+	}
+	if GetTodoListByIdToken(listId) != nil {
+		t.Errorf("the id opens the list")
+	}
+
+	// lists of users are opened by the session of the user
+	if _, userToken, _ := NewTodoList("alice"); userToken != nil {
+		t.Errorf("list of a user got access token %+v", userToken)
+	}
+}
+
+// old clients can still open new lists by their id if it is enabled, until the first access token is issued
+func TestLegacyIdAccess(t *testing.T) {
+	LegacyIdAccess = true
+	defer func() { LegacyIdAccess = false }()
+
+	listId, initialToken, err := NewTodoList("")
+	if err != nil || initialToken != nil {
+		t.Fatalf("got token %+v (%v), want none", initialToken, err)
+	}
+	todoList := GetTodoListByIdToken(listId)
+	if todoList == nil {
+		t.Fatalf("the id does not open the legacy list")
+	}
+
+	todoList.Lock()
+	todoList.AddAccessToken(accessToken{Name: "phone"})
+	todoList.Unlock()
+	if GetTodoListByIdToken(listId) != nil {
+		t.Errorf("the id opens the list after an access token was issued")
+	}
+}
+
+// only the hashes of the tokens are stored, the lookup records the last use
+func TestAccessTokensAreStoredByHash(t *testing.T) {
+	todoList := newTestList(t)
+	todoList.Lock()
+	minted, _ := todoList.AddAccessToken(accessToken{Name: "phone"})
+	todoList.Unlock()
+
+	accessTokensMutex.Lock()
+	byHash, byToken := accessTokenHashes[hashToken(minted.Token)], accessTokenHashes[minted.Token]
+	accessTokensMutex.Unlock()
+	if byHash != todoList || byToken != nil {
+		t.Errorf("the access token is not stored by its hash")
+	}
+
+	todoList.Lock()
+	stored := todoList.GetAccessTokens()[0]
+	todoList.Unlock()
+	if stored.Token != "" || stored.LastUsed != nil {
+		t.Errorf("got stored access token %+v", stored)
+	}
+
+	if found, _ := UseAccessToken(minted.Token); found != todoList {
+		t.Fatalf("the access token does not open the list")
+	}
+	if found, _ := UseAccessToken(hashToken(minted.Token)); found != nil {
+		t.Errorf("the hash opens the list")
+	}
+	todoList.Lock()
+	defer todoList.Unlock()
+	if todoList.GetAccessTokens()[0].LastUsed == nil {
+		t.Errorf("the use of the access token was not recorded")
+	}
+}
+
+// rotated tokens can not be used anymore, the new token opens the list
+func TestRotateAccessToken(t *testing.T) {
+	todoList := newTestList(t)
+	todoList.Lock()
+	minted, _ := todoList.AddAccessToken(accessToken{Name: "phone"})
+	rotated, err := todoList.RotateAccessToken(minted.Id)
+	_, errUnknown := todoList.RotateAccessToken(-1)
+	todoList.Unlock()
+
+	if err != nil || rotated.Id != minted.Id || rotated.Token == minted.Token || rotated.Rotated == nil {
+		t.Fatalf("got rotated access token %+v (%v)", rotated, err)
+	}
+	if found, _ := UseAccessToken(minted.Token); found != nil {
+		t.Errorf("the old token opens the list")
+	}
+	if found, _ := UseAccessToken(rotated.Token); found != todoList {
+		t.Errorf("the new token does not open the list")
+	}
+	if !errors.Is(errUnknown, ErrNotFound) {
+		t.Errorf("rotation of an unknown access token: got %v, want ErrNotFound", errUnknown)
+	}
+}
+
+// revoked tokens can not be used anymore, the last token of a list without owner is kept
+func TestRemoveAccessToken(t *testing.T) {
+	todoList := newTestList(t)
+	todoList.Lock()
+	phone, _ := todoList.AddAccessToken(accessToken{Name: "phone"})
+	laptop, _ := todoList.AddAccessToken(accessToken{Name: "laptop"})
+	_, err := todoList.RemoveAccessToken(laptop.Id)
+	_, errLast := todoList.RemoveAccessToken(phone.Id)
+	_, errUnknown := todoList.RemoveAccessToken(laptop.Id)
+	todoList.Unlock()
+
+	if err != nil {
+		t.Fatalf("revocation: %v", err)
+	}
+	if found, _ := UseAccessToken(laptop.Token); found != nil {
+		t.Errorf("the revoked token opens the list")
+	}
+	if found, _ := UseAccessToken(phone.Token); found != todoList {
+		t.Errorf("the other token does not open the list anymore")
+	}
+	if !errors.Is(errLast, ErrConflict) {
+		t.Errorf("revocation of the last access token: got %v, want ErrConflict", errLast)
+	}
+	if !errors.Is(errUnknown, ErrNotFound) {
+		t.Errorf("revocation of a revoked access token: got %v, want ErrNotFound", errUnknown)
+	}
+
+	// lists of users are still opened by the sessions of their members
+	owned := &TodoList{Id: "owned", Owner: "alice"}
+	owned.Lock()
+	defer owned.Unlock()
+	last, _ := owned.AddAccessToken(accessToken{Name: "phone"})
+	if _, err := owned.RemoveAccessToken(last.Id); err != nil {
+		t.Errorf("revocation of the last access token of a list of a user: %v", err)
+	}
+}
+
+func TestAccessTokenQuota(t *testing.T) {
+	todoList := newTestList(t)
+	todoList.Lock()
+	defer todoList.Unlock()
+	for index := 0; index < MaxAccessTokensPerList; index++ {
+		if _, err := todoList.AddAccessToken(accessToken{Name: "device"}); err != nil {
+			t.Fatalf("access token %v: %v", index, err)
+		}
+	}
+	if _, err := todoList.AddAccessToken(accessToken{Name: "device"}); !errors.Is(err, ErrQuota) {
+		t.Errorf("got %v, want ErrQuota", err)
+	}
+}
@@ -0,0 +1,204 @@
+package stores
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cost of the bcrypt password hashes
+const passwordCost = bcrypt.DefaultCost
+
+// bcrypt only uses the first 72 bytes of a password, longer passwords are rejected
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// usernames are lowercase letters, digits and . _ -
+var usernamePattern = regexp.MustCompile(`^[a-z0-9._-]{3,50}$`)
+
+// json fields of a registration or login
+var credentialFields = []string{"username", "password"}
+
+// structure of a user account
+// the id is used in sessions and as owner of todo lists
+type User struct {
+	Id           string    `json:"id"`
+	Username     string    `json:"username"`
+	Created      time.Time `json:"created"`
+	passwordHash []byte
+}
+
+// username and password sent by a client (registration and login)
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// users by id, guarded by the mutex
+var (
+	userStore      = map[string]*User{}
+	userStoreMutex sync.Mutex
+)
+
+// hash that is compared for unknown usernames, so logins of unknown users take as long as wrong passwords
+var unknownUserHash, _ = bcrypt.GenerateFromPassword([]byte("unknown user"), passwordCost)
+
+/* Decodes the username and password of a registration or login
+ * r:			request with json body
+ * register:	if true, the username and password are checked against the rules for new accounts
+ * returns:		credentials or error (ValidationError with every violation)
+ */
+func CredentialsFromJson(r *http.Request, register bool) (credentials, error) {
+
+	request := credentials{}
+
+	body, err := readBody(r)
+	if err != nil {
+		return request, err
+	}
+
+	validationError := &ValidationError{}
+	if err := decodeFields(body, &request, "", credentialFields, validationError); err != nil {
+		return request, err
+	}
+
+	request.Username = strings.ToLower(strings.TrimSpace(request.Username))
+	if request.Username == "" {
+		validationError.Add("username", "required", "must not be empty")
+	} else if register && !usernamePattern.MatchString(request.Username) {
+		validationError.Add("username", "invalid_characters", "must be 3 to 50 lowercase letters, digits or . _ -")
+	}
+
+	if request.Password == "" {
+		validationError.Add("password", "required", "must not be empty")
+	} else if register && len(request.Password) < minPasswordLength {
+		validationError.Add("password", "too_short", fmt.Sprintf("must be at least %v characters long", minPasswordLength))
+	} else if register && len(request.Password) > maxPasswordLength {
+		validationError.Add("password", "too_long", fmt.Sprintf("must not be longer than %v bytes", maxPasswordLength))
+	}
+
+	if err := validationError.OrNil(); err != nil {
+		return request, err
+	}
+	return request, nil
+}
+
+/* Creates a new user account
+ * the password is stored as bcrypt hash
+ * returns:	the new user or error (ErrConflict if the username is taken)
+ */
+func RegisterUser(request credentials) (*User, error) {
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(request.Password), passwordCost)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	userStoreMutex.Lock()
+	defer userStoreMutex.Unlock()
+
+	for _, existing := range userStore {
+		if existing.Username == request.Username {
+			return nil, fmt.Errorf("%w: username %q is already taken", ErrConflict, request.Username)
+		}
+	}
+
+	newUser := &User{Id: userId, Username: request.Username, Created: time.Now(), passwordHash: hash}
+	userStore[userId] = newUser
+	return newUser, nil
+}
+
+/* Checks the username and password of a login
+ * unknown usernames and wrong passwords get the same error, so usernames can not be guessed
+ * returns:	the user or nil if the credentials are wrong
+ */
+func AuthenticateUser(request credentials) *User {
+
+	userStoreMutex.Lock()
+	var found *User
+	for _, existing := range userStore {
+		if existing.Username == request.Username {
+			found = existing
+		}
+	}
+	userStoreMutex.Unlock()
+
+	if found == nil {
+		bcrypt.CompareHashAndPassword(unknownUserHash, []byte(request.Password))
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword(found.passwordHash, []byte(request.Password)) != nil {
+		return nil
+	}
+	return found
+}
+
+// searches the user store for the user with the given id, returns nil if not found
+func GetUserById(userId string) *User {
+	userStoreMutex.Lock()
+	defer userStoreMutex.Unlock()
+	return userStore[userId]
+}
+
+/* Returns the ids of the todo lists the user owns, in order of creation
+ * userId:	id of the user
+ */
+func GetListIdsOfUser(userId string) []string {
+	todoListStoreMutex.Lock()
+	defer todoListStoreMutex.Unlock()
+
+	listIds := []string{}
+	for _, todoList := range todoListStore {
+		if todoList.Owner == userId {
+			listIds = append(listIds, todoList.Id)
+		}
+	}
+	return listIds
+}
+
+/* Checks if a user may access the todo list
+ * lists without owner are opened by their access tokens (legacy lists by their id),
+ * lists of users only by their owner and the users the list was shared with (see members.go)
+ * userId:	id of the user of the session, "" for requests with a list token
+ */
+func (todoList *TodoList) AccessibleBy(userId string) bool {
+	return todoList.RoleOf(userId) != ""
+}
+
+// searches the user store for the user with the given username, returns nil if not found
+func GetUserByUsername(username string) *User {
+	userStoreMutex.Lock()
+	defer userStoreMutex.Unlock()
+
+	username = strings.ToLower(username)
+	for _, existing := range userStore {
+		if existing.Username == username {
+			return existing
+		}
+	}
+	return nil
+}
+
+// structure of the account of the logged in user, with the ids of its lists and the lists shared with it
+type userProfile struct {
+	User
+	Lists  []string     `json:"lists"`
+	Shared []sharedList `json:"shared"`
+}
+
+// returns the account of the user with the ids of its lists and the lists of other users it can open
+func (user *User) Profile() userProfile {
+	return userProfile{*user, GetListIdsOfUser(user.Id), GetSharedListsOfUser(user.Id)}
+}
@@ -0,0 +1,228 @@
+package stores
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// rules that are checked for every todo and saved search sent by a client
+type ValidationRules struct {
+	// name of todos and saved searches must not be empty
+	NameRequired bool
+	// maximum length of names and texts (in characters)
+	MaxNameLength int
+	MaxTextLength int
+	// maximum number of categories of a todo and maximum length of a category
+	MaxCategories     int
+	MaxCategoryLength int
+	// every category has to match the pattern (nil allows every category)
+	CategoryPattern *regexp.Regexp
+	// fields that are not part of the json structure are violations
+	RejectUnknownFields bool
+	// maximum size of a request body in bytes
+	MaxBodyBytes int64
+}
+
+// rules that are used by the stores, can be changed before the server is started
+var Rules = ValidationRules{
+	NameRequired:        true,
+	MaxNameLength:       200,
+	MaxTextLength:       10000,
+	MaxCategories:       10,
+	MaxCategoryLength:   50,
+	CategoryPattern:     regexp.MustCompile(`^[\p{L}\p{N} _.&/-]+$`),
+	RejectUnknownFields: true,
+	MaxBodyBytes:        1 << 20,
+}
+
+// json fields of a todo, some of them are set by the server and can not be sent when creating a todo
+var (
+	todoFields         = []string{"id", "name", "text", "done", "category", "created", "completed", "version"}
+	todoReadOnlyFields = []string{"id", "created", "completed", "version"}
+	todoCreateFields   = []string{"name", "text", "done", "category"}
+	todoUpdateFields   = append(append([]string{}, todoFields...), "upOrDown")
+	searchFields       = []string{"id", "name", "filter"}
+)
+
+/* Reads the whole request body, but at most Rules.MaxBodyBytes
+ * r:		request with json body
+ * returns:	body or error (validation error if the body is too large)
+ */
+func readBody(r *http.Request) ([]byte, error) {
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, Rules.MaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > Rules.MaxBodyBytes {
+		validationError := &ValidationError{}
+		validationError.Add("body", "too_large", fmt.Sprintf("must not be larger than %v bytes", Rules.MaxBodyBytes))
+		return nil, validationError
+	}
+
+	return body, nil
+}
+
+/* Decodes a json object into a todoUpdate and checks it against the rules
+ * body:			json object of the todo
+ * prefix:			prefix of the field names in violations (e.g. "operations[0].todo.")
+ * create:			if true, fields that are set by the server (id, timestamps, version) are violations
+ * validationError:	collects every violation
+ * returns: 		decoded todoUpdate or error if the body is not a json object
+ */
+func decodeTodo(body []byte, prefix string, create bool, validationError *ValidationError) (todoUpdate, error) {
+
+	allowedFields := todoUpdateFields
+	if create {
+		allowedFields = todoFields
+	}
+
+	todoUpdate := todoUpdate{}
+	err := decodeFields(body, &todoUpdate, prefix, allowedFields, validationError)
+	if err != nil {
+		return todoUpdate, err
+	}
+
+	// fields the server sets on its own
+	if create {
+		checkReadOnlyFields(body, prefix, validationError)
+	}
+
+	Rules.validateTodo(&todoUpdate.todo, prefix, validationError)
+	return todoUpdate, nil
+}
+
+/* Decodes a json object field by field, so every unknown field and every field with a wrong type is reported
+ * body:			json object
+ * target:			pointer to the struct the fields are decoded into
+ * prefix:			prefix of the field names in violations
+ * allowedFields:	json names of the fields of the struct
+ * validationError:	collects every violation
+ * returns:			error if the body is not a json object
+ */
+func decodeFields(body []byte, target interface{}, prefix string, allowedFields []string, validationError *ValidationError) error {
+
+	// split the object into its fields
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return err
+	}
+
+	// sort the field names, so the violations always have the same order
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+
+		if !contains(allowedFields, name) {
+			if Rules.RejectUnknownFields {
+				validationError.Add(prefix+name, "unknown_field", "is not a known field")
+			}
+			continue
+		}
+
+		// decode only this field, type errors of one field do not hide the others
+		field, _ := json.Marshal(map[string]json.RawMessage{name: fields[name]})
+		if err := json.Unmarshal(field, target); err != nil {
+			validationError.Add(prefix+name, "invalid_type", "has the wrong type")
+		}
+	}
+
+	return nil
+}
+
+// adds a violation for every field of the body that is set by the server
+func checkReadOnlyFields(body []byte, prefix string, validationError *ValidationError) {
+	fields := map[string]json.RawMessage{}
+	json.Unmarshal(body, &fields)
+	for _, name := range todoReadOnlyFields {
+		if _, sent := fields[name]; sent {
+			validationError.Add(prefix+name, "read_only", "is set by the server")
+		}
+	}
+}
+
+/* Checks a todo against the rules
+ * todo:			todo that will be checked
+ * prefix:			prefix of the field names in violations
+ * validationError:	collects every violation
+ */
+func (rules *ValidationRules) validateTodo(todo *todo, prefix string, validationError *ValidationError) {
+
+	rules.validateName(todo.Name, prefix, validationError)
+
+	if utf8.RuneCountInString(todo.Text) > rules.MaxTextLength {
+		validationError.Add(prefix+"text", "too_long", fmt.Sprintf("must not be longer than %v characters", rules.MaxTextLength))
+	}
+
+	rules.validateCategories(todo.Category, prefix+"category", validationError)
+}
+
+// checks the name of a todo or saved search
+func (rules *ValidationRules) validateName(name string, prefix string, validationError *ValidationError) {
+	if rules.NameRequired && strings.TrimSpace(name) == "" {
+		validationError.Add(prefix+"name", "required", "must not be empty")
+	}
+	if utf8.RuneCountInString(name) > rules.MaxNameLength {
+		validationError.Add(prefix+"name", "too_long", fmt.Sprintf("must not be longer than %v characters", rules.MaxNameLength))
+	}
+}
+
+/* Checks the categories of a todo or a filter
+ * count, length, charset and duplicates (case insensitive) are checked
+ */
+func (rules *ValidationRules) validateCategories(categories []string, field string, validationError *ValidationError) {
+
+	if len(categories) > rules.MaxCategories {
+		validationError.Add(field, "too_many", fmt.Sprintf("must not have more than %v categories", rules.MaxCategories))
+	}
+
+	seen := map[string]bool{}
+	for index, category := range categories {
+		categoryField := fmt.Sprintf("%v[%v]", field, index)
+
+		if strings.TrimSpace(category) == "" {
+			validationError.Add(categoryField, "required", "must not be empty")
+			continue
+		}
+		if utf8.RuneCountInString(category) > rules.MaxCategoryLength {
+			validationError.Add(categoryField, "too_long", fmt.Sprintf("must not be longer than %v characters", rules.MaxCategoryLength))
+		}
+		if rules.CategoryPattern != nil && !rules.CategoryPattern.MatchString(category) {
+			validationError.Add(categoryField, "invalid_characters", "contains characters that are not allowed")
+		}
+		if seen[strings.ToLower(category)] {
+			validationError.Add(categoryField, "duplicate", "is a duplicate category")
+		}
+		seen[strings.ToLower(category)] = true
+	}
+}
+
+// checks a saved search against the rules
+func (rules *ValidationRules) validateSearch(search *savedSearch, validationError *ValidationError) {
+	rules.validateName(search.Name, "", validationError)
+	rules.validateCategories(search.Filter.Category, "filter.category", validationError)
+	if utf8.RuneCountInString(search.Filter.Query) > rules.MaxNameLength {
+		validationError.Add("filter.query", "too_long", fmt.Sprintf("must not be longer than %v characters", rules.MaxNameLength))
+	}
+}
+
+// checks if the slice contains the value
+func contains(values []string, value string) bool {
+	for _, other := range values {
+		if other == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package stores
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// returns the violations of a validation error as "field:code", nil for other errors
+func violations(err error) []string {
+	var validationError *ValidationError
+	if !errors.As(err, &validationError) {
+		return nil
+	}
+	result := []string{}
+	for _, field := range validationError.Fields {
+		result = append(result, field.Field+":"+field.Code)
+	}
+	return result
+}
+
+func TestNewTodoValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"valid todo", `{"name":"milk","text":"2l","category":["shop","food"],"done":true}`, []string{}},
+		{"missing name", `{"text":"2l"}`, []string{"name:required"}},
+		{"blank name", `{"name":"   "}`, []string{"name:required"}},
+		{"name too long", `{"name":"` + strings.Repeat("ä", 201) + `"}`, []string{"name:too_long"}},
+		{"name at the limit", `{"name":"` + strings.Repeat("ä", 200) + `"}`, []string{}},
+		{"text too long", `{"name":"a","text":"` + strings.Repeat("x", 10001) + `"}`, []string{"text:too_long"}},
+		{"unknown fields in order", `{"name":"a","zeta":1,"color":"red"}`, []string{"color:unknown_field", "zeta:unknown_field"}},
+		{"upOrDown only on updates", `{"name":"a","upOrDown":1}`, []string{"upOrDown:unknown_field"}},
+		{"read-only fields", `{"name":"a","id":3,"version":2}`, []string{"id:read_only", "version:read_only"}},
+		{"wrong types are reported per field", `{"name":1,"done":"yes"}`, []string{"done:invalid_type", "name:invalid_type", "name:required"}},
+		{"too many categories", `{"name":"a","category":["1","2","3","4","5","6","7","8","9","10","11"]}`, []string{"category:too_many"}},
+		{"empty category", `{"name":"a","category":[" "]}`, []string{"category[0]:required"}},
+		{"category too long", `{"name":"a","category":["` + strings.Repeat("c", 51) + `"]}`, []string{"category[0]:too_long"}},
+		{"category characters", `{"name":"a","category":["a<b>"]}`, []string{"category[0]:invalid_characters"}},
+		{"duplicate category", `{"name":"a","category":["Shop","shop"]}`, []string{"category[1]:duplicate"}},
+	}
+
+	for _, test := range tests {
+		_, err := NewTodoFromBytes([]byte(test.body))
+		got := violations(err)
+		if err == nil {
+			got = []string{}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got violations %v (%v), want %v", test.name, got, err, test.want)
+		}
+	}
+}
+
+// bodies that are no json object are no validation errors, they are reported as bad requests
+func TestNewTodoNoObject(t *testing.T) {
+	for _, body := range []string{`[]`, `"milk"`, `{"name":`} {
+		_, err := NewTodoFromBytes([]byte(body))
+		if err == nil || errors.Is(err, ErrValidation) {
+			t.Errorf("%v: got error %v, want a decoding error", body, err)
+		}
+	}
+}
+
+// the rules can be changed before the server is started
+func TestChangedRules(t *testing.T) {
+	defaultRules := Rules
+	defer func() { Rules = defaultRules }()
+
+	Rules.RejectUnknownFields = false
+	Rules.NameRequired = false
+	Rules.CategoryPattern = nil
+	Rules.MaxCategories = 1
+
+	_, err := NewTodoFromBytes([]byte(`{"color":"red","category":["a<b>"]}`))
+	if err != nil {
+		t.Errorf("got error %v with relaxed rules", err)
+	}
+
+	_, err = NewTodoFromBytes([]byte(`{"category":["a","b"]}`))
+	if got := violations(err); !reflect.DeepEqual(got, []string{"category:too_many"}) {
+		t.Errorf("got violations %v, want the changed category limit", got)
+	}
+}
+
+func TestReadBodyLimit(t *testing.T) {
+	defaultRules := Rules
+	defer func() { Rules = defaultRules }()
+	Rules.MaxBodyBytes = 16
+
+	body, err := readBody(httptest.NewRequest("POST", "/todo", strings.NewReader(strings.Repeat("x", 16))))
+	if err != nil || len(body) != 16 {
+		t.Errorf("body at the limit: got %v bytes and error %v", len(body), err)
+	}
+
+	_, err = readBody(httptest.NewRequest("POST", "/todo", strings.NewReader(strings.Repeat("x", 17))))
+	if got := violations(err); !reflect.DeepEqual(got, []string{"body:too_large"}) {
+		t.Errorf("body over the limit: got violations %v", got)
+	}
+}
+
+func TestSearchValidation(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`{"name":"open","filter":{"done":false,"category":["shop"],"query":"milk"}}`, []string{}},
+		{`{"filter":{}}`, []string{"name:required"}},
+		{`{"name":"a","filter":{"category":["x","X"]}}`, []string{"filter.category[1]:duplicate"}},
+		{`{"name":"a","filter":{"query":"` + strings.Repeat("q", 201) + `"}}`, []string{"filter.query:too_long"}},
+		{`{"name":"a","sort":"name"}`, []string{"sort:unknown_field"}},
+	}
+
+	for _, test := range tests {
+		_, err := UpdateSearchFromJson(httptest.NewRequest("PUT", "/search", strings.NewReader(test.body)))
+		got := violations(err)
+		if err == nil {
+			got = []string{}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got violations %v (%v), want %v", test.body, got, err, test.want)
+		}
+	}
+}
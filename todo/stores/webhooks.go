@@ -0,0 +1,493 @@
+package stores
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+/*
+ * Outbound webhooks of a todo list
+ * every change of the list is sent as POST request to the url of every webhook that subscribed to the event:
+ *
+ *	{"event": "completed", "change": {"id": 12, "type": "updated", "todo": {...}, "listVersion": 34}, "timestamp": "..."}
+ *
+ * the body is signed with the secret of the webhook (HMAC-SHA256, hex encoded):
+ *
+ *	X-Todo-Signature-256: sha256=<hmac of the body>
+ *
+ * receivers that do not answer with 2xx get the delivery again with exponential backoff,
+ * every attempt is recorded and a delivery can be sent again (redeliver)
+ *
+ * webhooks must not reach the network of the server (loopback, private and link-local addresses like 169.254.169.254),
+ * the urls are checked when the webhook is created and the address of every connection is checked when it is dialed
+ */
+
+// an update that marks a todo as done is also sent as completed event
+const WebhookCompleted = "completed"
+
+// events a webhook can subscribe to
+var webhookEvents = []string{ChangeCreated, ChangeUpdated, ChangeDeleted, ChangeMoved, WebhookCompleted}
+
+// states of a delivery
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	// maximum number of webhooks in a single todo list
+	MaxWebhooksPerList = 10
+	// number of deliveries that are kept per list, older deliveries are removed
+	MaxDeliveriesPerList = 200
+)
+
+// settings of the deliveries, can be changed before the server is started (e.g. shorter delays in tests)
+var (
+	// attempts of a delivery (and of every redelivery) before it fails
+	WebhookMaxAttempts = 6
+	// delay before the first retry, doubled for every further retry
+	WebhookBackoff = time.Second
+	// client that sends the deliveries, its dialer refuses internal addresses
+	WebhookClient = &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: checkWebhookDial}).DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+	}
+	// allows loopback, private and link-local receivers (e.g. receivers on localhost in tests)
+	WebhookAllowInternalTargets = false
+)
+
+// current id of last webhook and last delivery, guarded by the mutex (deliveries of different lists are created at the same time)
+var (
+	webhookIndex  int = 0
+	deliveryIndex int = 0
+	webhooksMutex sync.Mutex
+)
+
+// json fields of a webhook sent by a client
+var webhookFields = []string{"url", "events", "secret"}
+
+// structure of a webhook subscription
+// not public, use constructor functions below
+type webhook struct {
+	Id  int    `json:"id"`
+	Url string `json:"url"`
+	// events the webhook receives, every event if empty
+	Events []string `json:"events"`
+	// key of the signatures, only sent back when the webhook is created
+	Secret  string    `json:"secret,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// single attempt of a delivery
+type deliveryAttempt struct {
+	Time time.Time `json:"time"`
+	// status code of the response of the receiver (0 if no response was received)
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// duration of the request in milliseconds
+	Duration int64 `json:"duration"`
+}
+
+// structure of a delivery of an event to a webhook
+type delivery struct {
+	Id        int    `json:"id"`
+	WebhookId int    `json:"webhookId"`
+	Event     string `json:"event"`
+	// pending, succeeded or failed
+	Status      string            `json:"status"`
+	Payload     json.RawMessage   `json:"payload"`
+	Attempts    []deliveryAttempt `json:"attempts"`
+	NextAttempt *time.Time        `json:"nextAttempt,omitempty"`
+}
+
+// body of a delivery
+type webhookPayload struct {
+	Event     string    `json:"event"`
+	Change    Change    `json:"change"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+/* Create a new webhook
+ * a random secret is created if the client did not send one
+ * r:		request with json body
+ * returns: pointer to the temporary webhook or error (ValidationError with every violation)
+ */
+func NewWebhookFromJson(r *http.Request) (*webhook, error) {
+
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// create empty webhook and fill it with data from body
+	newWebhook := webhook{}
+	validationError := &ValidationError{}
+	if err := decodeFields(body, &newWebhook, "", webhookFields, validationError); err != nil {
+		return nil, err
+	}
+
+	validateWebhook(&newWebhook, validationError)
+	if err := validationError.OrNil(); err != nil {
+		return nil, err
+	}
+
+	if newWebhook.Secret == "" {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		newWebhook.Secret = hex.EncodeToString(secret)
+	}
+	if newWebhook.Events == nil {
+		newWebhook.Events = []string{}
+	}
+
+	// insert id and update index
+	webhooksMutex.Lock()
+	newWebhook.Id = webhookIndex
+	webhookIndex++
+	webhooksMutex.Unlock()
+	newWebhook.Created = time.Now()
+
+	return &newWebhook, nil
+}
+
+// checks the url and the events of a webhook
+func validateWebhook(hook *webhook, validationError *ValidationError) {
+
+	target, err := url.Parse(hook.Url)
+	if hook.Url == "" {
+		validationError.Add("url", "required", "must not be empty")
+	} else if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		validationError.Add("url", "invalid_url", "has to be an absolute http or https url")
+	} else if isInternalHost(target.Hostname()) {
+		validationError.Add("url", "internal_target", "must not point to a loopback, private or link-local address")
+	}
+
+	for index, event := range hook.Events {
+		if !contains(webhookEvents, event) {
+			validationError.Add(fmt.Sprintf("events[%v]", index), "invalid_value", fmt.Sprintf("must be one of %v", webhookEvents))
+		}
+	}
+
+	if len(hook.Secret) > 256 {
+		validationError.Add("secret", "too_long", "must not be longer than 256 characters")
+	}
+}
+
+/* Checks if a host of a webhook url is inside of the network of the server
+ * names are only resolved when the delivery is sent, so only localhost and ip addresses are checked here
+ */
+func isInternalHost(host string) bool {
+	if WebhookAllowInternalTargets {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && isInternalAddress(ip)
+}
+
+// shared address space of carrier-grade NAT (RFC 6598), reaches the network of the provider
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// loopback, private (RFC 1918, RFC 4193), shared (100.64.0.0/10), link-local (169.254.0.0/16, fe80::/10) and unspecified addresses
+func isInternalAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || sharedAddressSpace.Contains(ip) || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+/* Control function of the dialer of WebhookClient, runs before every connection with the resolved address
+ * names that resolve to internal addresses (DNS rebinding) and redirects to them are refused here
+ */
+func checkWebhookDial(network string, address string, conn syscall.RawConn) error {
+	if WebhookAllowInternalTargets {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isInternalAddress(ip) {
+		return fmt.Errorf("webhook target %v is an internal address", host)
+	}
+	return nil
+}
+
+// returns a copy of the webhook without its secret
+func (hook webhook) withoutSecret() webhook {
+	hook.Secret = ""
+	return hook
+}
+
+/* Returns the name of the event a change is sent as to the webhook
+ * changeType:	type of the change (created, updated, deleted, moved)
+ * completed:	true if the change marked the todo as done
+ * returns:		name of the event or "" if the webhook did not subscribe to the change
+ */
+func (hook *webhook) eventFor(changeType string, completed bool) string {
+	if len(hook.Events) == 0 {
+		if completed {
+			return WebhookCompleted
+		}
+		return changeType
+	}
+	// webhooks that subscribed to completed get completions as completed, the others as updated
+	if completed && contains(hook.Events, WebhookCompleted) {
+		return WebhookCompleted
+	}
+	if contains(hook.Events, changeType) {
+		return changeType
+	}
+	return ""
+}
+
+// returns all webhooks of the todo list (without secrets)
+func (todoList *TodoList) GetWebhooks() []webhook {
+	webhooks := []webhook{}
+	for _, hook := range todoList.webhooks {
+		webhooks = append(webhooks, hook.withoutSecret())
+	}
+	return webhooks
+}
+
+/* searches the webhooks of the todo list for the given id
+ * if found -> returns a copy of the webhook without secret
+ * if not found -> returns nil
+ */
+func (todoList *TodoList) GetWebhookById(webhookId int) *webhook {
+	for _, hook := range todoList.webhooks {
+		if hook.Id == webhookId {
+			hook = hook.withoutSecret()
+			return &hook
+		}
+	}
+	// webhook with given id was not found -> return nil
+	return nil
+}
+
+/* appends a webhook to a todo list
+ * newWebhook:	data of webhook that will be added
+ * returns: the added webhook (the only time its secret is returned) or ErrQuota if the list has too many webhooks
+ */
+func (todoList *TodoList) AddWebhook(newWebhook webhook) (*webhook, error) {
+	if len(todoList.webhooks) >= MaxWebhooksPerList {
+		err := fmt.Errorf("%w: a list can hold at most %v webhooks", ErrQuota, MaxWebhooksPerList)
+		return nil, err
+	}
+	todoList.webhooks = append(todoList.webhooks, newWebhook)
+	return &newWebhook, nil
+}
+
+/* find a webhook by id and remove it from the todo list
+ * pending deliveries of the webhook are not sent anymore
+ * returns the deleted webhook (without secret)
+ */
+func (todoList *TodoList) RemoveWebhook(webhookId int) (*webhook, error) {
+	for index, hook := range todoList.webhooks {
+		if hook.Id == webhookId {
+			// cut the webhook out of the slice
+			todoList.webhooks = append(todoList.webhooks[:index], todoList.webhooks[index+1:]...)
+			hook = hook.withoutSecret()
+			return &hook, nil
+		}
+	}
+	err := fmt.Errorf("%w: webhook with id %v", ErrNotFound, webhookId)
+	return nil, err
+}
+
+// returns the deliveries of a webhook, the latest delivery first
+func (todoList *TodoList) GetDeliveries(webhookId int) []delivery {
+	deliveries := []delivery{}
+	for index := len(todoList.deliveries) - 1; index >= 0; index-- {
+		if todoList.deliveries[index].WebhookId == webhookId {
+			deliveries = append(deliveries, *todoList.deliveries[index])
+		}
+	}
+	return deliveries
+}
+
+// searches the deliveries of the todo list for the given ids, returns nil if not found
+func (todoList *TodoList) getDelivery(webhookId int, deliveryId int) *delivery {
+	for _, current := range todoList.deliveries {
+		if current.Id == deliveryId && current.WebhookId == webhookId {
+			return current
+		}
+	}
+	return nil
+}
+
+/* Sends a delivery to its webhook again, with new attempts and the same payload
+ * returns:	copy of the delivery or error (ErrNotFound, ErrConflict if the delivery is still pending)
+ */
+func (todoList *TodoList) Redeliver(webhookId int, deliveryId int) (*delivery, error) {
+
+	existing := todoList.getDelivery(webhookId, deliveryId)
+	if existing == nil || todoList.GetWebhookById(webhookId) == nil {
+		err := fmt.Errorf("%w: delivery with id %v of webhook %v", ErrNotFound, deliveryId, webhookId)
+		return nil, err
+	}
+	if existing.Status == DeliveryPending {
+		err := fmt.Errorf("%w: delivery with id %v is still pending", ErrConflict, deliveryId)
+		return nil, err
+	}
+
+	existing.Status = DeliveryPending
+	now := time.Now()
+	existing.NextAttempt = &now
+	go todoList.deliver(existing.Id)
+
+	deliveryCopy := *existing
+	return &deliveryCopy, nil
+}
+
+/* Creates a delivery for every webhook that subscribed to the change and starts sending them
+ * is called by publish, while the mutex of the list is held
+ * completed:	true if the change marked the todo as done
+ */
+func (todoList *TodoList) dispatchWebhooks(event Change, completed bool) {
+
+	for _, hook := range todoList.webhooks {
+		eventName := hook.eventFor(event.Type, completed)
+		if eventName == "" {
+			continue
+		}
+
+		payload, _ := json.Marshal(webhookPayload{eventName, event, time.Now()})
+		now := time.Now()
+		webhooksMutex.Lock()
+		newDelivery := &delivery{
+			Id:          deliveryIndex,
+			WebhookId:   hook.Id,
+			Event:       eventName,
+			Status:      DeliveryPending,
+			Payload:     payload,
+			Attempts:    []deliveryAttempt{},
+			NextAttempt: &now,
+		}
+		deliveryIndex++
+		webhooksMutex.Unlock()
+
+		// keep only the last deliveries, removed deliveries are not sent anymore
+		todoList.deliveries = append(todoList.deliveries, newDelivery)
+		if len(todoList.deliveries) > MaxDeliveriesPerList {
+			todoList.deliveries = append([]*delivery{}, todoList.deliveries[len(todoList.deliveries)-MaxDeliveriesPerList:]...)
+		}
+
+		go todoList.deliver(newDelivery.Id)
+	}
+}
+
+/* Sends a delivery until the receiver accepts it or every attempt failed
+ * runs in its own goroutine, the list is only locked to read and record the delivery,
+ * not while the request is sent
+ */
+func (todoList *TodoList) deliver(deliveryId int) {
+
+	for attempt := 1; ; attempt++ {
+
+		// read the delivery and the webhook, both may have been removed in the meantime
+		todoList.Lock()
+		var current *delivery
+		for _, candidate := range todoList.deliveries {
+			if candidate.Id == deliveryId {
+				current = candidate
+			}
+		}
+		var hook *webhook
+		for index := range todoList.webhooks {
+			if current != nil && todoList.webhooks[index].Id == current.WebhookId {
+				hook = &todoList.webhooks[index]
+			}
+		}
+		if current == nil || hook == nil {
+			todoList.Unlock()
+			return
+		}
+		target, secret, eventName, payload := hook.Url, hook.Secret, current.Event, current.Payload
+		todoList.Unlock()
+
+		result := sendWebhook(target, secret, eventName, deliveryId, payload)
+
+		// record the attempt and plan the next one
+		todoList.Lock()
+		current.Attempts = append(current.Attempts, result)
+		succeeded := result.Error == "" && result.StatusCode >= 200 && result.StatusCode < 300
+		delay := WebhookBackoff << (attempt - 1)
+		switch {
+		case succeeded:
+			current.Status, current.NextAttempt = DeliverySucceeded, nil
+		case attempt >= WebhookMaxAttempts:
+			current.Status, current.NextAttempt = DeliveryFailed, nil
+		default:
+			next := time.Now().Add(delay)
+			current.NextAttempt = &next
+		}
+		status := current.Status
+		todoList.Unlock()
+
+		log.Printf("webhook delivery %v to %v: attempt %v, %v", deliveryId, target, attempt, status)
+		if status != DeliveryPending {
+			return
+		}
+		time.Sleep(delay)
+	}
+}
+
+/* Sends the payload of a delivery to a webhook
+ * the body is signed with the secret of the webhook (X-Todo-Signature-256)
+ * returns:	the attempt with the status code of the receiver or the error
+ */
+func sendWebhook(target string, secret string, eventName string, deliveryId int, payload []byte) deliveryAttempt {
+
+	attempt := deliveryAttempt{Time: time.Now()}
+
+	request, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "klaemsch-todo-webhooks")
+	request.Header.Set("X-Todo-Event", eventName)
+	request.Header.Set("X-Todo-Delivery", strconv.Itoa(deliveryId))
+	request.Header.Set("X-Todo-Signature-256", SignWebhookPayload(secret, payload))
+
+	response, err := WebhookClient.Do(request)
+	attempt.Duration = time.Since(attempt.Time).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	response.Body.Close()
+
+	attempt.StatusCode = response.StatusCode
+	return attempt
+}
+
+/* Creates the signature of a payload, receivers compare it with the X-Todo-Signature-256 header
+ * secret:	secret of the webhook
+ * payload:	body of the delivery
+ * returns:	"sha256=" followed by the hex encoded HMAC-SHA256 of the payload
+ */
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
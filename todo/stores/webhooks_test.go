@@ -0,0 +1,307 @@
+package stores
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// request that was received by a test receiver
+type receivedDelivery struct {
+	header http.Header
+	body   []byte
+}
+
+/* Starts a receiver of webhooks on localhost and shortens the delays of the deliveries
+ * statuses:	status codes of the first responses, every later response is 200
+ * returns:		the receiver and a channel with every request it received
+ */
+func newWebhookReceiver(t *testing.T, statuses ...int) (*httptest.Server, chan receivedDelivery) {
+	t.Helper()
+
+	defaultBackoff, defaultAttempts := WebhookBackoff, WebhookMaxAttempts
+	WebhookBackoff, WebhookAllowInternalTargets = time.Millisecond, true
+
+	received := make(chan receivedDelivery, 100)
+	var mutex sync.Mutex
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedDelivery{r.Header.Clone(), body}
+		mutex.Lock()
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		mutex.Unlock()
+		w.WriteHeader(status)
+	}))
+
+	t.Cleanup(func() {
+		receiver.Close()
+		WebhookBackoff, WebhookMaxAttempts, WebhookAllowInternalTargets = defaultBackoff, defaultAttempts, false
+	})
+	return receiver, received
+}
+
+// creates a webhook from a json body and adds it to the list
+func addTestWebhook(t *testing.T, todoList *TodoList, body string) *webhook {
+	t.Helper()
+	newWebhook, err := NewWebhookFromJson(httptest.NewRequest("POST", "/webhooks", strings.NewReader(body)))
+	if err != nil {
+		t.Fatalf("invalid webhook %v: %v", body, err)
+	}
+	todoList.Lock()
+	defer todoList.Unlock()
+	addedWebhook, err := todoList.AddWebhook(*newWebhook)
+	if err != nil {
+		t.Fatalf("webhook could not be added: %v", err)
+	}
+	return addedWebhook
+}
+
+// waits until no delivery of the webhook is pending anymore and returns the deliveries, the latest first
+func waitForDeliveries(t *testing.T, todoList *TodoList, webhookId int) []delivery {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(5 * time.Millisecond) {
+		todoList.Lock()
+		deliveries := todoList.GetDeliveries(webhookId)
+		todoList.Unlock()
+
+		pending := false
+		for _, current := range deliveries {
+			pending = pending || current.Status == DeliveryPending
+		}
+		if !pending {
+			return deliveries
+		}
+	}
+	t.Fatalf("deliveries of webhook %v are still pending", webhookId)
+	return nil
+}
+
+// returns the status codes of the attempts of a delivery
+func attemptStatuses(current delivery) []int {
+	statuses := []int{}
+	for _, attempt := range current.Attempts {
+		statuses = append(statuses, attempt.StatusCode)
+	}
+	return statuses
+}
+
+// receivers can check the body with the secret of the webhook
+func TestWebhookSignature(t *testing.T) {
+	receiver, received := newWebhookReceiver(t)
+	todoList := newTestList(t)
+	hook := addTestWebhook(t, todoList, `{"url":"`+receiver.URL+`","secret":"s3cret"}`)
+
+	todoList.Lock()
+	todoList.AddTodo(todo{Id: nextTodoId(), Name: "milk"})
+	todoList.Unlock()
+	deliveries := waitForDeliveries(t, todoList, hook.Id)
+
+	request := <-received
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(request.body)
+	if signature := request.header.Get("X-Todo-Signature-256"); signature != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("got signature %v for body %s", signature, request.body)
+	}
+	if event := request.header.Get("X-Todo-Event"); event != ChangeCreated {
+		t.Errorf("got event header %v, want %v", event, ChangeCreated)
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(request.body, &payload); err != nil || payload.Event != ChangeCreated || payload.Change.Todo.Name != "milk" {
+		t.Errorf("got payload %s (%v)", request.body, err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != DeliverySucceeded || string(deliveries[0].Payload) != string(request.body) {
+		t.Errorf("got deliveries %+v", deliveries)
+	}
+}
+
+// completions are sent as completed to webhooks that subscribed to completed, as updated to the others
+func TestWebhookEvents(t *testing.T) {
+	tests := []struct {
+		events string
+		want   []string
+	}{
+		{`[]`, []string{"created", "updated", "completed", "deleted"}},
+		{`["updated"]`, []string{"updated", "updated"}},
+		{`["completed"]`, []string{"completed"}},
+		{`["completed","updated"]`, []string{"updated", "completed"}},
+		{`["created","deleted"]`, []string{"created", "deleted"}},
+	}
+
+	for _, test := range tests {
+		receiver, _ := newWebhookReceiver(t)
+		todoList := newTestList(t)
+		hook := addTestWebhook(t, todoList, `{"url":"`+receiver.URL+`","events":`+test.events+`}`)
+
+		// create, rename, complete and delete a todo
+		todoList.Lock()
+		created, _ := todoList.AddTodo(todo{Id: nextTodoId(), Name: "milk"})
+		todoList.UpdateTodo(todo{Id: created.Id, Name: "oat milk"})
+		todoList.UpdateTodo(todo{Id: created.Id, Name: "oat milk", Done: true})
+		todoList.RemoveTodo(created.Id)
+		todoList.Unlock()
+
+		events := []string{}
+		deliveries := waitForDeliveries(t, todoList, hook.Id)
+		for index := len(deliveries) - 1; index >= 0; index-- {
+			events = append(events, deliveries[index].Event)
+		}
+		if !reflect.DeepEqual(events, test.want) {
+			t.Errorf("%v: got events %v, want %v", test.events, events, test.want)
+		}
+	}
+}
+
+// every attempt is recorded, deliveries fail after WebhookMaxAttempts attempts
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []int
+		maxAttempts int
+		want        []int
+		status      string
+	}{
+		{"first attempt succeeds", nil, 3, []int{200}, DeliverySucceeded},
+		{"retried until the receiver accepts", []int{500, 503}, 3, []int{500, 503, 200}, DeliverySucceeded},
+		{"redirects are no success", []int{302}, 1, []int{302}, DeliveryFailed},
+		{"every attempt failed", []int{500, 500, 500}, 3, []int{500, 500, 500}, DeliveryFailed},
+	}
+
+	for _, test := range tests {
+		receiver, _ := newWebhookReceiver(t, test.statuses...)
+		WebhookMaxAttempts = test.maxAttempts
+		todoList := newTestList(t)
+		hook := addTestWebhook(t, todoList, `{"url":"`+receiver.URL+`"}`)
+
+		todoList.Lock()
+		todoList.AddTodo(todo{Id: nextTodoId(), Name: "milk"})
+		todoList.Unlock()
+
+		deliveries := waitForDeliveries(t, todoList, hook.Id)
+		if got := attemptStatuses(deliveries[0]); deliveries[0].Status != test.status || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %v with attempts %v, want %v with %v", test.name, deliveries[0].Status, got, test.status, test.want)
+		}
+		if deliveries[0].NextAttempt != nil {
+			t.Errorf("%v: finished delivery has a next attempt", test.name)
+		}
+	}
+}
+
+// a delivery can be sent again once it is finished, with new attempts and the same payload
+func TestWebhookRedeliver(t *testing.T) {
+	release := make(chan bool)
+	receiver, _ := newWebhookReceiver(t)
+	// the first request waits, so the delivery is pending
+	var blocked sync.Once
+	blocking := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blocked.Do(func() { <-release })
+		receiver.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer blocking.Close()
+
+	WebhookMaxAttempts = 1
+	todoList := newTestList(t)
+	hook := addTestWebhook(t, todoList, `{"url":"`+blocking.URL+`"}`)
+
+	todoList.Lock()
+	todoList.AddTodo(todo{Id: nextTodoId(), Name: "milk"})
+	deliveryId := todoList.deliveries[0].Id
+	_, err := todoList.Redeliver(hook.Id, deliveryId)
+	todoList.Unlock()
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("redelivery of a pending delivery: got %v, want ErrConflict", err)
+	}
+
+	close(release)
+	first := waitForDeliveries(t, todoList, hook.Id)[0]
+
+	todoList.Lock()
+	redelivered, err := todoList.Redeliver(hook.Id, deliveryId)
+	_, errUnknown := todoList.Redeliver(hook.Id, -1)
+	todoList.Unlock()
+	if err != nil || redelivered.Status != DeliveryPending {
+		t.Fatalf("redelivery: got %+v (%v)", redelivered, err)
+	}
+	if !errors.Is(errUnknown, ErrNotFound) {
+		t.Errorf("redelivery of an unknown delivery: got %v, want ErrNotFound", errUnknown)
+	}
+
+	second := waitForDeliveries(t, todoList, hook.Id)[0]
+	if second.Id != first.Id || second.Status != DeliverySucceeded || len(second.Attempts) != 2 || string(second.Payload) != string(first.Payload) {
+		t.Errorf("got redelivery %+v after %+v", second, first)
+	}
+}
+
+// urls and connections to the network of the server are refused
+func TestWebhookInternalTargets(t *testing.T) {
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"https://hooks.example.com/todo", []string{}},
+		{"https://93.184.216.34/todo", []string{}},
+		{"http://127.0.0.1:8080/", []string{"url:internal_target"}},
+		{"http://localhost/", []string{"url:internal_target"}},
+		{"http://169.254.169.254/latest/meta-data", []string{"url:internal_target"}},
+		{"http://10.0.0.1/", []string{"url:internal_target"}},
+		{"http://172.16.5.4/", []string{"url:internal_target"}},
+		{"http://192.168.1.1/", []string{"url:internal_target"}},
+		{"http://100.64.0.1/", []string{"url:internal_target"}},
+		{"http://100.127.255.254/", []string{"url:internal_target"}},
+		{"http://100.128.0.1/", []string{}},
+		{"http://[::1]/", []string{"url:internal_target"}},
+		{"http://[fe80::1]/", []string{"url:internal_target"}},
+		{"http://0.0.0.0/", []string{"url:internal_target"}},
+		{"ftp://hooks.example.com/", []string{"url:invalid_url"}},
+	}
+
+	for _, test := range tests {
+		validationError := &ValidationError{}
+		validateWebhook(&webhook{Url: test.url}, validationError)
+		if got := violations(validationError); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got violations %v, want %v", test.url, got, test.want)
+		}
+	}
+
+	for address, allowed := range map[string]bool{"93.184.216.34:443": true, "127.0.0.1:80": false, "169.254.169.254:80": false, "[::ffff:10.0.0.1]:80": false, "100.100.100.200:80": false} {
+		if err := checkWebhookDial("tcp", address, nil); (err == nil) != allowed {
+			t.Errorf("dial %v: got error %v", address, err)
+		}
+	}
+}
+
+/* names that resolve to internal addresses pass the validation, the connection is refused when it is dialed
+ * the webhook is added without validation, like a name that resolved to a public address when it was created
+ */
+func TestWebhookDialRefusesInternalAddresses(t *testing.T) {
+	receiver, received := newWebhookReceiver(t)
+	WebhookAllowInternalTargets = false
+	WebhookMaxAttempts = 1
+
+	todoList := newTestList(t)
+	todoList.Lock()
+	hook, _ := todoList.AddWebhook(webhook{Id: 1, Url: receiver.URL})
+	todoList.AddTodo(todo{Id: nextTodoId(), Name: "milk"})
+	todoList.Unlock()
+
+	deliveries := waitForDeliveries(t, todoList, hook.Id)
+	if deliveries[0].Status != DeliveryFailed || deliveries[0].Attempts[0].StatusCode != 0 || !strings.Contains(deliveries[0].Attempts[0].Error, "internal address") {
+		t.Errorf("got delivery %+v", deliveries[0])
+	}
+	if len(received) != 0 {
+		t.Errorf("the receiver got %v requests", len(received))
+	}
+}